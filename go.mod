@@ -1,23 +1,26 @@
 module clipsync
 
-go 1.25.0
+go 1.26.0
 
 require (
 	gioui.org v0.9.0
-	gioui.org/x v0.9.0
+	github.com/creack/pty v1.1.24
 	github.com/grandcat/zeroconf v1.0.0
+	github.com/klauspost/compress v1.18.0
 	github.com/mattn/go-isatty v0.0.22
+	github.com/spf13/cobra v1.10.2
 	golang.design/x/clipboard v0.7.1
 	golang.org/x/sync v0.20.0
+	golang.org/x/term v0.46.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
-	git.sr.ht/~jackmordaunt/go-toast v1.0.0 // indirect
-	git.wow.st/gmp/jni v0.0.0-20210610011705-34026c7e22d0 // indirect
-	github.com/esiqveland/notify v0.11.0 // indirect
-	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/godbus/dbus/v5 v5.0.6 // indirect
-	golang.org/x/exp v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
+	github.com/cpuguy83/go-md2man/v2 v2.0.6 // indirect
+	github.com/inconshreveable/mousetrap v1.1.0 // indirect
+	github.com/russross/blackfriday/v2 v2.1.0 // indirect
+	github.com/spf13/pflag v1.0.9 // indirect
+	go.yaml.in/yaml/v3 v3.0.4 // indirect
 )
 
 require (
@@ -31,7 +34,7 @@ require (
 	golang.org/x/exp/shiny v0.0.0-20250606033433-dcc06ee1d476 // indirect
 	golang.org/x/image v0.37.0 // indirect
 	golang.org/x/mobile v0.0.0-20250606033058-a2a15c67f36f // indirect
-	golang.org/x/net v0.35.0 // indirect
-	golang.org/x/sys v0.42.0 // indirect
+	golang.org/x/net v0.35.0
+	golang.org/x/sys v0.48.0
 	golang.org/x/text v0.35.0 // indirect
 )
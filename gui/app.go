@@ -80,15 +80,19 @@ func layoutMain(gtx layout.Context, s *AppState) layout.Dimensions {
 					if s.ActiveTab == 1 {
 						title = "Clipboard"
 					}
-					return components.Header(gtx, s.Theme, &s.HelpBtn, title)
+					return components.Header(gtx, s.Theme, &s.HelpBtn, title, s.Paused)
 				}),
 
 				// Body (Dynamic Page Content)
 				layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 					if s.ActiveTab == 0 {
-						return pages.DevicesPage(gtx, s.Theme, &s.DeviceList, s.Devices)
+						s.MembersMu.Lock()
+						defer s.MembersMu.Unlock()
+						return pages.DevicesPage(gtx, s.Theme, &s.DeviceList, s.Devices, s.Members, &s.RotateBtn)
 					}
-					return pages.ClipboardPage(gtx, s.Theme, &s.ClipList, s.History)
+					s.TransfersMu.Lock()
+					defer s.TransfersMu.Unlock()
+					return pages.ClipboardPage(gtx, s.Theme, &s.ClipList, s.History, s.Transfers)
 				}),
 
 				// Footer (Navigation Tabs)
@@ -9,15 +9,26 @@ import (
 	"gioui.org/widget/material"
 )
 
-// Header lays out the top bar with Title and Help button.
-func Header(gtx layout.Context, th *material.Theme, helpBtn *widget.Clickable, titleText string) layout.Dimensions {
+// Header lays out the top bar with Title and Help button. A non-empty
+// paused reason is shown next to the title.
+func Header(gtx layout.Context, th *material.Theme, helpBtn *widget.Clickable, titleText, paused string) layout.Dimensions {
 	return layout.UniformInset(unit.Dp(16)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
 		return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle, Spacing: layout.SpaceBetween}.Layout(gtx,
-			// Left side: Title
+			// Left side: Title, and the paused state under it
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
 				title := material.H5(th, titleText)
 				title.Color = themes.ColorCyan
-				return title.Layout(gtx)
+				if paused == "" {
+					return title.Layout(gtx)
+				}
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(title.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						status := material.Caption(th, "paused: "+paused)
+						status.Color = themes.ColorWarning
+						return status.Layout(gtx)
+					}),
+				)
 			}),
 			// Right side: Help Button
 			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -1,6 +1,8 @@
 package pages
 
 import (
+	"fmt"
+
 	"clipsync/gui/themes"
 	"clipsync/gui/widgets"
 
@@ -10,9 +12,32 @@ import (
 	"gioui.org/widget/material"
 )
 
-// ClipboardPage lays out the clipboard history list.
-func ClipboardPage(gtx layout.Context, th *material.Theme, list *widget.List, history []string) layout.Dimensions {
+// Transfer is a running transfer, shown with a progress bar above the
+// history.
+type Transfer struct {
+	ID       string
+	Name     string
+	Peer     string
+	Incoming bool
+	Size     int64
+	Done     int64
+	Speed    float64
+	Cancel   widget.Clickable
+}
+
+// ClipboardPage lays out the running transfers and the clipboard history list.
+func ClipboardPage(gtx layout.Context, th *material.Theme, list *widget.List, history []string, transfers []Transfer) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+		// Transfers in progress
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			children := make([]layout.FlexChild, len(transfers))
+			for i := range transfers {
+				children[i] = layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return transferCard(gtx, th, &transfers[i])
+				})
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		}),
 		// Scrollable List of Clipboard items
 		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
 			return list.Layout(gtx, len(history), func(gtx layout.Context, index int) layout.Dimensions {
@@ -34,3 +59,63 @@ func clipboardCard(gtx layout.Context, th *material.Theme, content string) layou
 		})
 	})
 }
+
+// transferCard renders a transfer's progress with a button to cancel it.
+func transferCard(gtx layout.Context, th *material.Theme, t *Transfer) layout.Dimensions {
+	return layout.Inset{Left: unit.Dp(16), Right: unit.Dp(16), Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return widgets.RoundedBox(gtx, 8, themes.ColorSurface, func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(16)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+							layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+								direction := "to"
+								if t.Incoming {
+									direction = "from"
+								}
+								name := material.Body1(th, fmt.Sprintf("%s %s %s", t.Name, direction, t.Peer))
+								name.Color = themes.ColorText
+								return name.Layout(gtx)
+							}),
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								btn := material.Button(th, &t.Cancel, "Cancel")
+								btn.Background = themes.ColorBg
+								btn.Color = themes.ColorCyan
+								btn.TextSize = unit.Sp(12)
+								btn.Inset = layout.UniformInset(unit.Dp(6))
+								return btn.Layout(gtx)
+							}),
+						)
+					}),
+					layout.Rigid(layout.Spacer{Height: unit.Dp(8)}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						var progress float32
+						if t.Size > 0 {
+							progress = float32(t.Done) / float32(t.Size)
+						}
+						bar := material.ProgressBar(th, progress)
+						bar.Color = themes.ColorCyan
+						bar.TrackColor = themes.ColorBg
+						return bar.Layout(gtx)
+					}),
+					layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						status := material.Caption(th, fmt.Sprintf("%s of %s, %s/s", formatBytes(t.Done), formatBytes(t.Size), formatBytes(int64(t.Speed))))
+						status.Color = themes.ColorTextMuted
+						return status.Layout(gtx)
+					}),
+				)
+			})
+		})
+	})
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
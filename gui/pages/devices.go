@@ -2,6 +2,7 @@ package pages
 
 import (
 	"fmt"
+	"time"
 
 	"clipsync/gui/themes"
 	"clipsync/gui/widgets"
@@ -17,8 +18,19 @@ type Device struct {
 	IP   string
 }
 
-// DevicesPage lays out the connection info and devices list.
-func DevicesPage(gtx layout.Context, th *material.Theme, list *widget.List, devices []Device) layout.Dimensions {
+// Member is a device of the relay group, shown with a button to revoke it.
+type Member struct {
+	ID      string
+	Name    string
+	Seen    time.Time
+	Revoked bool
+	Self    bool
+	Revoke  widget.Clickable
+}
+
+// DevicesPage lays out the connection info, the devices list and the
+// members of the relay group, with a button to rotate its key.
+func DevicesPage(gtx layout.Context, th *material.Theme, list *widget.List, devices []Device, members []Member, rotate *widget.Clickable) layout.Dimensions {
 	return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
 		// Sub-header text
 		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
@@ -28,10 +40,20 @@ func DevicesPage(gtx layout.Context, th *material.Theme, list *widget.List, devi
 				return lbl.Layout(gtx)
 			})
 		}),
-		// Scrollable List of Devices
+		// Scrollable List of Devices, then the relay group
 		layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
-			return list.Layout(gtx, len(devices), func(gtx layout.Context, index int) layout.Dimensions {
-				return deviceCard(gtx, th, devices[index])
+			rows := len(devices)
+			if len(members) > 0 {
+				rows += 1 + len(members)
+			}
+			return list.Layout(gtx, rows, func(gtx layout.Context, index int) layout.Dimensions {
+				switch {
+				case index < len(devices):
+					return deviceCard(gtx, th, devices[index])
+				case index == len(devices):
+					return relayHeader(gtx, th, rotate)
+				}
+				return memberCard(gtx, th, &members[index-len(devices)-1])
 			})
 		}),
 	)
@@ -59,3 +81,80 @@ func deviceCard(gtx layout.Context, th *material.Theme, dev Device) layout.Dimen
 		})
 	})
 }
+
+// relayHeader titles the relay group members, with a button to rotate the
+// group key.
+func relayHeader(gtx layout.Context, th *material.Theme, rotate *widget.Clickable) layout.Dimensions {
+	return layout.Inset{Top: unit.Dp(8), Left: unit.Dp(16), Right: unit.Dp(16), Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+			layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+				lbl := material.Body1(th, "relay group")
+				lbl.Color = themes.ColorTextMuted
+				return lbl.Layout(gtx)
+			}),
+			layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				btn := material.Button(th, rotate, "Rotate key")
+				btn.Background = themes.ColorBg
+				btn.Color = themes.ColorCyan
+				btn.TextSize = unit.Sp(12)
+				btn.Inset = layout.UniformInset(unit.Dp(6))
+				return btn.Layout(gtx)
+			}),
+		)
+	})
+}
+
+// memberCard renders a relay group member, with a button to revoke it
+// unless it is this device or already revoked.
+func memberCard(gtx layout.Context, th *material.Theme, m *Member) layout.Dimensions {
+	status := "last seen " + m.Seen.Format("Jan 2 15:04")
+	switch {
+	case m.Self:
+		status = "this device"
+	case m.Revoked:
+		status = "revoked"
+	case m.Seen.IsZero():
+		status = "never seen"
+	}
+	name := m.Name
+	if name == "" {
+		name = m.ID
+	}
+	return layout.Inset{Left: unit.Dp(16), Right: unit.Dp(16), Bottom: unit.Dp(8)}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+		return widgets.RoundedBox(gtx, 8, themes.ColorSurface, func(gtx layout.Context) layout.Dimensions {
+			return layout.UniformInset(unit.Dp(16)).Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+				return layout.Flex{Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, func(gtx layout.Context) layout.Dimensions {
+						return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								lbl := material.Body1(th, name)
+								lbl.Color = themes.ColorText
+								if m.Revoked {
+									lbl.Color = themes.ColorTextMuted
+								}
+								return lbl.Layout(gtx)
+							}),
+							layout.Rigid(layout.Spacer{Height: unit.Dp(4)}.Layout),
+							layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+								lbl := material.Caption(th, fmt.Sprintf("ID: %s, %s", m.ID, status))
+								lbl.Color = themes.ColorTextMuted
+								return lbl.Layout(gtx)
+							}),
+						)
+					}),
+					layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+						if m.Self || m.Revoked {
+							return layout.Dimensions{}
+						}
+						btn := material.Button(th, &m.Revoke, "Revoke")
+						btn.Background = themes.ColorBg
+						btn.Color = themes.ColorCyan
+						btn.TextSize = unit.Sp(12)
+						btn.Inset = layout.UniformInset(unit.Dp(6))
+						return btn.Layout(gtx)
+					}),
+				)
+			})
+		})
+	})
+}
@@ -2,12 +2,25 @@ package gui
 
 import (
 	"clipsync/gui/pages"
+	"sync"
 
 	"gioui.org/layout"
 	"gioui.org/widget"
 	"gioui.org/widget/material"
 )
 var State *AppState
+
+// CancelTransfer is called when the user cancels a transfer. It is set by
+// whatever runs the engine, as the GUI can't reach it directly.
+var CancelTransfer func(id string)
+
+// RevokeDevice and RotateKey are called when the user revokes a relay
+// group member or rotates the group key, set like CancelTransfer.
+var (
+	RevokeDevice func(id string)
+	RotateKey    func()
+)
+
 // AppState keeps track of the global application state.
 // This struct ensures our GUI is interactive and holds the mock data.
 type AppState struct {
@@ -25,6 +38,20 @@ type AppState struct {
 	ClipList widget.List
 	History  []string
 
+	// Transfers is updated from the network goroutines, so it is only
+	// touched with TransfersMu held
+	TransfersMu sync.Mutex
+	Transfers   []pages.Transfer
+
+	// Members of the relay group, updated from the relay goroutine and
+	// so only touched with MembersMu held
+	MembersMu sync.Mutex
+	Members   []pages.Member
+	RotateBtn widget.Clickable
+
+	// Paused is why sync is paused, shown in the header
+	Paused string
+
 	// Dialog State
 	HelpBtn      widget.Clickable
 	CloseHelpBtn widget.Clickable
@@ -73,4 +100,25 @@ func (s *AppState) Update(gtx layout.Context) {
 	if s.CloseHelpBtn.Clicked(gtx) {
 		s.ShowHelp = false
 	}
+
+	// Handle Transfer Cancel Clicks
+	s.TransfersMu.Lock()
+	for i := range s.Transfers {
+		if s.Transfers[i].Cancel.Clicked(gtx) && CancelTransfer != nil {
+			go CancelTransfer(s.Transfers[i].ID)
+		}
+	}
+	s.TransfersMu.Unlock()
+
+	// Handle Relay Group Clicks
+	if s.RotateBtn.Clicked(gtx) && RotateKey != nil {
+		go RotateKey()
+	}
+	s.MembersMu.Lock()
+	for i := range s.Members {
+		if s.Members[i].Revoke.Clicked(gtx) && RevokeDevice != nil {
+			go RevokeDevice(s.Members[i].ID)
+		}
+	}
+	s.MembersMu.Unlock()
 }
@@ -8,4 +8,5 @@ var (
 	ColorSurface   = color.NRGBA{R: 30, G: 30, B: 30, A: 255}    // Card Background
 	ColorText      = color.NRGBA{R: 255, G: 255, B: 255, A: 255} // White Text
 	ColorTextMuted = color.NRGBA{R: 150, G: 150, B: 150, A: 255} // Gray Text
+	ColorWarning   = color.NRGBA{R: 255, G: 176, B: 32, A: 255}  // Amber Warning
 )
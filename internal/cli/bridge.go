@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/core"
+	"clipsync/internal/events"
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+
+	"github.com/spf13/cobra"
+)
+
+// bridgeEnv is set inside a bridged session so bridges don't nest.
+const bridgeEnv = "CLIPSYNC_TERM_BRIDGE"
+
+func newTermBridgeCmd() *cobra.Command {
+	var hook bool
+
+	cmd := &cobra.Command{
+		Use:   "term-bridge [-- command...]",
+		Short: "Bridge the clipboard to your terminal with OSC 52",
+		Long: `Bridge the clipboard to your terminal with OSC 52 escape sequences.
+
+term-bridge runs your shell (or the given command) in a pseudo terminal.
+Clips received from other devices are sent to your local terminal as OSC 52
+writes, and OSC 52 writes made by programs in the session are synced.
+If a daemon is already running the bridge attaches to it, otherwise it runs
+the sync engine itself.
+
+With --hook, a single clip is read from standard input instead, either raw
+text or OSC 52 sequences, and sent to the running daemon. Use it from tmux:
+
+  set -s copy-command 'clipsync term-bridge --hook'`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if hook {
+				return bridgeHook()
+			}
+			if os.Getenv(bridgeEnv) != "" {
+				return usageError{"already inside a term-bridge session"}
+			}
+			if len(args) == 0 {
+				shell := os.Getenv("SHELL")
+				if shell == "" {
+					shell = "/bin/sh"
+				}
+				args = []string{shell}
+			}
+			return termBridge(args)
+		},
+	}
+	cmd.Flags().BoolVar(&hook, "hook", false, "read one clip from standard input and send it to the daemon")
+	quietBanner(cmd)
+	return cmd
+}
+
+// bridgeHook sends the clip on stdin to the daemon. OSC 52 sequences are
+// unwrapped; anything else is sent as is.
+func bridgeHook() error {
+	data, err := io.ReadAll(io.LimitReader(os.Stdin, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read standard input: %w", err)
+	}
+	clips := clipboard.DecodeOSC52(data)
+	if len(clips) > 0 {
+		data = clips[len(clips)-1]
+	}
+	if len(data) == 0 {
+		return nil
+	}
+	return ipc.SendClipboard(string(data))
+}
+
+// termBridge runs argv in a pseudo terminal wired to the sync engine.
+func termBridge(argv []string) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer cancel()
+
+	// The session and the bridge both write to the terminal
+	term := &lockedWriter{w: os.Stdout}
+	osc := clipboard.NewOSC52(term)
+
+	// Never log to the terminal the session is drawing on
+	logFile, err := setupLogging(nil, "", false)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	logger := logging.For(logging.Daemon)
+
+	if ipc.IsRunning() {
+		go attachBridge(ctx, osc)
+		return runPTY(argv, term, func(data []byte) {
+			osc.Capture(data)
+			if err := ipc.SendClipboard(string(data)); err != nil {
+				logger.Warn("Terminal bridge send failed", logging.Err(err))
+			}
+		})
+	}
+
+	logger.Info("Starting ClipSync terminal bridge")
+	clipboard.UseBackend(osc)
+	go func() {
+		err := core.Run(ctx, core.Options{})
+		if err != nil && err != context.Canceled {
+			logger.Error("Terminal bridge engine stopped", logging.Err(err))
+		}
+	}()
+	return runPTY(argv, term, osc.Capture)
+}
+
+// attachBridge sends clips the running daemon receives to the terminal.
+func attachBridge(ctx context.Context, osc *clipboard.OSC52) {
+	stream, err := ipc.Events(ctx)
+	if err != nil {
+		logging.For(logging.Daemon).Warn("Terminal bridge could not follow the daemon", logging.Err(err))
+		return
+	}
+	for e := range stream {
+		if e.Type != events.ClipAdded && e.Type != events.ClipFetched || e.Clip == nil || e.Clip.Pending {
+			continue
+		}
+		// Skip clips that came from this session in the first place
+		if !bytes.Equal(osc.Read(), []byte(e.Clip.Data)) {
+			osc.Write([]byte(e.Clip.Data))
+		}
+	}
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (l *lockedWriter) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.w.Write(p)
+}
@@ -0,0 +1,59 @@
+//go:build !windows
+
+package cli
+
+import (
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+
+	"clipsync/internal/clipboard"
+
+	"github.com/creack/pty"
+	"golang.org/x/term"
+)
+
+// runPTY runs argv in a pseudo terminal, copying its output to out and
+// reporting every OSC 52 write it makes to onClip.
+func runPTY(argv []string, out io.Writer, onClip func([]byte)) error {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = append(os.Environ(), bridgeEnv+"=1")
+
+	ptmx, err := pty.Start(cmd)
+	if err != nil {
+		return err
+	}
+	defer ptmx.Close()
+
+	// Keep the session the same size as our terminal
+	resize := make(chan os.Signal, 1)
+	signal.Notify(resize, syscall.SIGWINCH)
+	defer signal.Stop(resize)
+	go func() {
+		for range resize {
+			pty.InheritSize(os.Stdin, ptmx)
+		}
+	}()
+	resize <- syscall.SIGWINCH
+
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return err
+		}
+		defer term.Restore(int(os.Stdin.Fd()), state)
+	}
+
+	go io.Copy(ptmx, os.Stdin)
+	io.Copy(clipboard.NewOSC52Scanner(out, onClip), ptmx)
+
+	// The session's own exit status is not ours to report
+	var exitErr *exec.ExitError
+	if err := cmd.Wait(); err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+	return nil
+}
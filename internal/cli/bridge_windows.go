@@ -0,0 +1,10 @@
+package cli
+
+import (
+	"errors"
+	"io"
+)
+
+func runPTY(argv []string, out io.Writer, onClip func([]byte)) error {
+	return errors.New("term-bridge sessions are not supported on Windows; use --hook")
+}
@@ -0,0 +1,66 @@
+package cli_test
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"clipsync/internal/cli"
+	"clipsync/internal/ipc"
+)
+
+// startDaemon serves the control API on its usual port from a throwaway
+// state directory.
+func startDaemon(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LOCALAPPDATA", dir)
+
+	ln, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", ipc.PORT))
+	if err != nil {
+		t.Skipf("control port is taken: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go ipc.Serve(ctx, ln, cancel)
+
+	path, err := ipc.TokenPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("daemon did not write its token")
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	startDaemon(t)
+	tests := []struct {
+		name string
+		args []string
+		want int
+	}{
+		{"no address", []string{"connect"}, 2},
+		{"bad port", []string{"connect", "10.0.0.1:http"}, 2},
+		{"unresolvable", []string{"connect", "nowhere.invalid"}, 4},
+		{"revoke nothing", []string{"devices", "revoke"}, 2},
+		{"revoke without a relay", []string{"devices", "revoke", "0011223344556677"}, 1},
+		{"rotate without a relay", []string{"relay", "rotate"}, 1},
+		{"members without a relay", []string{"relay", "members"}, 1},
+	}
+	for _, tt := range tests {
+		if got := cli.Execute(tt.args...); got != tt.want {
+			t.Errorf("%s: clipsync %v exited %d, want %d", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
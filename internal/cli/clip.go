@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"clipsync/internal/ipc"
+
+	"github.com/spf13/cobra"
+)
+
+func newGetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get",
+		Short: "Print the daemon's clipboard contents",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ipc.Clipboard()
+			if err != nil {
+				return err
+			}
+			out.result(clipResult{Data: data}, func(w io.Writer) {
+				io.WriteString(w, data)
+			})
+			return nil
+		},
+	}
+	quietBanner(cmd)
+	return cmd
+}
+
+func newSendCmd() *cobra.Command {
+	var sensitive bool
+	cmd := &cobra.Command{
+		Use:   "send [text...]",
+		Short: "Put text on the clipboard and sync it to other devices",
+		Long:  "Put text on the clipboard and sync it to other devices.\nWith no text, or with -, the clip is read from standard input.\n\nWith --sensitive, e.g. for a password, the clip is kept out of the history\nsaved to disk.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data string
+			if len(args) == 0 || (len(args) == 1 && args[0] == "-") {
+				b, err := io.ReadAll(os.Stdin)
+				if err != nil {
+					return fmt.Errorf("failed to read standard input: %w", err)
+				}
+				data = string(b)
+			} else {
+				data = strings.Join(args, " ")
+			}
+			if data == "" {
+				return usageError{"nothing to send"}
+			}
+
+			send := ipc.SendClipboard
+			if sensitive {
+				send = ipc.SendSensitive
+			}
+			if err := send(data); err != nil {
+				return err
+			}
+			out.result(clipResult{Data: data}, func(w io.Writer) {
+				fmt.Fprintf(w, "[+] Sent %d bytes to the clipboard.\n", len(data))
+			})
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&sensitive, "sensitive", false, "never save the clip to disk with the history")
+	quietBanner(cmd)
+	return cmd
+}
+
+type clipResult struct {
+	Data string `json:"data" yaml:"data"`
+}
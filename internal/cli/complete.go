@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"clipsync/internal/ipc"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// completeDevices offers the IPs of the devices the daemon knows about,
+// described by their names.
+func completeDevices(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	devices, err := ipc.Devices()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []cobra.Completion
+	for _, dev := range devices {
+		completions = append(completions, cobra.CompletionWithDesc(dev.Ip, dev.Name))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeHistory offers history IDs described by a preview of the entry.
+func completeHistory(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	history, err := ipc.History()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []cobra.Completion
+	for _, clip := range history {
+		completions = append(completions, cobra.CompletionWithDesc(strconv.Itoa(clip.ID), preview(clip.Data, 40)))
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveKeepOrder
+}
+
+func newManCmd(root *cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "man [dir]",
+		Short: "Generate man pages for every command",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			dir := "."
+			if len(args) == 1 {
+				dir = args[0]
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			header := &doc.GenManHeader{Title: "CLIPSYNC", Section: "1", Source: "ClipSync"}
+			if err := doc.GenManTree(root, header, dir); err != nil {
+				return fmt.Errorf("failed to generate man pages: %w", err)
+			}
+			out.info("[+] Man pages written to %s", dir)
+			return nil
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,310 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/config"
+	"clipsync/internal/core"
+	"clipsync/internal/instance"
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+	"clipsync/internal/service"
+
+	"github.com/spf13/cobra"
+)
+
+// DaemonOptions controls how the sync engine runs. Unset options fall
+// back to the config file.
+type DaemonOptions struct {
+	// Headless uses an in-memory clipboard instead of the system one.
+	Headless bool
+	// ClipFile exposes the clipboard through a file or named pipe.
+	ClipFile string
+	// LogLevel is the minimum level written to the log.
+	LogLevel string
+	// MetricsAddr serves metrics on a separate address.
+	MetricsAddr string
+}
+
+// addDaemonFlags registers the flags shared by start and daemon.
+func addDaemonFlags(cmd *cobra.Command, opts *DaemonOptions) {
+	cmd.Flags().BoolVar(&opts.Headless, "headless", false, "keep a virtual clipboard in memory instead of using the system clipboard")
+	cmd.Flags().StringVar(&opts.ClipFile, "clip-file", "", "mirror the clipboard to this file, or read clips from it if it is a named pipe")
+	cmd.Flags().StringVar(&opts.LogLevel, "log-level", "", "minimum level to log: debug, info, warn or error (default info)")
+	cmd.RegisterFlagCompletionFunc("log-level", completeLevels)
+	cmd.Flags().StringVar(&opts.MetricsAddr, "metrics-addr", "", "also serve Prometheus metrics on this address, e.g. 127.0.0.1:9997")
+}
+
+func newStartCmd() *cobra.Command {
+	opts := DaemonOptions{}
+	cmd := &cobra.Command{
+		Use:   "start",
+		Short: "Start the background daemon",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return startDaemon(opts)
+		},
+	}
+	addDaemonFlags(cmd, &opts)
+	return cmd
+}
+
+func newStopCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "stop",
+		Short: "Stop the background daemon",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return stopDaemon()
+		},
+	}
+}
+
+func newRestartCmd() *cobra.Command {
+	opts := DaemonOptions{}
+	cmd := &cobra.Command{
+		Use:   "restart",
+		Short: "Stop the background daemon, wait for it to exit and start it again",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, running := instance.Running(); running {
+				out.info("[*] Stopping ClipSync...")
+				if err := ipc.Stop(); err != nil && !errors.Is(err, ipc.ErrDaemonNotRunning) {
+					return err
+				}
+				if err := waitForExit(stopTimeout); err != nil {
+					return err
+				}
+			}
+			return startDaemon(opts)
+		},
+	}
+	addDaemonFlags(cmd, &opts)
+	return cmd
+}
+
+// stopTimeout bounds how long stop and restart wait for the daemon to exit.
+const stopTimeout = 15 * time.Second
+
+// waitForExit waits until no instance holds the single-instance lock.
+func waitForExit(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pid, running := instance.Running()
+		if !running {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("daemon (PID %d) did not exit within %s", pid, timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func newStatusCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Check whether the background daemon is running",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := ipc.Status()
+			if err != nil {
+				return err
+			}
+			out.result(status, func(w io.Writer) {
+				mode := "system clipboard"
+				if status.Headless {
+					mode = "headless"
+				}
+				fmt.Fprintf(w, "[+] ClipSync daemon is running (PID: %d, %s).\n", status.PID, mode)
+				if status.Paused != "" {
+					fmt.Fprintf(w, "[!] paused: %s. Nothing is synced until a trusted network is joined.\n", status.Paused)
+				}
+				switch {
+				case status.Relay != "" && status.RelayConnected:
+					fmt.Fprintf(w, "[+] Connected to relay %s.\n", status.Relay)
+				case status.Relay != "":
+					fmt.Fprintf(w, "[!] Not connected to relay %s yet.\n", status.Relay)
+				}
+				for ip, until := range status.Blocked {
+					fmt.Fprintf(w, "[!] Ignoring %s until %s: it sent too many bad or excess messages.\n", ip, until.Format("15:04:05"))
+				}
+			})
+			return nil
+		},
+	}
+}
+
+// newDaemonCmd is the entry point the background process is started with.
+func newDaemonCmd() *cobra.Command {
+	opts := DaemonOptions{}
+	cmd := &cobra.Command{
+		Use:    "daemon",
+		Short:  "Run the sync engine in the foreground",
+		Hidden: true,
+		Args:   noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return RunDaemon(opts)
+		},
+	}
+	addDaemonFlags(cmd, &opts)
+	quietBanner(cmd)
+	return cmd
+}
+
+type daemonResult struct {
+	Status string `json:"status" yaml:"status"`
+	PID    int    `json:"pid,omitempty" yaml:"pid,omitempty"`
+}
+
+func startDaemon(opts DaemonOptions) error {
+	if _, running := instance.Running(); running || ipc.IsRunning() {
+		out.result(daemonResult{Status: "already_running"}, func(w io.Writer) {
+			fmt.Fprintln(w, "[*] ClipSync background daemon is already running.")
+		})
+		return nil
+	}
+
+	out.info("[*] Starting ClipSync in the background...")
+
+	// Prefer the service manager so the daemon is supervised
+	if !opts.Headless && opts.ClipFile == "" && opts.LogLevel == "" && opts.MetricsAddr == "" {
+		err := service.Start()
+		if err == nil {
+			out.result(daemonResult{Status: "started"}, func(w io.Writer) {
+				fmt.Fprintln(w, "[+] ClipSync daemon started through the service manager.")
+			})
+			return nil
+		}
+		if !errors.Is(err, service.ErrNotInstalled) {
+			out.info("[-] Service manager failed to start ClipSync (%v), starting it directly.", err)
+		}
+	}
+
+	exePath, err := os.Executable()
+	if err != nil {
+		exePath = os.Args[0]
+	}
+
+	args := []string{"daemon"}
+	if opts.Headless {
+		args = append(args, "--headless")
+	}
+	if opts.ClipFile != "" {
+		clipFile, err := filepath.Abs(opts.ClipFile)
+		if err != nil {
+			return usageError{fmt.Sprintf("invalid clip file: %v", err)}
+		}
+		args = append(args, "--clip-file", clipFile)
+	}
+	if opts.LogLevel != "" {
+		if _, err := logging.ParseLevel(opts.LogLevel); err != nil {
+			return usageError{fmt.Sprintf("invalid log level %q", opts.LogLevel)}
+		}
+		args = append(args, "--log-level", opts.LogLevel)
+	}
+	if opts.MetricsAddr != "" {
+		if _, _, err := net.SplitHostPort(opts.MetricsAddr); err != nil {
+			return usageError{fmt.Sprintf("invalid metrics address %q: %v", opts.MetricsAddr, err)}
+		}
+		args = append(args, "--metrics-addr", opts.MetricsAddr)
+	}
+
+	cmd := exec.Command(exePath, args...)
+	cmd.SysProcAttr = detachedProcAttr()
+
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start daemon: %w", err)
+	}
+	pid := cmd.Process.Pid
+	out.result(daemonResult{Status: "started", PID: pid}, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] ClipSync daemon started successfully (PID: %d).\n", pid)
+	})
+	return nil
+}
+
+// RunDaemon runs the sync engine and the IPC server until the daemon is
+// asked to stop.
+func RunDaemon(opts DaemonOptions) error {
+	cfg, cfgErr := config.Load()
+	if opts.LogLevel == "" {
+		opts.LogLevel = cfg.LogLevel
+	}
+	logFile, err := setupLogging(os.Stdout, opts.LogLevel, cfg.LogClips)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	logger := logging.For(logging.Daemon)
+	logger.Info("Starting ClipSync daemon", "pid", os.Getpid())
+	if cfgErr != nil {
+		logger.Warn("Failed to load config, using defaults", logging.Err(cfgErr))
+	}
+	if cfg.Headless {
+		opts.Headless = true
+	}
+	if opts.ClipFile == "" {
+		opts.ClipFile = cfg.ClipFile
+	}
+	if opts.MetricsAddr == "" {
+		opts.MetricsAddr = cfg.MetricsAddr
+	}
+
+	if opts.Headless {
+		clipboard.UseMemory()
+	} else if err := clipboard.Init(); err != nil {
+		logger.Warn("System clipboard unavailable, running headless", logging.Err(err))
+		clipboard.UseMemory()
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	err = core.Run(ctx, core.Options{ClipFile: opts.ClipFile, MetricsAddr: opts.MetricsAddr})
+	if err != nil && err != context.Canceled {
+		logger.Error("Daemon exited with error", logging.Err(err))
+		return err
+	}
+	logger.Info("Daemon stopped")
+	return nil
+}
+
+// setupLogging sends the log to the rotated log file and, if console is
+// not nil, to the console as well.
+func setupLogging(console io.Writer, level string, logClips bool) (io.Closer, error) {
+	l, err := logging.ParseLevel(level)
+	if err != nil {
+		return nil, usageError{fmt.Sprintf("invalid log level %q", level)}
+	}
+	closer, err := logging.Setup(logging.Options{Level: l, Console: console, LogClips: logClips})
+	if err != nil {
+		logging.For(logging.Daemon).Warn("Could not open the log file", logging.Err(err))
+	}
+	return closer, nil
+}
+
+func stopDaemon() error {
+	if err := ipc.Stop(); err != nil {
+		return err
+	}
+	if err := waitForExit(stopTimeout); err != nil {
+		return err
+	}
+	out.result(daemonResult{Status: "stopped"}, func(w io.Writer) {
+		fmt.Fprintln(w, "[+] Daemon stopped successfully.")
+	})
+	return nil
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+
+	"clipsync/internal/config"
+	"clipsync/internal/ipc"
+	"clipsync/internal/network"
+
+	"github.com/spf13/cobra"
+)
+
+func newDevicesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "devices",
+		Aliases: []string{"list-devices"},
+		Short:   "List all discovered devices",
+		Args:    noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listDevices()
+		},
+	}
+
+	revoke := &cobra.Command{
+		Use:   "revoke <id>...",
+		Short: "Cut lost or stolen devices out of the relay group",
+		Long: `Cut devices out of the relay group, by the IDs 'clipsync relay members'
+lists. The group key is rotated and handed to every other member online, and
+they drop the revoked devices too, so those can't read the clips sent after
+this. Members offline now must join again with the new key, which is printed.
+
+Devices on the same LAN are trusted by address and are not affected: remove
+them from the static peers, or take them off the network.`,
+		Args:              minArgs(1, "clipsync devices revoke <id>..."),
+		ValidArgsFunction: completeMembers,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rotateRelay(args)
+		},
+	}
+	cmd.AddCommand(revoke)
+	return cmd
+}
+
+func newConnectCmd() *cobra.Command {
+	var save bool
+	cmd := &cobra.Command{
+		Use:               "connect <host[:port]>",
+		Short:             "Manually connect to a device by address",
+		Long:              "Manually connect to a device by IP or host name. With --save it is also kept as a\nstatic peer, so the connection survives restarts.",
+		Args:              exactArgs(1, "clipsync connect <host[:port]>"),
+		ValidArgsFunction: completeDevices,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if save {
+				if err := savePeer(args[0]); err != nil {
+					return err
+				}
+			}
+			return connectToDevice(args[0])
+		},
+	}
+	cmd.Flags().BoolVar(&save, "save", false, "keep the device as a static peer across restarts")
+	return cmd
+}
+
+// savePeer adds address to the static peers in the config.
+func savePeer(address string) error {
+	if _, _, err := network.ParsePeer(address); err != nil {
+		return usageError{err.Error()}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(cfg.Peers, address) {
+		cfg.Peers = append(cfg.Peers, address)
+		if err := cfg.Save(); err != nil {
+			return err
+		}
+		if err := ipc.ReloadPeers(); err != nil && !errors.Is(err, ipc.ErrDaemonNotRunning) {
+			return err
+		}
+	}
+	out.info("[+] Saved %s as a static peer.", address)
+	return nil
+}
+
+func listDevices() error {
+	devices, err := ipc.Devices()
+	if err != nil {
+		return err
+	}
+
+	out.result(devices, func(w io.Writer) {
+		if len(devices) == 0 {
+			fmt.Fprintln(w, "[*] No devices discovered yet.")
+			return
+		}
+		fmt.Fprintln(w, "[*] Connected Devices:")
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "  #\tNAME\tIP")
+		for i, dev := range devices {
+			fmt.Fprintf(tw, "  %d\t%s\t%s\n", i+1, dev.Name, dev.Ip)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+type connectResult struct {
+	Status string `json:"status" yaml:"status"`
+	IP     string `json:"ip" yaml:"ip"`
+}
+
+func connectToDevice(ip string) error {
+	if err := ipc.Connect(ip); err != nil {
+		return err
+	}
+	out.result(connectResult{Status: "connected", IP: ip}, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] Connected to %s.\n", ip)
+	})
+	return nil
+}
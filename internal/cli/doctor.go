@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"clipsync/internal/doctor"
+
+	"github.com/spf13/cobra"
+)
+
+func newDoctorCmd() *cobra.Command {
+	var bundle string
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check for common problems that stop sync from working",
+		Long: "Check the daemon, ports, network interfaces, mDNS, the clipboard, ping permissions\n" +
+			"and every known peer, and suggest a fix for each problem found.\n\n" +
+			"--bundle also writes a zip with the report, config and logs to attach to a bug\n" +
+			"report. Clip contents and your home directory are redacted from it.",
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runDoctor(bundle)
+		},
+	}
+	cmd.Flags().StringVar(&bundle, "bundle", "", "write a redacted support bundle to this zip file")
+	cmd.RegisterFlagCompletionFunc("bundle", func(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+		return []cobra.Completion{"zip"}, cobra.ShellCompDirectiveFilterFileExt
+	})
+	return cmd
+}
+
+func runDoctor(bundle string) error {
+	out.info("[*] Running checks...")
+	report := doctor.Run(context.Background())
+
+	out.result(report, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, c := range report.Checks {
+			fmt.Fprintf(tw, "%s %s\t%s\n", statusMark(c.Status), c.Name, c.Detail)
+			if c.Hint != "" {
+				fmt.Fprintf(tw, "    \t%s\n", c.Hint)
+			}
+		}
+		tw.Flush()
+	})
+
+	if bundle != "" {
+		f, err := os.OpenFile(bundle, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		if err := doctor.WriteBundle(f, report); err != nil {
+			f.Close()
+			return fmt.Errorf("writing support bundle: %w", err)
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		out.info("[+] Support bundle written to %s", bundle)
+	}
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d check(s) failed", report.Failed)
+	}
+	return nil
+}
+
+func statusMark(s doctor.Status) string {
+	switch s {
+	case doctor.OK:
+		return "[+]"
+	case doctor.Fail:
+		return "[-]"
+	case doctor.Warn:
+		return "[!]"
+	default:
+		return "[*]"
+	}
+}
@@ -0,0 +1,9 @@
+package cli
+
+// Execute runs the command line args and returns the exit code Run would.
+func Execute(args ...string) int {
+	parsed = false
+	root := newRootCmd(false)
+	root.SetArgs(args)
+	return execute(root)
+}
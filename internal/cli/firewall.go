@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"clipsync/internal/firewall"
+	"clipsync/internal/globals"
+
+	"github.com/spf13/cobra"
+)
+
+func newFirewallCmd() *cobra.Command {
+	var backend string
+	cmd := &cobra.Command{
+		Use:   "firewall",
+		Short: "Check or open the ports ClipSync needs in the firewall",
+		Long: fmt.Sprintf(`Check or open the ports ClipSync needs in the firewall: mDNS (UDP 5353) and
+UDP %d for discovery plus the sync and transfer ports.
+
+On Linux ufw, firewalld and nftables are supported; the active one is used
+unless --backend picks another. On Windows the rules are added to Windows
+Defender Firewall with netsh, for the local subnet on private and domain
+networks only, and on macOS ClipSync is allowed through the
+application firewall. Changing the firewall needs administrator rights.
+
+Backends on this system: %s.`, globals.DiscoveryPort, strings.Join(firewall.Backends(), ", ")),
+	}
+	cmd.PersistentFlags().StringVar(&backend, "backend", "", "firewall to use instead of the detected one")
+	cmd.RegisterFlagCompletionFunc("backend", cobra.FixedCompletions(firewall.Backends(), cobra.ShellCompDirectiveNoFileComp))
+
+	check := &cobra.Command{
+		Use:   "check",
+		Short: "Show whether the firewall lets ClipSync through",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkBackend(backend); err != nil {
+				return err
+			}
+			status, err := firewall.Check(backend)
+			if err != nil {
+				return firewallError(err)
+			}
+			out.result(status, func(w io.Writer) {
+				if !status.Active {
+					fmt.Fprintf(w, "[*] %s is not active, nothing is blocked.\n", status.Backend)
+					return
+				}
+				tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+				for _, r := range status.Rules {
+					mark, state := "[+]", "allowed"
+					if !r.Allowed {
+						mark, state = "[-]", "blocked"
+					}
+					fmt.Fprintf(tw, "%s %s\t%s\t%s\n", mark, r.Name, r.Rule, state)
+				}
+				tw.Flush()
+			})
+			for _, r := range status.Rules {
+				if !r.Allowed {
+					return errors.New("some ports are blocked, run 'clipsync firewall allow'")
+				}
+			}
+			return nil
+		},
+	}
+
+	var allowDryRun bool
+	allow := &cobra.Command{
+		Use:   "allow",
+		Short: "Open the ports ClipSync needs",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkBackend(backend); err != nil {
+				return err
+			}
+			plan, err := firewall.AllowPlan(backend)
+			if err != nil {
+				return firewallError(err)
+			}
+			return applyFirewallPlan(plan, allowDryRun, "allowed")
+		},
+	}
+	allow.Flags().BoolVar(&allowDryRun, "dry-run", false, "print the commands without running them")
+
+	var revokeDryRun bool
+	revoke := &cobra.Command{
+		Use:   "revoke",
+		Short: "Remove the rules 'allow' added",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkBackend(backend); err != nil {
+				return err
+			}
+			plan, err := firewall.RevokePlan(backend)
+			if err != nil {
+				return firewallError(err)
+			}
+			return applyFirewallPlan(plan, revokeDryRun, "revoked")
+		},
+	}
+	revoke.Flags().BoolVar(&revokeDryRun, "dry-run", false, "print the commands without running them")
+
+	cmd.AddCommand(check, allow, revoke)
+	return cmd
+}
+
+type firewallResult struct {
+	Status   string     `json:"status" yaml:"status"`
+	Backend  string     `json:"backend" yaml:"backend"`
+	Commands [][]string `json:"commands" yaml:"commands"`
+	Notes    []string   `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// applyFirewallPlan shows the plan and, unless this is a dry run, runs it.
+func applyFirewallPlan(plan *firewall.Plan, dryRun bool, done string) error {
+	result := firewallResult{Status: done, Backend: plan.Backend, Commands: plan.Commands, Notes: plan.Notes}
+	if dryRun {
+		result.Status = "dry_run"
+		out.result(result, func(w io.Writer) { plan.Print(w) })
+		return nil
+	}
+	if !out.quiet && !out.machine() {
+		plan.Print(os.Stdout)
+	}
+	if err := plan.Apply(); err != nil {
+		return firewallError(err)
+	}
+	out.result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] ClipSync ports %s in %s.\n", done, plan.Backend)
+	})
+	return nil
+}
+
+// checkBackend rejects a --backend this platform doesn't support.
+func checkBackend(name string) error {
+	if name == "" || slices.Contains(firewall.Backends(), name) {
+		return nil
+	}
+	return usageError{fmt.Sprintf("unknown firewall %q: want one of %s", name, strings.Join(firewall.Backends(), ", "))}
+}
+
+// firewallError points at the usual cause of a failed firewall command.
+func firewallError(err error) error {
+	if runtime.GOOS != "windows" && os.Geteuid() != 0 && !errors.Is(err, firewall.ErrNoFirewall) {
+		return fmt.Errorf("%w (firewall changes usually need root, try sudo)", err)
+	}
+	return err
+}
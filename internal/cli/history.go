@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"clipsync/internal/ipc"
+
+	"github.com/spf13/cobra"
+)
+
+func newHistoryCmd() *cobra.Command {
+	var limit int
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the clipboard history",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listHistory(limit)
+		},
+	}
+	cmd.Flags().IntVarP(&limit, "limit", "n", 0, "only show the newest n entries")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "copy <id>",
+		Short:             "Put a history entry back on the clipboard",
+		Args:              exactArgs(1, "clipsync history copy <id>"),
+		ValidArgsFunction: completeHistory,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			id, err := strconv.Atoi(args[0])
+			if err != nil {
+				return usageError{fmt.Sprintf("invalid history id %q", args[0])}
+			}
+			return copyHistory(id)
+		},
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "sensitive <id>...",
+		Short: "Keep history entries, such as passwords, from being saved to disk",
+		Long: `Mark history entries sensitive. They stay in the daemon's memory until it
+stops but are never written to the saved history, and are removed from it
+if they were already saved.`,
+		Args:              minArgs(1, "clipsync history sensitive <id>..."),
+		ValidArgsFunction: completeHistory,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return markSensitive(args)
+		},
+	})
+	return cmd
+}
+
+func listHistory(limit int) error {
+	history, err := ipc.History()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(history) > limit {
+		history = history[:limit]
+	}
+
+	out.result(history, func(w io.Writer) {
+		if len(history) == 0 {
+			fmt.Fprintln(w, "[*] Clipboard history is empty.")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTIME\tCONTENT")
+		for _, clip := range history {
+			content := preview(clip.Data, 50)
+			if clip.Pending {
+				// Announced by a peer; copying it fetches the body
+				content += " [not fetched]"
+			}
+			if clip.Sensitive {
+				content += " [sensitive]"
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", clip.ID, clip.Time.Format("15:04:05"), content)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+type copyResult struct {
+	Status string `json:"status" yaml:"status"`
+	ID     int    `json:"id" yaml:"id"`
+}
+
+func copyHistory(id int) error {
+	if err := ipc.CopyHistory(id); err != nil {
+		return err
+	}
+	out.result(copyResult{Status: "copied", ID: id}, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] History entry %d copied to the clipboard.\n", id)
+	})
+	return nil
+}
+
+func markSensitive(args []string) error {
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return usageError{fmt.Sprintf("invalid history id %q", arg)}
+		}
+		if err := ipc.MarkSensitive(id); err != nil {
+			return err
+		}
+		out.result(copyResult{Status: "sensitive", ID: id}, func(w io.Writer) {
+			fmt.Fprintf(w, "[+] History entry %d will not be saved to disk.\n", id)
+		})
+	}
+	return nil
+}
+
+// preview flattens data onto one line and cuts it to at most n runes.
+func preview(data string, n int) string {
+	data = strings.Join(strings.Fields(data), " ")
+	runes := []rune(data)
+	if len(runes) > n {
+		return string(runes[:n-1]) + "…"
+	}
+	return data
+}
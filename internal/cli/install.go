@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"clipsync/internal/install"
+
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+type installFlags struct {
+	opts   install.Options
+	dryRun bool
+	yes    bool
+}
+
+func (f *installFlags) register(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&f.opts.Dir, "dir", "", "install directory (default ~/.local/bin, or %LOCALAPPDATA%\\Programs\\ClipSync on Windows)")
+	cmd.Flags().BoolVar(&f.dryRun, "dry-run", false, "print the changes without making them")
+	cmd.Flags().BoolVarP(&f.yes, "yes", "y", false, "don't ask for confirmation")
+	cmd.MarkFlagDirname("dir")
+}
+
+func newInstallCmd() *cobra.Command {
+	var f installFlags
+	cmd := &cobra.Command{
+		Use:   "install",
+		Short: "Copy clipsync to a standard location and add it to PATH",
+		Long: `Copy clipsync to a standard location and add it to PATH.
+
+The lines added to shell startup files (bash, zsh, .profile, fish and nushell)
+are marked so 'clipsync uninstall' can remove them again. On Windows the user
+PATH is changed instead. The changes are shown before they are made.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := install.InstallPlan(f.opts)
+			if err != nil {
+				return err
+			}
+			return applyInstallPlan(plan, f, "installed")
+		},
+	}
+	f.register(cmd)
+	return cmd
+}
+
+func newUninstallCmd() *cobra.Command {
+	var f installFlags
+	cmd := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove what 'clipsync install' added",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := install.UninstallPlan(f.opts)
+			if err != nil {
+				return err
+			}
+			return applyInstallPlan(plan, f, "uninstalled")
+		},
+	}
+	f.register(cmd)
+	return cmd
+}
+
+type installResult struct {
+	Status string   `json:"status" yaml:"status"`
+	Copy   string   `json:"copy,omitempty" yaml:"copy,omitempty"`
+	Edits  []string `json:"edits,omitempty" yaml:"edits,omitempty"`
+	Remove []string `json:"remove,omitempty" yaml:"remove,omitempty"`
+	Notes  []string `json:"notes,omitempty" yaml:"notes,omitempty"`
+}
+
+// applyInstallPlan shows the plan, asks for confirmation on a terminal
+// and, unless this is a dry run, carries it out.
+func applyInstallPlan(plan *install.Plan, f installFlags, done string) error {
+	result := installResult{Status: done, Remove: plan.Remove, Notes: plan.Notes}
+	if plan.Copy != nil {
+		result.Copy = plan.Copy.To
+	}
+	for _, e := range plan.Edits {
+		result.Edits = append(result.Edits, e.Path)
+	}
+	if plan.UserPath != nil {
+		result.Edits = append(result.Edits, "user PATH")
+	}
+
+	if plan.Empty() {
+		result.Status = "unchanged"
+		out.result(result, func(w io.Writer) {
+			fmt.Fprintf(w, "[*] Nothing to do, ClipSync is already %s.\n", done)
+		})
+		return nil
+	}
+	if f.dryRun {
+		result.Status = "dry_run"
+		out.result(result, func(w io.Writer) { plan.Print(w) })
+		return nil
+	}
+	if !out.quiet && !out.machine() {
+		plan.Print(os.Stdout)
+	}
+	if !f.yes && isatty.IsTerminal(os.Stdin.Fd()) && !out.machine() && !confirm("Apply these changes?") {
+		return fmt.Errorf("aborted, nothing was changed")
+	}
+	if err := plan.Apply(); err != nil {
+		return err
+	}
+	out.result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] ClipSync %s.\n", done)
+	})
+	return nil
+}
+
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+func newLogsCmd() *cobra.Command {
+	q := ipc.LogQuery{}
+	cmd := &cobra.Command{
+		Use:   "logs",
+		Short: "Show the daemon log",
+		Long: "Show the daemon log, oldest first. Clip contents are redacted unless\n" +
+			"log_clips is set in the config file.\n\n" +
+			"Following the log with --level debug makes the daemon write debug records\n" +
+			"for as long as the command runs.",
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := logging.ParseLevel(q.Level); err != nil {
+				return usageError{fmt.Sprintf("invalid log level %q: want debug, info, warn or error", q.Level)}
+			}
+			if q.Subsystem != "" && !slices.Contains(logging.Subsystems, q.Subsystem) {
+				return usageError{fmt.Sprintf("unknown subsystem %q: want one of %s", q.Subsystem, strings.Join(logging.Subsystems, ", "))}
+			}
+			return showLogs(q)
+		},
+	}
+	cmd.Flags().BoolVarP(&q.Follow, "follow", "f", false, "keep printing new lines as they are logged")
+	cmd.Flags().IntVarP(&q.Lines, "lines", "n", 50, "number of past lines to show")
+	cmd.Flags().StringVar(&q.Level, "level", "", "minimum level: debug, info, warn or error (default info)")
+	cmd.Flags().StringVar(&q.Subsystem, "subsystem", "", "only show one subsystem: "+strings.Join(logging.Subsystems, ", "))
+	cmd.RegisterFlagCompletionFunc("level", completeLevels)
+	cmd.RegisterFlagCompletionFunc("subsystem", cobra.FixedCompletions(logging.Subsystems, cobra.ShellCompDirectiveNoFileComp))
+	quietBanner(cmd)
+	return cmd
+}
+
+func showLogs(q ipc.LogQuery) error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return ipc.Logs(ctx, q, func(line []byte) error {
+		return printLogLine(os.Stdout, line)
+	})
+}
+
+// printLogLine writes one JSON log record in the selected format.
+func printLogLine(w io.Writer, line []byte) error {
+	if out.format == formatJSON {
+		_, err := fmt.Fprintf(w, "%s\n", line)
+		return err
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return nil
+	}
+	if out.format == formatYAML {
+		fmt.Fprintln(w, "---")
+		return yaml.NewEncoder(w).Encode(rec)
+	}
+
+	ts, _ := time.Parse(time.RFC3339Nano, fmt.Sprint(rec["time"]))
+	b := fmt.Appendf(nil, "%s %-5v", ts.Local().Format("2006-01-02 15:04:05"), rec["level"])
+	if sub, ok := rec["subsystem"]; ok {
+		b = fmt.Appendf(b, " [%v]", sub)
+	}
+	b = fmt.Appendf(b, " %v", rec["msg"])
+	delete(rec, "time")
+	delete(rec, "level")
+	delete(rec, "subsystem")
+	delete(rec, "msg")
+	keys := make([]string, 0, len(rec))
+	for k := range rec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b = fmt.Appendf(b, " %s=%v", k, rec[k])
+	}
+	_, err := fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+// completeLevels offers the log levels.
+func completeLevels(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	return []cobra.Completion{"debug", "info", "warn", "error"}, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,282 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"clipsync/internal/config"
+	"clipsync/internal/trust"
+
+	"github.com/spf13/cobra"
+)
+
+func newNetworksCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "networks",
+		Short: "Show the current network and manage trusted networks",
+		Long: `Show the current network and manage trusted networks.
+
+Once any network is trusted, ClipSync only syncs, discovers and advertises on
+trusted networks, and pauses everywhere else, e.g. in airports and hotels.
+A network is recognised by its Wi-Fi name (SSID), the MAC address of its
+gateway, a subnet or an interface. Changes apply within a few seconds.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return showNetwork(cmd.Context())
+		},
+	}
+
+	list := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the trusted networks",
+		Args:    noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listNetworks()
+		},
+	}
+
+	var by string
+	add := &cobra.Command{
+		Use:   "trust <name>",
+		Short: "Trust the network this machine is on",
+		Long: `Trust the network this machine is on, under the given name. By default it is
+recognised by its SSID, or by its gateway's MAC address when there is no
+Wi-Fi; --by picks what to use, e.g. --by ssid,subnet.`,
+		Args: exactArgs(1, "clipsync networks trust <name> [--by ssid|gateway|subnet|interface,...]"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return trustNetwork(cmd.Context(), args[0], by)
+		},
+	}
+	add.Flags().StringVar(&by, "by", "", "what to recognise the network by: ssid, gateway, subnet, interface")
+	add.RegisterFlagCompletionFunc("by", cobra.FixedCompletions([]string{"ssid", "gateway", "subnet", "interface"}, cobra.ShellCompDirectiveNoFileComp))
+
+	remove := &cobra.Command{
+		Use:               "remove <name>",
+		Aliases:           []string{"rm"},
+		Short:             "Stop trusting a network",
+		Args:              exactArgs(1, "clipsync networks remove <name>"),
+		ValidArgsFunction: completeNetworks,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return removeNetwork(args[0])
+		},
+	}
+
+	cmd.AddCommand(list, add, remove)
+	return cmd
+}
+
+type networkResult struct {
+	trust.Network `yaml:",inline"`
+	Trusted       bool   `json:"trusted" yaml:"trusted"`
+	Profile       string `json:"profile,omitempty" yaml:"profile,omitempty"`
+	// SyncsOn is the interfaces on a trusted network, which discovery is
+	// limited to.
+	SyncsOn []string `json:"syncs_on,omitempty" yaml:"syncs_on,omitempty"`
+}
+
+func showNetwork(ctx context.Context) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	res := networkResult{Network: trust.Detect(ctx), Trusted: true}
+	if len(cfg.TrustedNetworks) > 0 {
+		res.SyncsOn = trust.TrustedInterfaces(cfg.TrustedNetworks, res.Network)
+		res.Trusted = len(res.SyncsOn) > 0
+		if p, ok := trust.Match(cfg.TrustedNetworks, res.Network); ok && res.Trusted {
+			res.Profile = p.Name
+		}
+	}
+
+	out.result(res, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		var gateways []string
+		for _, g := range res.Gateways {
+			gateways = append(gateways, strings.TrimSpace(g.IP+" "+g.MAC))
+		}
+		fmt.Fprintf(tw, "SSID\t%s\n", orDash(res.SSIDs))
+		fmt.Fprintf(tw, "GATEWAY\t%s\n", orDash(gateways))
+		fmt.Fprintf(tw, "SUBNETS\t%s\n", orDash(res.Subnets))
+		fmt.Fprintf(tw, "INTERFACES\t%s\n", orDash(res.Interfaces))
+		tw.Flush()
+		switch {
+		case len(cfg.TrustedNetworks) == 0:
+			fmt.Fprintln(w, "[*] No trusted networks are set, so ClipSync syncs everywhere.")
+		case res.Trusted:
+			fmt.Fprintf(w, "[+] Trusted network %q, discovery runs on %s.\n", res.Profile, strings.Join(res.SyncsOn, ", "))
+		default:
+			fmt.Fprintln(w, "[!] Untrusted network, sync is paused. Trust it with 'clipsync networks trust <name>'.")
+		}
+	})
+	return nil
+}
+
+func orDash(s []string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, ", ")
+}
+
+func listNetworks() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	profiles := cfg.TrustedNetworks
+	if profiles == nil {
+		profiles = []config.NetworkProfile{}
+	}
+	out.result(profiles, func(w io.Writer) {
+		if len(profiles) == 0 {
+			fmt.Fprintln(w, "[*] No trusted networks, ClipSync syncs on every network.")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tSSID\tGATEWAY MAC\tSUBNET\tINTERFACE")
+		for _, p := range profiles {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", p.Name, dash(p.SSID), dash(p.GatewayMAC), dash(p.Subnet), dash(p.Interface))
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// trustNetwork saves the current network as a trusted profile.
+func trustNetwork(ctx context.Context, name, by string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(cfg.TrustedNetworks, func(p config.NetworkProfile) bool { return p.Name == name }) {
+		return usageError{fmt.Sprintf("a trusted network named %q exists already", name)}
+	}
+
+	n := trust.Detect(ctx)
+	var gatewayMAC string
+	for _, g := range n.Gateways {
+		if g.MAC != "" {
+			gatewayMAC = g.MAC
+			break
+		}
+	}
+	if by == "" {
+		switch {
+		case len(n.SSIDs) > 0:
+			by = "ssid"
+		case gatewayMAC != "":
+			by = "gateway"
+		default:
+			by = "subnet"
+		}
+	}
+
+	p := config.NetworkProfile{Name: name}
+	for _, key := range strings.Split(by, ",") {
+		var missing bool
+		switch strings.TrimSpace(key) {
+		case "ssid":
+			missing = len(n.SSIDs) == 0
+			if !missing {
+				p.SSID = n.SSIDs[0]
+			}
+		case "gateway":
+			p.GatewayMAC, missing = gatewayMAC, gatewayMAC == ""
+		case "subnet":
+			missing = len(n.Subnets) == 0
+			if !missing {
+				p.Subnet = subnetOf(n.Subnets[0])
+			}
+		case "interface":
+			missing = len(n.Interfaces) == 0
+			if !missing {
+				p.Interface = n.Interfaces[0]
+			}
+		default:
+			return usageError{fmt.Sprintf("unknown --by %q: want ssid, gateway, subnet or interface", key)}
+		}
+		if missing {
+			return fmt.Errorf("could not detect the %s of this network, pick another with --by", key)
+		}
+	}
+
+	cfg.TrustedNetworks = append(cfg.TrustedNetworks, p)
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	out.result(p, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] Trusted %q (%s).\n", name, describeProfile(p))
+		if len(cfg.TrustedNetworks) == 1 {
+			fmt.Fprintln(w, "[*] ClipSync now pauses on every other network.")
+		}
+	})
+	return nil
+}
+
+// subnetOf turns an address with prefix, 192.168.1.23/24, into the subnet
+// it is on, 192.168.1.0/24.
+func subnetOf(cidr string) string {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return cidr
+	}
+	return n.String()
+}
+
+func describeProfile(p config.NetworkProfile) string {
+	var parts []string
+	for _, kv := range [][2]string{{"SSID", p.SSID}, {"gateway", p.GatewayMAC}, {"subnet", p.Subnet}, {"interface", p.Interface}} {
+		if kv[1] != "" {
+			parts = append(parts, kv[0]+" "+kv[1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func removeNetwork(name string) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	n := len(cfg.TrustedNetworks)
+	cfg.TrustedNetworks = slices.DeleteFunc(cfg.TrustedNetworks, func(p config.NetworkProfile) bool { return p.Name == name })
+	if len(cfg.TrustedNetworks) == n {
+		return usageError{fmt.Sprintf("no trusted network named %q", name)}
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	out.result(map[string]string{"status": "removed", "name": name}, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] No longer trusting %q.\n", name)
+		if len(cfg.TrustedNetworks) == 0 {
+			fmt.Fprintln(w, "[*] No trusted networks left, ClipSync syncs on every network again.")
+		}
+	})
+	return nil
+}
+
+// completeNetworks offers the names of the trusted networks.
+func completeNetworks(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil || len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var names []cobra.Completion
+	for _, p := range cfg.TrustedNetworks {
+		names = append(names, p.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,129 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"clipsync/internal/instance"
+	"clipsync/internal/ipc"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Exit codes returned by the CLI so scripts can tell failures apart.
+const (
+	exitOK               = 0
+	exitFailure          = 1
+	exitUsage            = 2
+	exitDaemonNotRunning = 3
+	exitPeerUnreachable  = 4
+	exitAlreadyRunning   = 5
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatYAML  = "yaml"
+)
+
+// output holds the global presentation flags shared by every command.
+type output struct {
+	format string
+	quiet  bool
+}
+
+var out = output{format: formatTable}
+
+// validate rejects unknown output formats.
+func (o *output) validate() error {
+	switch o.format {
+	case formatJSON, formatYAML, formatTable:
+		return nil
+	}
+	bad := o.format
+	o.format = formatTable
+	return usageError{fmt.Sprintf("unknown output format %q: want json, yaml or table", bad)}
+}
+
+// machine reports whether output is meant for another program.
+func (o output) machine() bool {
+	return o.format != formatTable
+}
+
+// info prints a human readable progress line. It is dropped in quiet and
+// machine readable modes so stdout only carries the result.
+func (o output) info(format string, a ...any) {
+	if o.quiet || o.machine() {
+		return
+	}
+	fmt.Printf(format+"\n", a...)
+}
+
+// result prints v in the selected format. table renders the human form.
+func (o output) result(v any, table func(w io.Writer)) {
+	switch o.format {
+	case formatJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+	case formatYAML:
+		enc := yaml.NewEncoder(os.Stdout)
+		enc.SetIndent(2)
+		enc.Encode(v)
+		enc.Close()
+	default:
+		table(os.Stdout)
+	}
+}
+
+// fail reports err on stderr and returns the exit code for its class.
+func (o output) fail(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	code := exitCode(err)
+	switch o.format {
+	case formatJSON:
+		json.NewEncoder(os.Stderr).Encode(errorResult{Error: err.Error(), Code: code})
+	case formatYAML:
+		yaml.NewEncoder(os.Stderr).Encode(errorResult{Error: err.Error(), Code: code})
+	default:
+		msg := err.Error()
+		if errors.Is(err, ipc.ErrDaemonNotRunning) {
+			msg += " (Try 'clipsync start')"
+		}
+		fmt.Fprintf(os.Stderr, "[-] %s\n", msg)
+	}
+	return code
+}
+
+type errorResult struct {
+	Error string `json:"error" yaml:"error"`
+	Code  int    `json:"exit_code" yaml:"exit_code"`
+}
+
+// usageError marks a problem with the command line itself.
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func exitCode(err error) int {
+	var usage usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(err, &usage), errors.Is(err, ipc.ErrBadRequest):
+		return exitUsage
+	case errors.Is(err, instance.ErrRunning):
+		return exitAlreadyRunning
+	case errors.Is(err, ipc.ErrDaemonNotRunning):
+		return exitDaemonNotRunning
+	case errors.Is(err, ipc.ErrPeerUnreachable):
+		return exitPeerUnreachable
+	default:
+		return exitFailure
+	}
+}
@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"clipsync/internal/config"
+	"clipsync/internal/ipc"
+	"clipsync/internal/network"
+
+	"github.com/spf13/cobra"
+)
+
+func newPeersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peers",
+		Short: "Manage static peers for networks where discovery does not work",
+		Long: `Manage static peers: devices that are dialled directly by address instead of
+being discovered through mDNS, for corporate Wi-Fi, VPNs or Docker bridges.
+
+Peers are host[:port] entries saved in the config file. Host names are
+re-resolved every minute, and static peers are never dropped for not
+answering ping.`,
+	}
+
+	list := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the static peers",
+		Args:    noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listPeers()
+		},
+	}
+	add := &cobra.Command{
+		Use:   "add <host[:port]>...",
+		Short: "Add static peers and connect to them",
+		Args:  minArgs(1, "clipsync peers add <host[:port]>..."),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editPeers(args, true)
+		},
+	}
+	remove := &cobra.Command{
+		Use:               "remove <host[:port]>...",
+		Aliases:           []string{"rm"},
+		Short:             "Remove static peers",
+		Args:              minArgs(1, "clipsync peers remove <host[:port]>..."),
+		ValidArgsFunction: completePeers,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return editPeers(args, false)
+		},
+	}
+	cmd.AddCommand(list, add, remove)
+	return cmd
+}
+
+// minArgs is cobra.MinimumNArgs reporting a usage error.
+func minArgs(n int, usage string) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if len(args) < n {
+			return usageError{fmt.Sprintf("%s expects at least %d argument(s). Usage: %s", cmd.CommandPath(), n, usage)}
+		}
+		return nil
+	}
+}
+
+// listPeers shows what the daemon resolved the peers to, or just the
+// configured list when it is not running.
+func listPeers() error {
+	peers, err := ipc.StaticPeers()
+	if errors.Is(err, ipc.ErrDaemonNotRunning) {
+		cfg, cfgErr := config.Load()
+		if cfgErr != nil {
+			return cfgErr
+		}
+		peers = []network.StaticPeer{}
+		for _, a := range cfg.Peers {
+			peers = append(peers, network.StaticPeer{Address: a})
+		}
+	} else if err != nil {
+		return err
+	}
+
+	out.result(peers, func(w io.Writer) {
+		if len(peers) == 0 {
+			fmt.Fprintln(w, "[*] No static peers. Add one with 'clipsync peers add <host[:port]>'.")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ADDRESS\tRESOLVED")
+		for _, p := range peers {
+			resolved := strings.Join(p.IPs, ", ")
+			switch {
+			case p.Error != "":
+				resolved = "error: " + p.Error
+			case resolved == "":
+				resolved = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\n", p.Address, resolved)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+type peersResult struct {
+	Status string   `json:"status" yaml:"status"`
+	Peers  []string `json:"peers" yaml:"peers"`
+}
+
+// editPeers adds or removes addresses in the config and tells a running
+// daemon to pick up the change.
+func editPeers(addresses []string, add bool) error {
+	for _, a := range addresses {
+		if _, _, err := network.ParsePeer(a); err != nil {
+			return usageError{err.Error()}
+		}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+
+	var changed []string
+	for _, a := range addresses {
+		has := slices.Contains(cfg.Peers, a)
+		switch {
+		case add && !has:
+			cfg.Peers = append(cfg.Peers, a)
+			changed = append(changed, a)
+		case !add && has:
+			cfg.Peers = slices.DeleteFunc(cfg.Peers, func(p string) bool { return p == a })
+			changed = append(changed, a)
+		case !add:
+			return usageError{fmt.Sprintf("%s is not a static peer", a)}
+		}
+	}
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	if err := ipc.ReloadPeers(); err != nil && !errors.Is(err, ipc.ErrDaemonNotRunning) {
+		return err
+	}
+
+	status, verb := "added", "Added"
+	if !add {
+		status, verb = "removed", "Removed"
+	}
+	out.result(peersResult{Status: status, Peers: changed}, func(w io.Writer) {
+		if len(changed) == 0 {
+			fmt.Fprintln(w, "[*] Already a static peer, nothing changed.")
+			return
+		}
+		fmt.Fprintf(w, "[+] %s %s.\n", verb, strings.Join(changed, ", "))
+	})
+	return nil
+}
+
+// completePeers offers the configured static peers.
+func completePeers(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []cobra.Completion
+	for _, p := range cfg.Peers {
+		if !slices.Contains(args, p) {
+			completions = append(completions, p)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,8 @@
+package cli
+
+import "syscall"
+
+// detachedProcAttr starts the daemon without a console window.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: 0x08000000} // CREATE_NO_WINDOW
+}
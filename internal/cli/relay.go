@@ -0,0 +1,292 @@
+package cli
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"clipsync/internal/config"
+	"clipsync/internal/ipc"
+	"clipsync/internal/relay"
+
+	"github.com/spf13/cobra"
+)
+
+func newRelayCmd() *cobra.Command {
+	var listen, certFile, keyFile, level string
+	limits := relay.DefaultLimits
+	cmd := &cobra.Command{
+		Use:   "relay",
+		Short: "Run a relay that syncs devices across subnets and VPNs",
+		Long: `Run a relay: a hub that devices on other subnets, VLANs or VPNs connect to
+over TLS when mDNS and direct UDP can't reach each other.
+
+Clips are encrypted on the devices with their group key, so the relay only
+forwards them between members of the same group and can't read them. Without
+--cert and --key the relay uses a self-signed certificate, which devices pin
+by the fingerprint printed on start.
+
+Point devices at the relay with 'clipsync relay join'.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runRelay(listen, certFile, keyFile, level, limits)
+		},
+	}
+	cmd.Flags().StringVar(&listen, "listen", ":"+strconv.Itoa(relay.DefaultPort), "address to accept devices on")
+	cmd.Flags().StringVar(&certFile, "cert", "", "TLS certificate file (PEM)")
+	cmd.Flags().StringVar(&keyFile, "key", "", "TLS private key file (PEM)")
+	cmd.Flags().StringVar(&level, "log-level", "", "minimum level to log: debug, info, warn or error")
+	cmd.Flags().IntVar(&limits.Conns, "max-conns", limits.Conns, "most connections served at once, 0 for no limit")
+	cmd.Flags().IntVar(&limits.ConnsPerHost, "max-conns-per-host", limits.ConnsPerHost, "most connections from one address, 0 for no limit")
+	cmd.Flags().IntVar(&limits.Members, "max-members", limits.Members, "most devices in one group, 0 for no limit")
+	cmd.Flags().IntVar(&limits.GroupRate, "group-rate", limits.GroupRate, "bytes per second one group may send, 0 for no limit")
+	cmd.RegisterFlagCompletionFunc("log-level", completeLevels)
+	quietBanner(cmd)
+
+	key := &cobra.Command{
+		Use:   "key",
+		Short: "Generate a new group key",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			k := relay.NewKey()
+			out.result(map[string]string{"group_key": k}, func(w io.Writer) {
+				fmt.Fprintln(w, k)
+			})
+			return nil
+		},
+	}
+	quietBanner(key)
+
+	var groupKey, fingerprint string
+	join := &cobra.Command{
+		Use:   "join <host[:port]>",
+		Short: "Sync this device through a relay",
+		Long: `Sync this device through a relay. All devices of a group use the same group
+key; without --key the configured one is kept, or a new one is generated for
+you to pass to the other devices.`,
+		Args: exactArgs(1, "clipsync relay join <host[:port]> [--key <group key>] [--fingerprint <sha256>]"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return joinRelay(args[0], groupKey, fingerprint)
+		},
+	}
+	join.Flags().StringVar(&groupKey, "key", "", "the group key shared by your devices")
+	join.Flags().StringVar(&fingerprint, "fingerprint", "", "SHA-256 fingerprint of a self-signed relay certificate")
+
+	leave := &cobra.Command{
+		Use:   "leave",
+		Short: "Stop syncing through the relay",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return leaveRelay()
+		},
+	}
+
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Replace the group key without pairing again",
+		Long: `Replace the group key with a new one, handed to every member of the group
+online through the relay. Members offline now must join again with the new
+key, which is printed. To also cut devices out of the group, use
+'clipsync devices revoke'.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return rotateRelay(nil)
+		},
+	}
+
+	members := &cobra.Command{
+		Use:   "members",
+		Short: "List the devices of the relay group",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listMembers()
+		},
+	}
+
+	cmd.AddCommand(key, join, leave, rotate, members)
+	return cmd
+}
+
+// runRelay serves as the hub in the foreground until interrupted.
+func runRelay(listen, certFile, keyFile, level string, limits relay.Limits) error {
+	if (certFile == "") != (keyFile == "") {
+		return usageError{"--cert and --key must be given together"}
+	}
+	logFile, err := setupLogging(os.Stderr, level, false)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+
+	cert, err := relay.LoadCertificate(certFile, keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load the relay certificate: %w", err)
+	}
+	ln, err := tls.Listen("tcp", listen, relay.ServerTLS(cert))
+	if err != nil {
+		return err
+	}
+	out.info("[*] Relay listening on %s", ln.Addr())
+	if certFile == "" {
+		out.info("[*] Certificate fingerprint: %s", relay.Fingerprint(cert))
+		out.info("[*] Join with: clipsync relay join <this host> --fingerprint %s --key <group key>", relay.Fingerprint(cert))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	server := relay.NewServer()
+	server.Limits = limits
+	return server.Serve(ctx, ln)
+}
+
+type relayResult struct {
+	Status   string `json:"status" yaml:"status"`
+	Relay    string `json:"relay,omitempty" yaml:"relay,omitempty"`
+	GroupKey string `json:"group_key,omitempty" yaml:"group_key,omitempty"`
+}
+
+func joinRelay(addr, groupKey, fingerprint string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "" {
+		return usageError{fmt.Sprintf("invalid relay address %q", addr)}
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	generated := false
+	switch {
+	case groupKey != "":
+	case cfg.GroupKey != "":
+		groupKey = cfg.GroupKey
+	default:
+		groupKey = relay.NewKey()
+		generated = true
+	}
+	if _, err := relay.NewGroup(groupKey); err != nil {
+		return usageError{err.Error()}
+	}
+
+	cfg.Relay, cfg.GroupKey, cfg.RelayFingerprint = addr, groupKey, fingerprint
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+
+	res := relayResult{Status: "joined", Relay: addr}
+	if generated {
+		res.GroupKey = groupKey
+	}
+	out.result(res, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] This device now syncs through %s.\n", addr)
+		if generated {
+			fmt.Fprintf(w, "[*] New group key, join your other devices with --key %s\n", groupKey)
+		}
+		if ipc.IsRunning() {
+			fmt.Fprintln(w, "[*] Restart the daemon with 'clipsync restart' to connect.")
+		}
+	})
+	return nil
+}
+
+func leaveRelay() error {
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	if cfg.Relay == "" {
+		return usageError{"not syncing through a relay"}
+	}
+	addr := cfg.Relay
+	cfg.Relay, cfg.RelayFingerprint = "", ""
+	if err := cfg.Save(); err != nil {
+		return err
+	}
+	out.result(relayResult{Status: "left", Relay: addr}, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] No longer syncing through %s. The group key is kept for rejoining.\n", addr)
+		if ipc.IsRunning() {
+			fmt.Fprintln(w, "[*] Restart the daemon with 'clipsync restart' to disconnect.")
+		}
+	})
+	return nil
+}
+
+type rotateResult struct {
+	Status   string   `json:"status" yaml:"status"`
+	Revoked  []string `json:"revoked,omitempty" yaml:"revoked,omitempty"`
+	GroupKey string   `json:"group_key" yaml:"group_key"`
+}
+
+// rotateRelay has the daemon rotate the group key, revoking the members
+// with the IDs in revoke.
+func rotateRelay(revoke []string) error {
+	key, err := ipc.RotateRelay(revoke)
+	if err != nil {
+		return err
+	}
+	res := rotateResult{Status: "rotated", Revoked: revoke, GroupKey: key}
+	if len(revoke) > 0 {
+		res.Status = "revoked"
+	}
+	out.result(res, func(w io.Writer) {
+		for _, id := range revoke {
+			fmt.Fprintf(w, "[+] Revoked %s.\n", id)
+		}
+		fmt.Fprintln(w, "[+] Rotated the group key and sent it to the members online.")
+		fmt.Fprintf(w, "[*] Members offline now, and new devices, join with --key %s\n", key)
+	})
+	return nil
+}
+
+func listMembers() error {
+	members, err := ipc.RelayMembers()
+	if err != nil {
+		return err
+	}
+	out.result(members, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tLAST SEEN\tSTATUS")
+		for _, m := range members {
+			seen, status := "-", "member"
+			if !m.Seen.IsZero() {
+				seen = m.Seen.Local().Format(time.DateTime)
+			}
+			switch {
+			case m.Self:
+				status = "this device"
+			case m.Revoked:
+				status = "revoked"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", m.ID, m.Name, seen, status)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+// completeMembers offers the IDs of the relay group members that can be
+// revoked, described by their names.
+func completeMembers(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	members, err := ipc.RelayMembers()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []cobra.Completion
+	for _, m := range members {
+		if !m.Self && !m.Revoked && !slices.Contains(args, m.ID) {
+			completions = append(completions, cobra.CompletionWithDesc(m.ID, m.Name))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"clipsync/internal/ipc"
+	"clipsync/internal/service"
+
+	"github.com/spf13/cobra"
+)
+
+func newServiceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "service",
+		Short: "Start ClipSync at login through the system service manager",
+		Long: `Start ClipSync at login through the system service manager.
+
+On Linux this is a systemd user unit (or an XDG autostart entry for the GUI),
+on macOS a launchd agent and on Windows a scheduled task. The daemon is
+restarted if it fails.`,
+	}
+
+	var opts service.Options
+	var headless, dryRun bool
+	install := &cobra.Command{
+		Use:   "install",
+		Short: "Register ClipSync with the service manager",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.IPCPort = ipc.PORT
+			if headless {
+				opts.DaemonArgs = append(opts.DaemonArgs, "--headless")
+			}
+			plan, err := service.InstallPlan(opts)
+			if err != nil {
+				return err
+			}
+			return applyPlan(plan, dryRun, "installed")
+		},
+	}
+	install.Flags().BoolVar(&opts.GUI, "gui", false, "start the GUI at login instead of the background daemon")
+	install.Flags().BoolVar(&opts.SocketActivation, "socket", false, "let systemd start the daemon on first use of the IPC socket")
+	install.Flags().BoolVar(&headless, "headless", false, "run the daemon without the system clipboard")
+	install.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes without making them")
+
+	var uninstallDryRun bool
+	uninstall := &cobra.Command{
+		Use:   "uninstall",
+		Short: "Remove ClipSync from the service manager",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			plan, err := service.UninstallPlan()
+			if err != nil {
+				return err
+			}
+			return applyPlan(plan, uninstallDryRun, "uninstalled")
+		},
+	}
+	uninstall.Flags().BoolVar(&uninstallDryRun, "dry-run", false, "print the changes without making them")
+
+	status := &cobra.Command{
+		Use:   "status",
+		Short: "Show whether ClipSync is registered and running",
+		Args:  noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := service.Query()
+			if err != nil {
+				return err
+			}
+			out.result(status, func(w io.Writer) {
+				if !status.Installed {
+					fmt.Fprintf(w, "[*] Not installed with %s. Run 'clipsync service install'.\n", status.Manager)
+					return
+				}
+				state := "stopped"
+				if status.Running {
+					state = "running"
+				}
+				fmt.Fprintf(w, "[+] Installed with %s (%s).\n", status.Manager, state)
+				for _, f := range status.Files {
+					fmt.Fprintf(w, "    %s\n", f)
+				}
+			})
+			return nil
+		},
+	}
+
+	cmd.AddCommand(install, uninstall, status)
+	return cmd
+}
+
+type planResult struct {
+	Status   string     `json:"status" yaml:"status"`
+	Files    []string   `json:"files,omitempty" yaml:"files,omitempty"`
+	Remove   []string   `json:"remove,omitempty" yaml:"remove,omitempty"`
+	Commands [][]string `json:"commands,omitempty" yaml:"commands,omitempty"`
+}
+
+// applyPlan shows the plan and, unless this is a dry run, carries it out.
+func applyPlan(plan *service.Plan, dryRun bool, done string) error {
+	result := planResult{Status: done, Remove: plan.Remove}
+	for _, f := range plan.Files {
+		result.Files = append(result.Files, f.Path)
+	}
+	result.Commands = append(append(result.Commands, plan.Commands...), plan.Cleanup...)
+
+	if dryRun {
+		result.Status = "dry_run"
+		out.result(result, func(w io.Writer) { plan.Print(w) })
+		return nil
+	}
+	if !out.quiet && !out.machine() {
+		plan.Print(os.Stdout)
+	}
+	if err := plan.Apply(); err != nil {
+		return err
+	}
+	out.result(result, func(w io.Writer) {
+		fmt.Fprintf(w, "[+] ClipSync service %s.\n", done)
+	})
+	return nil
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"clipsync/internal/events"
+	"clipsync/internal/globals"
+	"clipsync/internal/ipc"
+
+	"github.com/spf13/cobra"
+)
+
+func newTransfersCmd() *cobra.Command {
+	var follow bool
+
+	cmd := &cobra.Command{
+		Use:   "transfers",
+		Short: "Show large clips and files moving between devices",
+		Long: `Show the running and recently finished transfers: large clips and copied
+files fetched from or by other devices, with their progress and speed.
+
+With --follow, progress updates are printed as they happen until interrupted.`,
+		Args: noArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if follow {
+				return followTransfers()
+			}
+			return listTransfers()
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "print progress updates as they happen")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:               "cancel <id>...",
+		Short:             "Cancel running transfers",
+		Args:              minArgs(1, "clipsync transfers cancel <id>..."),
+		ValidArgsFunction: completeTransfers,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cancelTransfers(args)
+		},
+	})
+	return cmd
+}
+
+func listTransfers() error {
+	transfers, err := ipc.Transfers()
+	if err != nil {
+		return err
+	}
+	out.result(transfers, func(w io.Writer) {
+		if len(transfers) == 0 {
+			fmt.Fprintln(w, "[*] No transfers.")
+			return
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tDIR\tPEER\tWHAT\tPROGRESS\tSPEED\tSTATE")
+		for _, t := range transfers {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s/s\t%s\n", t.ID, t.Direction, t.Peer, t.Name, progress(t), formatBytes(int64(t.Speed)), transferState(t))
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+// followTransfers prints every transfer update until interrupted.
+func followTransfers() error {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	stream, err := ipc.Events(ctx)
+	if err != nil {
+		return err
+	}
+	for e := range stream {
+		if e.Type != events.TransferUpdated || e.Transfer == nil {
+			continue
+		}
+		t := *e.Transfer
+		out.result(t, func(w io.Writer) {
+			fmt.Fprintf(w, "[*] %s %s %s %s: %s, %s/s, %s\n", t.ID, t.Direction, t.Peer, t.Name, progress(t), formatBytes(int64(t.Speed)), transferState(t))
+		})
+	}
+	return nil
+}
+
+type cancelResult struct {
+	Status string `json:"status" yaml:"status"`
+	ID     string `json:"id" yaml:"id"`
+}
+
+func cancelTransfers(ids []string) error {
+	for _, id := range ids {
+		if err := ipc.CancelTransfer(id); err != nil {
+			return err
+		}
+		out.result(cancelResult{Status: "canceled", ID: id}, func(w io.Writer) {
+			fmt.Fprintf(w, "[+] Transfer %s canceled.\n", id)
+		})
+	}
+	return nil
+}
+
+// progress shows how much of a transfer is done.
+func progress(t globals.Transfer) string {
+	if t.Size <= 0 {
+		return formatBytes(t.Done)
+	}
+	return fmt.Sprintf("%s/%s (%d%%)", formatBytes(t.Done), formatBytes(t.Size), t.Done*100/t.Size)
+}
+
+func transferState(t globals.Transfer) string {
+	if t.Error != "" {
+		return t.State + ": " + t.Error
+	}
+	return t.State
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func completeTransfers(cmd *cobra.Command, args []string, toComplete string) ([]cobra.Completion, cobra.ShellCompDirective) {
+	transfers, err := ipc.Transfers()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var completions []cobra.Completion
+	for _, t := range transfers {
+		if t.State == globals.TransferRunning {
+			completions = append(completions, cobra.CompletionWithDesc(t.ID, t.Name+" "+t.Direction+" "+t.Peer))
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
@@ -1,39 +1,119 @@
 package clipboard
 
 import (
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
 	"clipsync/internal/network"
 	"context"
-	"log"
 	"slices"
-	// "sync"
-	"golang.design/x/clipboard"
-	// "clipsync/internal/network"
+	"sync"
 )
 
-func Init() {	
-	err := clipboard.Init()
-	if err != nil {
-		log.Println(err)
-	}
+var logger = logging.For(logging.Clipboard)
+
+// Backend is where clipboard contents are read from and written to.
+// The system backend talks to the OS clipboard; headless machines use an
+// in-memory one instead.
+type Backend interface {
+	Read() []byte
+	Write(data []byte)
+	Watch(ctx context.Context) <-chan []byte
+}
+
+// LazyBackend is a backend that can hold a clip whose body is only
+// fetched when it is pasted.
+type LazyBackend interface {
+	Backend
+	WriteLazy(fetch func() []byte)
+}
+
+var backend Backend = &systemBackend{}
+
+var (
+	sensitiveMu sync.Mutex
+	// sensitive is the last clip written with WriteSensitive.
+	sensitive []byte
+)
+
+// Init prepares the system clipboard. It returns an error when there is no
+// clipboard to talk to, e.g. on a server without X11 or Wayland.
+func Init() error {
+	return initSystem()
+}
+
+// UseBackend swaps the clipboard the engine reads and writes.
+func UseBackend(b Backend) {
+	backend = b
+}
+
+// UseMemory switches to an in-memory clipboard for headless operation.
+func UseMemory() {
+	logger.Info("Using an in-memory clipboard")
+	UseBackend(NewMemory())
+}
+
+// Headless reports whether the engine is running without the system clipboard.
+func Headless() bool {
+	_, ok := backend.(*systemBackend)
+	return !ok
 }
 
 func CopyClipboard() string {
-	data := clipboard.Read(clipboard.FmtText)
+	data := backend.Read()
 	return string(data)
 }
 
 func WriteClipboard(data string) {
 	byte := []byte(data)
-	clipboard.Write(clipboard.FmtText, byte)
-	
+	backend.Write(byte)
+	metrics.ClipboardWrites.Inc()
 }
 
-func WatchClipboard(ctx context.Context) []byte{
-	text := clipboard.Watch(ctx, clipboard.FmtText)
-	for{
-		select{
+// WriteSensitive is WriteClipboard for a clip that must not reach the
+// disk, such as a password: while it is on the clipboard the mirror file
+// is left empty and the log never shows it.
+func WriteSensitive(data string) {
+	sensitiveMu.Lock()
+	sensitive = []byte(data)
+	sensitiveMu.Unlock()
+	WriteClipboard(data)
+}
+
+// isSensitive reports whether data was put on the clipboard with
+// WriteSensitive.
+func isSensitive(data []byte) bool {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	return sensitive != nil && slices.Equal(data, sensitive)
+}
+
+// WriteLazy puts a clip on the clipboard that fetch produces when it is
+// first read. It reports false when the backend has no way to defer it.
+func WriteLazy(fetch func() []byte) bool {
+	lazy, ok := backend.(LazyBackend)
+	if !ok {
+		return false
+	}
+	lazy.WriteLazy(fetch)
+	return true
+}
+
+func WatchClipboard(ctx context.Context) []byte {
+	// Stop the underlying watcher once we return so repeated calls don't pile up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	text := backend.Watch(ctx)
+	for {
+		select {
 		case data := <-text:
-			if !slices.Equal(data, network.Buffer){
+			if !network.IsReceived(data) {
+				if isSensitive(data) {
+					logger.Debug("Local clipboard changed", logging.SensitiveClip(data))
+				} else {
+					logger.Debug("Local clipboard changed", logging.Clip(data))
+				}
+				metrics.ClipboardChanges.Inc()
 				return data
 			}
 		case <-ctx.Done():
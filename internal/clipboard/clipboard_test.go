@@ -7,6 +7,7 @@ import (
 	"context"
 	"os/signal"
 	"os"
+	"path/filepath"
 	"syscall"
 	"time"
 )
@@ -49,4 +50,91 @@ func TestWatch(t *testing.T) {
 	case <-time.After(2 * time.Second):
 		t.Log("Timeout waiting for clipboard watch")
 	}
-}
\ No newline at end of file
+}
+func TestMemoryWatch(t *testing.T) {
+	mem := clipboard.NewMemory()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := mem.Watch(ctx)
+	mem.Write([]byte("headless"))
+
+	select {
+	case data := <-changes:
+		if string(data) != "headless" {
+			t.Errorf("Watch got %q, want %q", data, "headless")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Timeout waiting for memory clipboard watch")
+	}
+
+	if got := string(mem.Read()); got != "headless" {
+		t.Errorf("Read got %q, want %q", got, "headless")
+	}
+}
+
+func TestOSC52Scanner(t *testing.T) {
+	t.Setenv("TMUX", "")
+	t.Setenv("TERM", "xterm")
+
+	seq := clipboard.EncodeOSC52([]byte("over ssh"))
+	stream := append([]byte("prompt$ "), seq...)
+	stream = append(stream, []byte("\x1b]52;c;?\a\x1b]52;p;c3Q=\x1b\\done")...)
+
+	var clips []string
+	var passed bytes.Buffer
+	s := clipboard.NewOSC52Scanner(&passed, func(clip []byte) {
+		clips = append(clips, string(clip))
+	})
+	// Feed one byte at a time so every sequence is split across writes
+	for i := range stream {
+		s.Write(stream[i : i+1])
+	}
+
+	want := []string{"over ssh", "st"}
+	if len(clips) != len(want) || clips[0] != want[0] || clips[1] != want[1] {
+		t.Errorf("Captured %q, want %q", clips, want)
+	}
+	if !bytes.Equal(passed.Bytes(), stream) {
+		t.Error("Scanner did not pass the stream through unchanged")
+	}
+}
+
+func TestURIList(t *testing.T) {
+	list := "# copied by a file manager\r\nfile:///home/ada/My%20Notes.txt\r\nhttps://example.com/\r\nfile:///home/ada/src\r\n"
+	paths := clipboard.ParseURIList(list)
+	if len(paths) != 2 || paths[0] != "/home/ada/My Notes.txt" || paths[1] != "/home/ada/src" {
+		t.Fatalf("ParseURIList = %q", paths)
+	}
+	if got := clipboard.ParseURIList(clipboard.FormatURIList(paths)); len(got) != 2 || got[0] != paths[0] || got[1] != paths[1] {
+		t.Errorf("FormatURIList does not round trip: %q", got)
+	}
+}
+
+func TestMirrorSensitive(t *testing.T) {
+	clipboard.UseMemory()
+	path := filepath.Join(t.TempDir(), "clip")
+	clipboard.WriteClipboard("public")
+	go clipboard.Mirror(t.Context(), path)
+
+	// waitFor polls the mirror file until it holds want
+	waitFor := func(want string) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if got, err := os.ReadFile(path); err == nil && string(got) == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		got, _ := os.ReadFile(path)
+		t.Fatalf("Mirror holds %q, want %q", got, want)
+	}
+	waitFor("public")
+
+	// A sensitive clip empties the file rather than landing in it
+	clipboard.WriteSensitive("hunter2")
+	waitFor("")
+	clipboard.WriteClipboard("public again")
+	waitFor("public again")
+}
@@ -0,0 +1,155 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Copied files are not text, so golang.design/x/clipboard can't see them.
+// Each platform reads and writes the file list with its own tools instead:
+// wl-paste/wl-copy or xclip on Linux, osascript on macOS, and the
+// clipboard API and PowerShell on Windows. Where the clipboard has a change
+// count, on macOS and Windows, the list is only read after it changes.
+
+// ErrNoFileSupport is returned where the clipboard file list can't be
+// reached, e.g. without xclip or wl-clipboard.
+var ErrNoFileSupport = errors.New("no tool to access copied files on the clipboard")
+
+// filesPoll is how often the clipboard is checked for changes; the tools
+// above can't be watched.
+const filesPoll = time.Second
+
+var (
+	filesMu sync.Mutex
+	// lastFiles is the last file list seen or written, so our own writes
+	// are not reported as copies.
+	lastFiles []string
+)
+
+// ReadFiles returns the paths of the files copied to the clipboard, or nil
+// if it holds none.
+func ReadFiles(ctx context.Context) ([]string, error) {
+	if Headless() {
+		return nil, nil
+	}
+	return readFiles(ctx)
+}
+
+// WriteFiles puts paths on the clipboard as copied files, ready to paste
+// in a file manager.
+func WriteFiles(ctx context.Context, paths []string) error {
+	if Headless() {
+		return ErrNoFileSupport
+	}
+	filesMu.Lock()
+	lastFiles = slices.Clone(paths)
+	filesMu.Unlock()
+	return writeFiles(ctx, paths)
+}
+
+// WatchFiles reports every new set of files copied to the clipboard until
+// ctx is done. It never reports on a headless clipboard, or where the file
+// list can't be read.
+func WatchFiles(ctx context.Context) <-chan []string {
+	ch := make(chan []string)
+	go func() {
+		defer close(ch)
+		if Headless() {
+			<-ctx.Done()
+			return
+		}
+		// Files already on the clipboard at startup were not copied now
+		first := true
+		var seen uint64
+		for {
+			count, counted := changeCount()
+			if counted && count == seen && !first {
+				select {
+				case <-time.After(filesPoll):
+					continue
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			paths, err := readFiles(ctx)
+			if errors.Is(err, ErrNoFileSupport) {
+				logger.Info("Copied files are not synced", "reason", err.Error())
+				<-ctx.Done()
+				return
+			}
+
+			changed := false
+			if err == nil {
+				// A failed read is retried on the next poll
+				seen = count
+				filesMu.Lock()
+				changed = len(paths) > 0 && !slices.Equal(paths, lastFiles)
+				lastFiles = paths
+				filesMu.Unlock()
+			}
+
+			if changed && !first {
+				select {
+				case ch <- paths:
+				case <-ctx.Done():
+					return
+				}
+			}
+			first = false
+
+			select {
+			case <-time.After(filesPoll):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// ParseURIList returns the local paths in a text/uri-list, skipping
+// comments and URIs that are not files.
+func ParseURIList(list string) []string {
+	var paths []string
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, err := url.Parse(line)
+		if err != nil || u.Scheme != "file" || u.Path == "" {
+			continue
+		}
+		paths = append(paths, filepath.FromSlash(u.Path))
+	}
+	return paths
+}
+
+// FormatURIList turns paths into a text/uri-list.
+func FormatURIList(paths []string) string {
+	var b strings.Builder
+	for _, p := range paths {
+		u := url.URL{Scheme: "file", Path: filepath.ToSlash(p)}
+		b.WriteString(u.String())
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// lookTool returns the first of tools found on PATH.
+func lookTool(tools ...string) string {
+	for _, t := range tools {
+		if _, err := exec.LookPath(t); err == nil {
+			return t
+		}
+	}
+	return ""
+}
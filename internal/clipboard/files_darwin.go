@@ -0,0 +1,47 @@
+package clipboard
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+)
+
+// readScript prints the file URLs on the general pasteboard, one per line.
+const readScript = `ObjC.import("AppKit");
+var pb = $.NSPasteboard.generalPasteboard;
+var urls = pb.readObjectsForClassesOptions($([$.NSURL]), $({NSPasteboardURLReadingFileURLsOnlyKey: true}));
+var out = [];
+for (var i = 0; urls && i < urls.count; i++) out.push(urls.objectAtIndex(i).path.js);
+out.join("\n");`
+
+// writeScript puts the paths in the JSON array argv[0] on the pasteboard.
+const writeScript = `ObjC.import("AppKit");
+function run(argv) {
+	var paths = JSON.parse(argv[0]);
+	var pb = $.NSPasteboard.generalPasteboard;
+	pb.clearContents;
+	pb.writeObjects($(paths.map(function (p) { return $.NSURL.fileURLWithPath(p); })));
+}`
+
+func readFiles(ctx context.Context) ([]string, error) {
+	out, err := exec.CommandContext(ctx, "osascript", "-l", "JavaScript", "-e", readScript).Output()
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			paths = append(paths, line)
+		}
+	}
+	return paths, nil
+}
+
+func writeFiles(ctx context.Context, paths []string) error {
+	arg, err := json.Marshal(paths)
+	if err != nil {
+		return err
+	}
+	return exec.CommandContext(ctx, "osascript", "-l", "JavaScript", "-e", writeScript, string(arg)).Run()
+}
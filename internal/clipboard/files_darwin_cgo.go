@@ -0,0 +1,22 @@
+//go:build darwin && cgo
+
+package clipboard
+
+/*
+#cgo CFLAGS: -x objective-c
+#cgo LDFLAGS: -framework AppKit
+#import <AppKit/AppKit.h>
+
+static long pasteboardChangeCount(void) {
+	@autoreleasepool {
+		return [[NSPasteboard generalPasteboard] changeCount];
+	}
+}
+*/
+import "C"
+
+// changeCount returns the change count of the general pasteboard, which
+// goes up with every copy.
+func changeCount() (uint64, bool) {
+	return uint64(C.pasteboardChangeCount()), true
+}
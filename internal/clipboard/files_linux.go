@@ -0,0 +1,64 @@
+package clipboard
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const uriListType = "text/uri-list"
+
+// fileTool picks wl-clipboard on Wayland and xclip on X11.
+func fileTool() string {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if t := lookTool("wl-paste"); t != "" {
+			return t
+		}
+	}
+	return lookTool("xclip")
+}
+
+// changeCount is not available: X11 and Wayland only tell the clipboard
+// owner about changes, so the file list is read on every poll.
+func changeCount() (uint64, bool) {
+	return 0, false
+}
+
+func readFiles(ctx context.Context) ([]string, error) {
+	var types, list *exec.Cmd
+	switch fileTool() {
+	case "wl-paste":
+		types = exec.CommandContext(ctx, "wl-paste", "--list-types")
+		list = exec.CommandContext(ctx, "wl-paste", "--no-newline", "--type", uriListType)
+	case "xclip":
+		types = exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-t", "TARGETS", "-o")
+		list = exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-t", uriListType, "-o")
+	default:
+		return nil, ErrNoFileSupport
+	}
+	// Both fail when the clipboard is empty, which just means no files
+	out, err := types.Output()
+	if err != nil || !strings.Contains(string(out), uriListType) {
+		return nil, nil
+	}
+	out, err = list.Output()
+	if err != nil {
+		return nil, err
+	}
+	return ParseURIList(string(out)), nil
+}
+
+func writeFiles(ctx context.Context, paths []string) error {
+	var cmd *exec.Cmd
+	switch fileTool() {
+	case "wl-paste":
+		cmd = exec.CommandContext(ctx, "wl-copy", "--type", uriListType)
+	case "xclip":
+		cmd = exec.CommandContext(ctx, "xclip", "-selection", "clipboard", "-t", uriListType, "-i")
+	default:
+		return ErrNoFileSupport
+	}
+	cmd.Stdin = strings.NewReader(FormatURIList(paths))
+	return cmd.Run()
+}
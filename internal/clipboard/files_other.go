@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !windows
+
+package clipboard
+
+import "context"
+
+func changeCount() (uint64, bool) {
+	return 0, false
+}
+
+func readFiles(ctx context.Context) ([]string, error) {
+	return nil, ErrNoFileSupport
+}
+
+func writeFiles(ctx context.Context, paths []string) error {
+	return ErrNoFileSupport
+}
@@ -0,0 +1,96 @@
+package clipboard
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// The clipboard API, which x/sys/windows does not wrap. Copied files are
+// read natively, since the watcher reads them on every change; writing is
+// left to PowerShell, which builds the CF_HDROP for us.
+var (
+	user32                         = windows.NewLazySystemDLL("user32.dll")
+	shell32                        = windows.NewLazySystemDLL("shell32.dll")
+	procOpenClipboard              = user32.NewProc("OpenClipboard")
+	procCloseClipboard             = user32.NewProc("CloseClipboard")
+	procGetClipboardData           = user32.NewProc("GetClipboardData")
+	procIsClipboardFormatAvailable = user32.NewProc("IsClipboardFormatAvailable")
+	procGetClipboardSequenceNumber = user32.NewProc("GetClipboardSequenceNumber")
+	procDragQueryFile              = shell32.NewProc("DragQueryFileW")
+)
+
+const cfHDROP = 15
+
+// errClipboardBusy is returned while another program holds the clipboard
+// open.
+var errClipboardBusy = errors.New("clipboard is in use by another program")
+
+// changeCount returns the clipboard sequence number, which changes with
+// every copy.
+func changeCount() (uint64, bool) {
+	n, _, _ := procGetClipboardSequenceNumber.Call()
+	return uint64(n), n != 0
+}
+
+func readFiles(ctx context.Context) ([]string, error) {
+	if r, _, _ := procIsClipboardFormatAvailable.Call(cfHDROP); r == 0 {
+		return nil, nil
+	}
+
+	// The clipboard is opened and closed by the same thread
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := openClipboard(ctx); err != nil {
+		return nil, err
+	}
+	defer procCloseClipboard.Call()
+
+	drop, _, _ := procGetClipboardData.Call(cfHDROP)
+	if drop == 0 {
+		return nil, nil
+	}
+	count, _, _ := procDragQueryFile.Call(drop, 0xFFFFFFFF, 0, 0)
+	paths := make([]string, 0, count)
+	for i := range count {
+		n, _, _ := procDragQueryFile.Call(drop, i, 0, 0)
+		buf := make([]uint16, n+1)
+		procDragQueryFile.Call(drop, i, uintptr(unsafe.Pointer(&buf[0])), n+1)
+		paths = append(paths, windows.UTF16ToString(buf))
+	}
+	return paths, nil
+}
+
+// openClipboard retries for a moment while another program has the
+// clipboard open, as it does while writing to it.
+func openClipboard(ctx context.Context) error {
+	for range 10 {
+		if r, _, _ := procOpenClipboard.Call(0); r != 0 {
+			return nil
+		}
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return errClipboardBusy
+}
+
+func powershell(ctx context.Context, script string) *exec.Cmd {
+	return exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+}
+
+// writeFiles reads the paths from standard input, one per line, so they
+// need no quoting.
+func writeFiles(ctx context.Context, paths []string) error {
+	cmd := powershell(ctx, "Set-Clipboard -LiteralPath ($input | Where-Object { $_ })")
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\n"))
+	return cmd.Run()
+}
@@ -0,0 +1,73 @@
+package clipboard
+
+import (
+	"context"
+	"sync"
+)
+
+// Memory is a virtual clipboard kept in process memory. Every write is
+// delivered to all active watchers, like a change on the system clipboard.
+// A clip written with WriteLazy is fetched by the first Read.
+type Memory struct {
+	mu       sync.Mutex
+	data     []byte
+	fetch    func() []byte
+	watchers map[chan []byte]struct{}
+}
+
+func NewMemory() *Memory {
+	return &Memory{watchers: make(map[chan []byte]struct{})}
+}
+
+func (m *Memory) Read() []byte {
+	m.mu.Lock()
+	fetch := m.fetch
+	m.fetch = nil
+	m.mu.Unlock()
+	if fetch != nil {
+		if data := fetch(); data != nil {
+			m.Write(data)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.data...)
+}
+
+func (m *Memory) Write(data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data = append([]byte(nil), data...)
+	m.fetch = nil
+	for ch := range m.watchers {
+		// Drop the update for watchers that are busy rather than block writers
+		select {
+		case ch <- append([]byte(nil), data...):
+		default:
+		}
+	}
+}
+
+// WriteLazy makes fetch the clipboard's contents, to be called on the
+// next Read.
+func (m *Memory) WriteLazy(fetch func() []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fetch = fetch
+}
+
+func (m *Memory) Watch(ctx context.Context) <-chan []byte {
+	ch := make(chan []byte, 1)
+	m.mu.Lock()
+	m.watchers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		delete(m.watchers, ch)
+		m.mu.Unlock()
+	}()
+	return ch
+}
@@ -0,0 +1,79 @@
+package clipboard
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+
+	"clipsync/internal/logging"
+)
+
+// Mirror exposes the clipboard through the file at path until ctx is done.
+// If path is a named pipe, anything written to it is put on the clipboard
+// and synced; otherwise the file is rewritten whenever the clipboard changes.
+// Sensitive clips are never written to it: the file is emptied instead.
+func Mirror(ctx context.Context, path string) error {
+	info, err := os.Stat(path)
+	if err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		go readPipe(ctx, path)
+		<-ctx.Done()
+		return nil
+	}
+
+	if err := writeMirror(path, backend.Read()); err != nil {
+		return err
+	}
+	changes := backend.Watch(ctx)
+	for {
+		select {
+		case data := <-changes:
+			if err := writeMirror(path, data); err != nil {
+				logger.Warn("Clipboard mirror write failed", "path", path, logging.Err(err))
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// readPipe puts every message written to the pipe on the clipboard. Opening
+// a pipe blocks until a writer shows up, so each writer is one message.
+func readPipe(ctx context.Context, path string) {
+	for ctx.Err() == nil {
+		f, err := os.Open(path)
+		if err != nil {
+			logger.Error("Clipboard pipe open failed", "path", path, logging.Err(err))
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(f, 1<<20))
+		f.Close()
+		if err != nil {
+			logger.Warn("Clipboard pipe read failed", "path", path, logging.Err(err))
+			continue
+		}
+		if len(data) > 0 && ctx.Err() == nil {
+			backend.Write(data)
+		}
+	}
+}
+
+// writeMirror replaces the file atomically so readers never see half a clip.
+func writeMirror(path string, data []byte) error {
+	if isSensitive(data) {
+		data = nil
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".clipsync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
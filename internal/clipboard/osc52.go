@@ -0,0 +1,163 @@
+package clipboard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"strings"
+)
+
+// OSC 52 is the terminal escape sequence for setting the clipboard of the
+// terminal emulator, which keeps working through SSH:
+//
+//	ESC ] 52 ; <selection> ; <base64 data> BEL
+const (
+	oscStart    = "\x1b]52;"
+	bel         = '\a'
+	stTerminate = "\x1b\\"
+	// maxOSC52 bounds how much of a sequence is buffered while scanning.
+	maxOSC52 = 1 << 20
+	// screenChunk is the longest string GNU screen passes through in one DCS.
+	screenChunk = 768
+)
+
+// EncodeOSC52 returns the sequence that puts data on the terminal's
+// clipboard. Inside tmux or screen it is wrapped in a passthrough so it
+// reaches the outer terminal.
+func EncodeOSC52(data []byte) []byte {
+	seq := oscStart + "c;" + base64.StdEncoding.EncodeToString(data) + string(bel)
+
+	switch {
+	case os.Getenv("TMUX") != "":
+		return []byte("\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + stTerminate)
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		var b strings.Builder
+		for len(seq) > 0 {
+			n := min(len(seq), screenChunk)
+			b.WriteString("\x1bP" + seq[:n] + stTerminate)
+			seq = seq[n:]
+		}
+		return []byte(b.String())
+	}
+	return []byte(seq)
+}
+
+// DecodeOSC52 extracts the clipboard payloads of every OSC 52 sequence in
+// data. Queries ("?") and malformed sequences are skipped.
+func DecodeOSC52(data []byte) [][]byte {
+	var clips [][]byte
+	s := NewOSC52Scanner(io.Discard, func(clip []byte) {
+		clips = append(clips, clip)
+	})
+	s.Write(data)
+	return clips
+}
+
+// OSC52Scanner passes a terminal output stream through unchanged while
+// picking out OSC 52 writes, even when a sequence is split across writes.
+type OSC52Scanner struct {
+	out     io.Writer
+	onClip  func([]byte)
+	pending []byte
+}
+
+// NewOSC52Scanner forwards everything to out and calls onClip with the
+// decoded payload of each OSC 52 write it sees.
+func NewOSC52Scanner(out io.Writer, onClip func([]byte)) *OSC52Scanner {
+	return &OSC52Scanner{out: out, onClip: onClip}
+}
+
+func (s *OSC52Scanner) Write(p []byte) (int, error) {
+	if _, err := s.out.Write(p); err != nil {
+		return 0, err
+	}
+
+	buf := append(s.pending, p...)
+	for {
+		i := bytes.Index(buf, []byte(oscStart))
+		if i < 0 {
+			// Keep a possible partial start marker for the next write
+			keep := min(len(buf), len(oscStart)-1)
+			s.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+			return len(p), nil
+		}
+		body := buf[i+len(oscStart):]
+		end, termLen := osc52End(body)
+		if end < 0 {
+			if len(body) > maxOSC52 {
+				s.pending = nil
+			} else {
+				s.pending = append([]byte(nil), buf[i:]...)
+			}
+			return len(p), nil
+		}
+		if clip, ok := parseOSC52(body[:end]); ok {
+			s.onClip(clip)
+		}
+		buf = body[end+termLen:]
+	}
+}
+
+// osc52End finds the terminator of a sequence body: BEL or ST.
+func osc52End(body []byte) (int, int) {
+	b := bytes.IndexByte(body, bel)
+	st := bytes.Index(body, []byte(stTerminate))
+	switch {
+	case b < 0 && st < 0:
+		return -1, 0
+	case st < 0 || (b >= 0 && b < st):
+		return b, 1
+	default:
+		return st, len(stTerminate)
+	}
+}
+
+// parseOSC52 decodes "<selection>;<base64>".
+func parseOSC52(body []byte) ([]byte, bool) {
+	_, payload, ok := bytes.Cut(body, []byte(";"))
+	if !ok || string(payload) == "?" {
+		return nil, false
+	}
+	clip, err := base64.StdEncoding.DecodeString(string(payload))
+	if err != nil || len(clip) == 0 {
+		return nil, false
+	}
+	return clip, true
+}
+
+// OSC52 is a virtual clipboard backed by a terminal. Clips written to it
+// are sent to the terminal as OSC 52 sequences; clips the terminal session
+// sets through OSC 52 are captured and reported to watchers.
+type OSC52 struct {
+	*Memory
+	out io.Writer
+}
+
+// NewOSC52 returns a backend that emits OSC 52 sequences on out, which
+// must be safe for concurrent use with whatever else writes the terminal.
+func NewOSC52(out io.Writer) *OSC52 {
+	return &OSC52{Memory: NewMemory(), out: out}
+}
+
+// Write puts data on the terminal's clipboard.
+func (o *OSC52) Write(data []byte) {
+	o.Memory.Write(data)
+	o.out.Write(EncodeOSC52(data))
+}
+
+// Capture records a clip the terminal session set itself, so it is synced
+// without being echoed back to the terminal.
+func (o *OSC52) Capture(data []byte) {
+	o.Memory.Write(data)
+}
+
+// WriteLazy fetches the clip right away: the terminal pastes from its own
+// clipboard, so there is no read to defer the fetch to.
+func (o *OSC52) WriteLazy(fetch func() []byte) {
+	go func() {
+		if data := fetch(); data != nil {
+			o.Write(data)
+		}
+	}()
+}
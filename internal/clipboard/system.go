@@ -0,0 +1,26 @@
+package clipboard
+
+import (
+	"context"
+
+	"golang.design/x/clipboard"
+)
+
+// systemBackend is the OS clipboard through golang.design/x/clipboard.
+type systemBackend struct{}
+
+func initSystem() error {
+	return clipboard.Init()
+}
+
+func (systemBackend) Read() []byte {
+	return clipboard.Read(clipboard.FmtText)
+}
+
+func (systemBackend) Write(data []byte) {
+	clipboard.Write(clipboard.FmtText, data)
+}
+
+func (systemBackend) Watch(ctx context.Context) <-chan []byte {
+	return clipboard.Watch(ctx, clipboard.FmtText)
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Config holds the settings read from config.json in the user config
+// directory. Command line flags override what is stored here.
+type Config struct {
+	// Headless keeps a virtual clipboard in memory instead of using the
+	// system clipboard, for machines without a display server.
+	Headless bool `json:"headless,omitempty"`
+	// ClipFile exposes the clipboard through a file or named pipe.
+	ClipFile string `json:"clip_file,omitempty"`
+	// LogLevel is the minimum level written to the log: debug, info, warn
+	// or error. It defaults to info.
+	LogLevel string `json:"log_level,omitempty"`
+	// LogClips writes clip contents to the log. They are redacted unless
+	// this is set.
+	LogClips bool `json:"log_clips,omitempty"`
+	// MetricsAddr serves Prometheus metrics on a separate address, e.g.
+	// 127.0.0.1:9997. They are always available on the IPC port.
+	MetricsAddr string `json:"metrics_addr,omitempty"`
+	// Peers are host[:port] addresses dialled directly, for networks
+	// where mDNS does not get through.
+	Peers []string `json:"peers,omitempty"`
+	// Relay is the host[:port] of a relay to sync through, for devices on
+	// other subnets or behind a VPN.
+	Relay string `json:"relay,omitempty"`
+	// RelayFingerprint pins the relay's certificate by its SHA-256, for
+	// relays with a self-signed certificate.
+	RelayFingerprint string `json:"relay_fingerprint,omitempty"`
+	// GroupKey is shared by the devices of a sync group. Clips sent through
+	// the relay are encrypted with it, so the relay can't read them.
+	GroupKey string `json:"group_key,omitempty"`
+	// Discovery switches the ways devices find each other on the LAN.
+	Discovery Discovery `json:"discovery,omitzero"`
+	// Interfaces picks the network interfaces discovery runs on.
+	Interfaces Interfaces `json:"interfaces,omitzero"`
+	// Lazy announces large clips instead of sending them, for peers to
+	// fetch when they are pasted.
+	Lazy Lazy `json:"lazy,omitzero"`
+	// Inbox is the folder files copied on other devices are saved to. It
+	// defaults to ClipSync in the Downloads folder.
+	Inbox string `json:"inbox,omitempty"`
+	// MaxTransfer bounds, in bytes, the files sent or accepted at once.
+	// It defaults to 1 GB.
+	MaxTransfer int64 `json:"max_transfer,omitempty"`
+	// TrustedNetworks, if set, limits syncing to these networks. On any
+	// other network the daemon pauses.
+	TrustedNetworks []NetworkProfile `json:"trusted_networks,omitempty"`
+	// History keeps the clipboard history across restarts.
+	History History `json:"history,omitzero"`
+}
+
+// History configures the history saved to disk. It is encrypted with a key
+// kept in the OS keyring, or derived from a passphrase where there is none.
+type History struct {
+	// Persist saves the history to an encrypted file in the state
+	// directory.
+	Persist bool `json:"persist,omitempty"`
+	// Max is the number of entries saved. It defaults to 200.
+	Max int `json:"max,omitempty"`
+	// PassphraseFile holds the passphrase to derive the key from instead,
+	// for headless machines without a keyring. CLIPSYNC_HISTORY_PASSPHRASE
+	// overrides it.
+	PassphraseFile string `json:"passphrase_file,omitempty"`
+}
+
+// NetworkProfile describes a trusted network. Every field that is set must
+// match the current network.
+type NetworkProfile struct {
+	Name string `json:"name" yaml:"name"`
+	// SSID is the Wi-Fi network name, where it can be detected.
+	SSID string `json:"ssid,omitempty" yaml:"ssid,omitempty"`
+	// GatewayMAC is the MAC address of the default gateway.
+	GatewayMAC string `json:"gateway_mac,omitempty" yaml:"gateway_mac,omitempty"`
+	// Subnet is a CIDR one of the local addresses must be in.
+	Subnet string `json:"subnet,omitempty" yaml:"subnet,omitempty"`
+	// Interface is an interface name, with * wildcards, that must be up.
+	Interface string `json:"interface,omitempty" yaml:"interface,omitempty"`
+}
+
+// Lazy configures announce-then-fetch. Clips too large for a datagram
+// are always announced.
+type Lazy struct {
+	// Enabled announces every clip over 16 KB rather than sending it.
+	Enabled bool `json:"enabled,omitempty"`
+	// FetchBelow is the size in bytes up to which announced clips are
+	// fetched as soon as they arrive. It defaults to 256 KB. Desktop
+	// clipboards can't fetch on paste and fetch every clip on arrival.
+	FetchBelow int `json:"fetch_below,omitempty"`
+}
+
+// Interfaces selects network interfaces by name, with * wildcards as in
+// docker*, or by CIDR matched against their addresses.
+type Interfaces struct {
+	// Include, if set, limits discovery to matching interfaces.
+	Include []string `json:"include,omitempty"`
+	// Exclude keeps discovery off matching interfaces.
+	Exclude []string `json:"exclude,omitempty"`
+}
+
+// Discovery configures how devices find each other. Every mechanism is on
+// unless switched off.
+type Discovery struct {
+	// MDNS announces and browses on UDP 5353.
+	MDNS *bool `json:"mdns,omitempty"`
+	// Multicast sends ClipSync's own announcements to MulticastGroup, for
+	// networks that filter mDNS.
+	Multicast *bool `json:"multicast,omitempty"`
+	// Broadcast sends them to each subnet's broadcast address, for
+	// networks that filter multicast altogether.
+	Broadcast *bool `json:"broadcast,omitempty"`
+	// MulticastGroup is the IPv4 group announcements go to.
+	MulticastGroup string `json:"multicast_group,omitempty"`
+}
+
+// On reports whether a discovery switch is on; unset switches are.
+func On(b *bool) bool {
+	return b == nil || *b
+}
+
+// Path returns the location of the config file.
+func Path() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clipsync", "config.json"), nil
+}
+
+// Load reads the config file. A missing file yields the defaults.
+func Load() (*Config, error) {
+	cfg := &Config{}
+	path, err := Path()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// Save writes the config file, creating its directory if needed.
+func (c *Config) Save() error {
+	path, err := Path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
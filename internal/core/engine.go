@@ -0,0 +1,113 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/config"
+	"clipsync/internal/instance"
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+	"clipsync/internal/network"
+	"clipsync/internal/service"
+)
+
+// Options configures an engine started with Run.
+type Options struct {
+	// ClipFile exposes the clipboard through a file or named pipe.
+	ClipFile string
+	// MetricsAddr, if set, serves /metrics on its own address as well as
+	// on the IPC port.
+	MetricsAddr string
+}
+
+// Run serves the IPC API and runs the sync engine on the current clipboard
+// backend until ctx is done or a client asks it to stop. Only one engine
+// may run per user; a second one fails with instance.ErrRunning.
+func Run(ctx context.Context, opts Options) error {
+	lock, err := instance.Acquire()
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ln, err := service.ActivationListener()
+	if err != nil {
+		logger.Warn("Ignoring socket from service manager", logging.Err(err))
+	}
+	go ipc.Serve(ctx, ln, cancel)
+
+	// Tell the service manager we are up once the sync socket is bound
+	go func() {
+		select {
+		case <-network.Ready:
+			service.Notify("READY=1")
+		case <-ctx.Done():
+		}
+	}()
+	defer service.Notify("STOPPING=1")
+
+	if opts.ClipFile != "" {
+		go func() {
+			logger.Info("Mirroring clipboard", "path", opts.ClipFile)
+			if err := clipboard.Mirror(ctx, opts.ClipFile); err != nil {
+				logger.Error("Clipboard mirror stopped", logging.Err(err))
+			}
+		}()
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Warn("Failed to load config, no static peers", logging.Err(err))
+	}
+	network.SetStaticPeers(cfg.Peers)
+	network.Discovery = network.DiscoveryOptions{
+		MDNS:           config.On(cfg.Discovery.MDNS),
+		Multicast:      config.On(cfg.Discovery.Multicast),
+		Broadcast:      config.On(cfg.Discovery.Broadcast),
+		MulticastGroup: cmp.Or(cfg.Discovery.MulticastGroup, network.DefaultMulticastGroup),
+		Include:        cfg.Interfaces.Include,
+		Exclude:        cfg.Interfaces.Exclude,
+	}
+	network.Lazy = network.LazyOptions{
+		Enabled:    cfg.Lazy.Enabled,
+		FetchBelow: cmp.Or(cfg.Lazy.FetchBelow, network.DefaultFetchBelow),
+	}
+	network.MaxTransfer = cmp.Or(cfg.MaxTransfer, network.DefaultMaxTransfer)
+	inbox = cfg.Inbox
+	if err := network.CheckInterfacePatterns(slices.Concat(cfg.Interfaces.Include, cfg.Interfaces.Exclude)); err != nil {
+		logger.Warn("Ignoring part of the interface selection", logging.Err(err))
+	}
+	setupRelay(cfg)
+	if store := openHistory(ctx, cfg); store != nil {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			keepHistory(ctx, store, cfg.History.Max)
+		}()
+		// Let the last save finish before exiting
+		defer func() {
+			cancel()
+			<-done
+		}()
+	}
+	// Decide before anything is advertised
+	checkTrust(ctx)
+
+	if opts.MetricsAddr != "" {
+		go func() {
+			logger.Info("Serving metrics", "addr", opts.MetricsAddr)
+			if err := metrics.Serve(ctx, opts.MetricsAddr); err != nil {
+				logger.Error("Metrics server failed", logging.Err(err))
+			}
+		}()
+	}
+
+	return StartSync(ctx)
+}
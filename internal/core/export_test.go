@@ -0,0 +1,17 @@
+package core
+
+import (
+	"context"
+
+	"clipsync/internal/network"
+)
+
+var ReceiveOffers = receiveOffers
+
+// SetFetch replaces how announced clips are fetched right away until
+// restore is called.
+func SetFetch(fn func(ctx context.Context, o network.Offer)) (restore func()) {
+	old := fetchNow
+	fetchNow = fn
+	return func() { fetchNow = old }
+}
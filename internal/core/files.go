@@ -0,0 +1,53 @@
+package core
+
+import (
+	"context"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/logging"
+	"clipsync/internal/network"
+	"clipsync/internal/utils"
+)
+
+// inbox is the configured folder for received files; empty means the
+// default.
+var inbox string
+
+// sendFiles offers files copied on this machine to peers.
+func sendFiles(ctx context.Context) error {
+	for paths := range clipboard.WatchFiles(ctx) {
+		logger.Info("Files copied, offering them", "count", len(paths))
+		if err := network.SendFiles(paths); err != nil {
+			logger.Warn("Could not send copied files", logging.Err(err))
+		}
+	}
+	return ctx.Err()
+}
+
+// receiveFiles saves the files peers offer to the inbox and puts the
+// copies on the clipboard, ready to paste.
+func receiveFiles(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case o := <-network.FileOffers:
+			dir := inbox
+			if dir == "" {
+				var err error
+				if dir, err = utils.InboxDir(); err != nil {
+					logger.Warn("No folder to save received files to", logging.Err(err))
+					continue
+				}
+			}
+			paths, err := network.ReceiveFiles(ctx, o, dir)
+			if err != nil {
+				logger.Warn("Could not receive files", "peer", o.From, logging.Err(err))
+				continue
+			}
+			if err := clipboard.WriteFiles(ctx, paths); err != nil {
+				logger.Info("Received files are in the inbox", "dir", dir, "reason", err.Error())
+			}
+		}
+	}
+}
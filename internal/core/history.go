@@ -0,0 +1,112 @@
+package core
+
+import (
+	"cmp"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"clipsync/internal/config"
+	"clipsync/internal/events"
+	"clipsync/internal/globals"
+	"clipsync/internal/history"
+	"clipsync/internal/logging"
+	"clipsync/internal/utils"
+	"clipsync/internal/view"
+)
+
+const (
+	// historyFile is the encrypted history in the state directory.
+	historyFile = "history.enc"
+	// defaultHistoryMax is how many entries are saved unless configured.
+	defaultHistoryMax = 200
+	// saveDelay batches bursts of changes into one write.
+	saveDelay = 2 * time.Second
+	// passphraseEnv overrides history.passphrase_file.
+	passphraseEnv = "CLIPSYNC_HISTORY_PASSPHRASE"
+)
+
+// openHistory opens the saved history and loads it, when persisting is
+// on. A history that can't be opened is neither loaded nor overwritten.
+func openHistory(ctx context.Context, cfg *config.Config) *history.Store {
+	if !cfg.History.Persist {
+		return nil
+	}
+	dir, err := utils.StateDir()
+	if err != nil {
+		logger.Error("Not saving the history", logging.Err(err))
+		return nil
+	}
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" && cfg.History.PassphraseFile != "" {
+		data, err := os.ReadFile(cfg.History.PassphraseFile)
+		if err != nil {
+			logger.Error("Not saving the history", logging.Err(err))
+			return nil
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	}
+
+	store, err := history.Open(ctx, filepath.Join(dir, historyFile), passphrase)
+	if err != nil {
+		logger.Error("Not saving the history", logging.Err(err))
+		return nil
+	}
+	saved, err := store.Load()
+	if err != nil {
+		logger.Error("Not saving the history", logging.Err(err))
+		return nil
+	}
+	// Nothing is discovered yet, so only the history is replaced
+	view.LoadState(nil, saved)
+	logger.Info("Loaded the saved history", "entries", len(saved))
+	return store
+}
+
+// keepHistory saves the history shortly after every change, and once more
+// when ctx is done. Entries marked sensitive are dropped from the file at
+// once. Every save holds ClipHistoryMu, so saves never overlap.
+func keepHistory(ctx context.Context, store *history.Store, limit int) {
+	stream, stop := events.Subscribe()
+	defer stop()
+
+	save := func(clips []globals.Clip) {
+		if err := store.Save(clips, cmp.Or(limit, defaultHistoryMax)); err != nil {
+			logger.Warn("Could not save the history", logging.Err(err))
+		}
+	}
+	globals.ClipHistoryMu.Lock()
+	view.SaveHistory = save
+	globals.ClipHistoryMu.Unlock()
+	defer func() {
+		globals.ClipHistoryMu.Lock()
+		view.SaveHistory = nil
+		globals.ClipHistoryMu.Unlock()
+	}()
+
+	var due <-chan time.Time
+	for {
+		select {
+		case e := <-stream:
+			switch e.Type {
+			case events.ClipAdded, events.ClipFetched, events.ClipUpdated:
+				if due == nil {
+					due = time.After(saveDelay)
+				}
+			}
+			continue
+		case <-due:
+			due = nil
+		case <-ctx.Done():
+		}
+
+		globals.ClipHistoryMu.Lock()
+		save(globals.ClipHistory)
+		globals.ClipHistoryMu.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/network"
+	"clipsync/internal/view"
+)
+
+// receiveOffers handles the clips peers announce. Small clips and clips
+// already in the cache are fetched right away; larger ones are listed in
+// the history and fetched when they are pasted or picked from the history.
+// The desktop clipboards can't render on paste, so they get every clip
+// right away, and so do sensitive clips, which are only kept out of the
+// mirror once written.
+func receiveOffers(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case o := <-network.Offers:
+			if o.Size <= network.Lazy.FetchBelow || network.Cached(o.Hash) || o.Sensitive {
+				go fetchNow(ctx, o)
+				continue
+			}
+			clip := pendingClip(o)
+			lazy := clipboard.WriteLazy(func() []byte {
+				data, err := network.FetchClip(ctx, clip)
+				if err != nil {
+					logger.Warn("Could not fetch clip on paste", logging.Err(err))
+					return nil
+				}
+				return data
+			})
+			if !lazy {
+				logger.Debug("Clipboard can't fetch on paste, fetching announced clip now", "bytes", o.Size)
+				go fetchNow(ctx, o)
+				continue
+			}
+			logger.Info("Peer announced a clip", "type", o.Type, "bytes", o.Size)
+			view.AddClip(clip)
+		}
+	}
+}
+
+// fetchNow is how receiveOffers fetches a clip right away.
+var fetchNow = fetchOffer
+
+// fetchOffer fetches an announced clip and delivers it like one that was
+// sent.
+func fetchOffer(ctx context.Context, o network.Offer) {
+	data, err := network.Fetch(ctx, o.Hash)
+	if err != nil {
+		logger.Warn("Could not fetch announced clip", "bytes", o.Size, logging.Err(err))
+		return
+	}
+	logger.Info("Received clip", "bytes", len(data))
+	writeClip(string(data), o.Sensitive)
+}
+
+// writeClip puts a clip from a peer on the clipboard and in the history.
+// A sensitive one is marked so it is never saved, mirrored or logged.
+func writeClip(data string, sensitive bool) {
+	if sensitive {
+		view.ExpectSensitive(data)
+		clipboard.WriteSensitive(data)
+	} else {
+		clipboard.WriteClipboard(data)
+	}
+	view.UpdateClipboard(data)
+}
+
+// pendingClip is the history entry for an offer not fetched yet.
+func pendingClip(o network.Offer) globals.Clip {
+	globals.ClipHistoryMu.Lock()
+	id := globals.NextClipID
+	globals.NextClipID++
+	globals.ClipHistoryMu.Unlock()
+
+	data := o.Preview
+	if data == "" {
+		data = fmt.Sprintf("[%s, %s]", o.Type, formatSize(o.Size))
+	}
+	return globals.Clip{ID: id, Data: data, Time: time.Now(), Pending: true, Hash: o.Hash, Type: o.Type, Size: o.Size, Sensitive: o.Sensitive}
+}
+
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,56 @@
+package core_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/core"
+	"clipsync/internal/globals"
+	"clipsync/internal/network"
+)
+
+// eager is a clipboard that can't defer a clip, like the desktop ones.
+type eager struct{ mem *clipboard.Memory }
+
+func (e eager) Read() []byte                            { return e.mem.Read() }
+func (e eager) Write(data []byte)                       { e.mem.Write(data) }
+func (e eager) Watch(ctx context.Context) <-chan []byte { return e.mem.Watch(ctx) }
+
+func TestLazyFallback(t *testing.T) {
+	fetched := make(chan network.Offer, 1)
+	defer core.SetFetch(func(_ context.Context, o network.Offer) { fetched <- o })()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go core.ReceiveOffers(ctx)
+
+	// A clipboard that can't fetch on paste gets a large clip right away
+	clipboard.UseBackend(eager{clipboard.NewMemory()})
+	big := network.Offer{Hash: "eager", Type: "text/plain", Size: network.Lazy.FetchBelow + 1}
+	network.Offers <- big
+	select {
+	case o := <-fetched:
+		if o.Hash != big.Hash {
+			t.Errorf("Fetched %q, want %q", o.Hash, big.Hash)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Clip was not fetched for a clipboard that can't defer it")
+	}
+
+	// One that can is left pending until it is pasted
+	clipboard.UseBackend(clipboard.NewMemory())
+	network.Offers <- network.Offer{Hash: "lazy", Type: "text/plain", Size: network.Lazy.FetchBelow + 1}
+	select {
+	case o := <-fetched:
+		t.Errorf("Clip %q was fetched before it was pasted", o.Hash)
+	case <-time.After(300 * time.Millisecond):
+	}
+	globals.ClipHistoryMu.Lock()
+	pending := slices.ContainsFunc(globals.ClipHistory, func(c globals.Clip) bool { return c.Hash == "lazy" && c.Pending })
+	globals.ClipHistoryMu.Unlock()
+	if !pending {
+		t.Error("Deferred clip is not pending in the history")
+	}
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+
+	"clipsync/internal/config"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+	"clipsync/internal/network"
+	"clipsync/internal/relay"
+	"clipsync/internal/utils"
+	"clipsync/internal/view"
+)
+
+// relayPeer labels relay traffic in the per-peer metrics.
+const relayPeer = "relay"
+
+// setupRelay creates the relay client when one is configured.
+func setupRelay(cfg *config.Config) {
+	relay.Use(nil)
+	if cfg.Relay == "" {
+		return
+	}
+	group, err := relay.NewGroup(cfg.GroupKey)
+	if err != nil {
+		logger.Error("Not using the relay", "relay", cfg.Relay, logging.Err(err))
+		return
+	}
+	dir, err := utils.StateDir()
+	if err == nil {
+		var id *relay.Identity
+		if id, err = relay.LoadIdentity(filepath.Join(dir, "relay-identity.key")); err == nil {
+			group.UseIdentity(id)
+		}
+	}
+	if err != nil {
+		logger.Warn("This device has no relay identity, so it can not be revoked or get rotated keys", logging.Err(err))
+	}
+	// Keeps envelopes opened before a restart from being accepted again,
+	// and the members known
+	if err == nil {
+		err = group.Persist(filepath.Join(dir, "relay-group.json"))
+	}
+	if err != nil {
+		logger.Warn("Relay replay protection will not survive a restart", logging.Err(err))
+	}
+	group.OnRekey = saveGroupKey
+	group.OnMembers = func() { view.SetMembers(group.Members()) }
+	group.OnMembers()
+	name, _ := os.Hostname()
+	relay.Use(relay.NewClient(cfg.Relay, group, name, relay.ClientTLS(cfg.RelayFingerprint)))
+}
+
+// sendRelay sends a local clip to the group through the relay.
+func sendRelay(data []byte, sensitive bool) {
+	c := relay.Active()
+	if c == nil || network.Paused() != "" {
+		return
+	}
+	if err := c.Send(data, sensitive); err != nil {
+		logger.Warn("Could not send clip through the relay", logging.Err(err))
+		metrics.SendErrors.With(relayPeer).Inc()
+		return
+	}
+	metrics.ClipsSent.With(relayPeer).Inc()
+	metrics.BytesSent.With(relayPeer).Add(uint64(len(data)))
+}
+
+// receiveRelay applies a clip another member sent through the relay.
+func receiveRelay(data []byte, sensitive bool) {
+	if network.Paused() != "" {
+		return
+	}
+	metrics.ClipsReceived.With(relayPeer).Inc()
+	metrics.BytesReceived.With(relayPeer).Add(uint64(len(data)))
+	// Devices on the same LAN get every clip over UDP as well
+	if _, changed := network.SetReceived(data); !changed {
+		return
+	}
+	logger.Info("Received clip through the relay", "bytes", len(data))
+	writeClip(string(data), sensitive)
+}
+
+// saveGroupKey keeps a rotated group key in the config file, so the device
+// still belongs to the group after a restart.
+func saveGroupKey(key string) {
+	cfg, err := config.Load()
+	if err == nil {
+		cfg.GroupKey = key
+		err = cfg.Save()
+	}
+	if err != nil {
+		logger.Error("Could not save the rotated group key, join the relay again with it", logging.Err(err))
+	}
+}
@@ -2,31 +2,46 @@ package core
 
 import (
 	"context"
-	"log"
 	"slices"
 	"time"
 
 	"clipsync/internal/clipboard"
 	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
 	"clipsync/internal/network"
 	"clipsync/internal/ping"
+	"clipsync/internal/relay"
 	"clipsync/internal/view"
 
 	"golang.org/x/sync/errgroup"
 )
 
+var logger = logging.For(logging.Sync)
+
 // StartSync initializes and runs all background synchronization tasks.
 func StartSync(ctx context.Context) error {
 	eg, ctx := errgroup.WithContext(ctx)
 
-	// 1. Register our device on the network
+	// Follow the network as the machine roams between networks, and pause
+	// on networks that are not trusted
+	eg.Go(func() error {
+		return network.WatchInterfaces(ctx)
+	})
 	eg.Go(func() error {
-		return network.RegisterDevice(ctx, "")
+		return watchTrust(ctx)
 	})
 
-	// 2. Discover other devices
+	// 1. Register our device on the network, and 2. discover other devices
+	if network.Discovery.MDNS {
+		eg.Go(func() error {
+			return network.RunMDNS(ctx)
+		})
+	}
+
+	// Fall back to our own announcements where mDNS is filtered
 	eg.Go(func() error {
-		return network.BrowseForDevices(ctx)
+		return network.RunAnnouncements(ctx)
 	})
 
 	// 3. Listen for incoming UDP connections
@@ -34,6 +49,34 @@ func StartSync(ctx context.Context) error {
 		return network.Listen(ctx)
 	})
 
+	// Keep the configured static peers resolved and greeted
+	eg.Go(func() error {
+		return network.RunStaticPeers(ctx)
+	})
+
+	// Serve the clips we announce, and fetch the ones peers announce
+	eg.Go(func() error {
+		return network.ServeClips(ctx)
+	})
+	eg.Go(func() error {
+		return receiveOffers(ctx)
+	})
+
+	// Send copied files and folders, and save the ones peers send
+	eg.Go(func() error {
+		return sendFiles(ctx)
+	})
+	eg.Go(func() error {
+		return receiveFiles(ctx)
+	})
+
+	// Sync with devices elsewhere through the relay
+	if c := relay.Active(); c != nil {
+		eg.Go(func() error {
+			return c.Run(ctx, receiveRelay)
+		})
+	}
+
 	// 4. Watch local clipboard for changes
 	eg.Go(func() error {
 		for {
@@ -49,9 +92,15 @@ func StartSync(ctx context.Context) error {
 					continue
 				}
 				// Avoid loops: don't send if it's the same as what we just received
-				if !slices.Equal(data, network.Buffer) {
-					log.Printf("[Sync] Local change detected, sending to %d devices", len(globals.IPS))
-					network.SendClipboard(data)
+				if !network.IsReceived(data) {
+					logger.Info("Local change detected, sending", "bytes", len(data))
+					sensitive := view.Sensitive(string(data))
+					if sensitive {
+						network.SendSensitive(data)
+					} else {
+						network.SendClipboard(data)
+					}
+					sendRelay(data, sensitive)
 					view.UpdateClipboard(string(data))
 				}
 			}
@@ -73,9 +122,8 @@ func StartSync(ctx context.Context) error {
 				buffer, n := network.RecieveClipboard()
 				if n > 0 {
 					data := string(buffer[:n])
-					log.Printf("[Sync] Received new clipboard data (%d bytes)", n)
-					clipboard.WriteClipboard(data)
-					view.UpdateClipboard(data)
+					logger.Info("Received clip", "bytes", n)
+					writeClip(data, view.Sensitive(data))
 				}
 			}
 		}
@@ -95,11 +143,23 @@ func StartSync(ctx context.Context) error {
 
 				if len(ipsToPing) > 0 {
 					currentIPS := ping.PingIPS(ipsToPing)
+					for _, ip := range ipsToPing {
+						if slices.Contains(currentIPS, ip) {
+							metrics.PeerUp.Set(ip, 1)
+							continue
+						}
+						metrics.PeerUp.Set(ip, 0)
+						// Static peers stay on the list; they are often behind
+						// networks that drop ICMP
+						if network.IsStatic(ip) {
+							currentIPS = append(currentIPS, ip)
+						}
+					}
 
 					globals.IPSMu.Lock()
 					globals.IPS = currentIPS
 					globals.IPSMu.Unlock()
-					log.Printf("[Sync] Ping check: %d devices active", len(globals.IPS))
+					logger.Debug("Ping check", "active", len(currentIPS))
 				}
 			}
 		}
@@ -0,0 +1,73 @@
+package core
+
+import (
+	"context"
+	"time"
+
+	"clipsync/internal/config"
+	"clipsync/internal/logging"
+	"clipsync/internal/network"
+	"clipsync/internal/trust"
+	"clipsync/internal/view"
+)
+
+// trustPoll is how often the network is checked against the trusted
+// profiles, besides whenever the interfaces change.
+const trustPoll = 10 * time.Second
+
+// untrusted is why sync pauses on a network no profile matches.
+const untrusted = "untrusted network"
+
+// watchTrust keeps sync paused while the machine is not on a trusted
+// network, until ctx is done.
+func watchTrust(ctx context.Context) error {
+	changes := network.InterfaceChanges(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changes:
+		case <-time.After(trustPoll):
+		}
+		checkTrust(ctx)
+	}
+}
+
+// checkTrust limits discovery to the interfaces on a trusted network, and
+// pauses sync when there are none. Without trusted profiles every network
+// is trusted. The config is read every time so profiles added from the
+// CLI apply without a restart.
+func checkTrust(ctx context.Context) {
+	cfg, err := config.Load()
+	if err != nil {
+		logger.Warn("Failed to load config, keeping the trust state", logging.Err(err))
+		return
+	}
+	if len(cfg.TrustedNetworks) == 0 {
+		network.TrustInterfaces(nil)
+		setPaused("")
+		return
+	}
+	ifaces := trust.TrustedInterfaces(cfg.TrustedNetworks, trust.Detect(ctx))
+	if len(ifaces) == 0 {
+		setPaused(untrusted)
+		return
+	}
+	network.TrustInterfaces(ifaces)
+	if network.Paused() != "" {
+		logger.Info("On a trusted network", "interfaces", ifaces)
+	}
+	setPaused("")
+}
+
+func setPaused(reason string) {
+	if network.Paused() == reason {
+		return
+	}
+	if reason == "" {
+		network.Resume()
+	} else {
+		network.Pause(reason)
+	}
+	view.SetPaused(reason)
+}
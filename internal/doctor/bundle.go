@@ -0,0 +1,117 @@
+package doctor
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"clipsync/internal/config"
+	"clipsync/internal/logging"
+)
+
+// WriteBundle writes a zip for bug reports: the report, the config and the
+// logs. Clip contents, secrets in the config and the home directory are
+// redacted from all of it.
+func WriteBundle(w io.Writer, report *Report) error {
+	zw := zip.NewWriter(w)
+	redact := redactor()
+
+	add := func(name string, data []byte) error {
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(redact(data))
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := add("report.json", data); err != nil {
+		return err
+	}
+
+	system := fmt.Sprintf("os: %s\narch: %s\ngo: %s\ncpus: %d\n", runtime.GOOS, runtime.GOARCH, runtime.Version(), runtime.NumCPU())
+	if err := add("system.txt", []byte(system)); err != nil {
+		return err
+	}
+
+	if cfg, err := config.Load(); err == nil {
+		data, _ := json.MarshalIndent(redactConfig(cfg), "", "  ")
+		if err := add("config.json", data); err != nil {
+			return err
+		}
+	}
+
+	if dir, err := logging.Dir(); err == nil {
+		names, _ := filepath.Glob(filepath.Join(dir, logging.FileName+"*"))
+		gui, _ := filepath.Glob(filepath.Join(dir, logging.GUIFileName+"*"))
+		for _, name := range append(names, gui...) {
+			data, err := os.ReadFile(name)
+			if err != nil {
+				continue
+			}
+			if err := add("logs/"+filepath.Base(name), redactLog(data)); err != nil {
+				return err
+			}
+		}
+	}
+	return zw.Close()
+}
+
+// redactConfig masks the secrets in cfg, keeping whether they are set.
+func redactConfig(cfg *config.Config) *config.Config {
+	c := *cfg
+	for _, s := range []*string{&c.GroupKey, &c.RelayFingerprint, &c.History.PassphraseFile} {
+		if *s != "" {
+			*s = "<redacted>"
+		}
+	}
+	return &c
+}
+
+// redactLog blanks the clip attribute of every record, in case the logs
+// were written with log_clips on.
+func redactLog(data []byte) []byte {
+	var b bytes.Buffer
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for s.Scan() {
+		var rec map[string]any
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			continue
+		}
+		if clip, ok := rec["clip"].(string); ok && !strings.HasPrefix(clip, "<redacted") {
+			rec["clip"] = fmt.Sprintf("<redacted %d bytes>", len(clip))
+		}
+		line, _ := json.Marshal(rec)
+		b.Write(line)
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// redactor replaces the home directory, which usually carries the user's
+// name, with ~.
+func redactor() func([]byte) []byte {
+	home, err := os.UserHomeDir()
+	if err != nil || len(home) < 2 {
+		return func(b []byte) []byte { return b }
+	}
+	escaped, _ := json.Marshal(home)
+	escaped = escaped[1 : len(escaped)-1]
+	return func(b []byte) []byte {
+		b = bytes.ReplaceAll(b, escaped, []byte("~"))
+		return bytes.ReplaceAll(b, []byte(home), []byte("~"))
+	}
+}
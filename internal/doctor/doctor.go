@@ -0,0 +1,253 @@
+// Package doctor runs the checks behind `clipsync doctor`: everything
+// that commonly stops sync from working, each with a hint on fixing it.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/config"
+	"clipsync/internal/globals"
+	"clipsync/internal/ipc"
+	"clipsync/internal/network"
+	"clipsync/internal/ping"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	OK   Status = "ok"
+	Warn Status = "warn"
+	Fail Status = "fail"
+	Skip Status = "skip"
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name   string `json:"name" yaml:"name"`
+	Status Status `json:"status" yaml:"status"`
+	Detail string `json:"detail" yaml:"detail"`
+	Hint   string `json:"hint,omitempty" yaml:"hint,omitempty"`
+}
+
+// Report is the outcome of every check.
+type Report struct {
+	OS      string   `json:"os" yaml:"os"`
+	Arch    string   `json:"arch" yaml:"arch"`
+	Checks  []Result `json:"checks" yaml:"checks"`
+	Failed  int      `json:"failed" yaml:"failed"`
+	Warning int      `json:"warnings" yaml:"warnings"`
+}
+
+// mdnsTimeout bounds how long the mDNS checks wait for an answer.
+const mdnsTimeout = 4 * time.Second
+
+// Run performs every check in order. Checks that need the daemon are
+// skipped when it is not running.
+func Run(ctx context.Context) *Report {
+	// Look at the interfaces the daemon would use
+	if cfg, err := config.Load(); err == nil {
+		network.Discovery.Include, network.Discovery.Exclude = cfg.Interfaces.Include, cfg.Interfaces.Exclude
+	}
+	status, err := ipc.Status()
+	running := err == nil
+
+	checks := []Result{
+		checkDaemon(status, err),
+		checkPorts(running),
+		checkInterfaces(),
+		checkMDNS(ctx, running),
+		checkClipboard(running, status),
+		checkPing(),
+	}
+	checks = append(checks, checkPeers(running)...)
+
+	r := &Report{OS: runtime.GOOS, Arch: runtime.GOARCH, Checks: checks}
+	for _, c := range checks {
+		switch c.Status {
+		case Fail:
+			r.Failed++
+		case Warn:
+			r.Warning++
+		}
+	}
+	return r
+}
+
+func checkDaemon(status *ipc.DaemonStatus, err error) Result {
+	r := Result{Name: "daemon"}
+	switch {
+	case err == nil:
+		r.Status, r.Detail = OK, fmt.Sprintf("running (PID %d)", status.PID)
+	case errors.Is(err, ipc.ErrDaemonNotRunning):
+		r.Status, r.Detail = Warn, "not running"
+		r.Hint = "Start it with 'clipsync start'."
+	default:
+		r.Status, r.Detail = Fail, err.Error()
+		r.Hint = fmt.Sprintf("Another program may be using port %d.", ipc.PORT)
+	}
+	return r
+}
+
+// checkPorts binds the sync and IPC ports. While the daemon runs it holds
+// them itself, which proves they can be bound.
+func checkPorts(running bool) Result {
+	r := Result{Name: "ports"}
+	if running {
+		r.Status, r.Detail = OK, fmt.Sprintf("UDP %d and TCP %d held by the daemon", globals.PORT, ipc.PORT)
+		return r
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{Port: globals.PORT})
+	if err != nil {
+		r.Status, r.Detail = Fail, fmt.Sprintf("cannot bind UDP %d: %v", globals.PORT, err)
+		r.Hint = "Another program is using the sync port, or a stale ClipSync process is still running."
+		return r
+	}
+	udp.Close()
+	tcp, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(ipc.PORT)))
+	if err != nil {
+		r.Status, r.Detail = Fail, fmt.Sprintf("cannot bind TCP %d: %v", ipc.PORT, err)
+		r.Hint = "Another program is using the control port."
+		return r
+	}
+	tcp.Close()
+	r.Status, r.Detail = OK, fmt.Sprintf("UDP %d and TCP %d are free", globals.PORT, ipc.PORT)
+	return r
+}
+
+func checkInterfaces() Result {
+	r := Result{Name: "interfaces"}
+	var names []string
+	for _, iface := range network.Interfaces() {
+		if iface.Flags&net.FlagMulticast != 0 {
+			names = append(names, iface.Name)
+		}
+	}
+	if len(names) == 0 {
+		r.Status, r.Detail = Fail, "no multicast-capable interface is up"
+		r.Hint = "Connect to a network. VPN and point-to-point links usually cannot carry mDNS."
+		if len(network.Discovery.Include)+len(network.Discovery.Exclude) > 0 {
+			r.Hint += " Check the interfaces include and exclude lists in the config."
+		}
+		return r
+	}
+	r.Status, r.Detail = OK, fmt.Sprintf("%d multicast-capable: %v", len(names), names)
+	return r
+}
+
+// checkMDNS looks for the daemon's own announcement, or announces a probe
+// service and looks for that when there is no daemon.
+func checkMDNS(ctx context.Context, running bool) Result {
+	r := Result{Name: "mdns"}
+	if cfg, err := config.Load(); err == nil && !config.On(cfg.Discovery.MDNS) {
+		r.Status, r.Detail = Skip, "switched off in the config"
+		return r
+	}
+	ctx, cancel := context.WithTimeout(ctx, mdnsTimeout)
+	defer cancel()
+
+	var found bool
+	var err error
+	if running {
+		host, _ := os.Hostname()
+		found, err = network.FindService(ctx, network.ServiceType, host)
+		r.Detail = "the daemon's announcement was "
+	} else {
+		found, err = network.ProbeMDNS(ctx, "_clipsync-doctor._tcp", fmt.Sprintf("clipsync-doctor-%d", os.Getpid()))
+		r.Detail = "a probe announcement was "
+	}
+	switch {
+	case err != nil:
+		r.Status, r.Detail = Fail, err.Error()
+		r.Hint = "mDNS could not start. Check that UDP 5353 is not blocked."
+	case found:
+		r.Status, r.Detail = OK, r.Detail+"seen"
+	default:
+		r.Status, r.Detail = Fail, r.Detail+"not seen"
+		r.Hint = fmt.Sprintf("Run 'clipsync firewall check' and 'clipsync firewall allow' to let mDNS (UDP 5353) and the sync ports through. Where the network filters mDNS, devices still find each other through announcements on UDP %d.", globals.DiscoveryPort)
+	}
+	return r
+}
+
+func checkClipboard(running bool, status *ipc.DaemonStatus) Result {
+	r := Result{Name: "clipboard"}
+	if err := clipboard.Init(); err != nil {
+		// The clipboard library explains itself over several paragraphs
+		detail, _, _ := strings.Cut(err.Error(), "\n")
+		detail, _, _ = strings.Cut(detail, ", ")
+		r.Status, r.Detail = Warn, detail
+		r.Hint = "No system clipboard here; ClipSync runs headless. Use 'clipsync get' and 'clipsync send', or install the X11/Wayland libraries."
+		return r
+	}
+	r.Status, r.Detail = OK, "system clipboard is available"
+	if running && status.Headless {
+		r.Status, r.Detail = Warn, "system clipboard is available but the daemon runs headless"
+		r.Hint = "Restart the daemon without --headless to sync the system clipboard."
+	}
+	return r
+}
+
+// checkPing opens the raw ICMP socket the peer liveness checks use.
+func checkPing() Result {
+	r := Result{Name: "ping"}
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		r.Status, r.Detail = Warn, "cannot open a raw ICMP socket: "+err.Error()
+		r.Hint = pingHint()
+		return r
+	}
+	conn.Close()
+	r.Status, r.Detail = OK, "raw ICMP sockets are allowed"
+	return r
+}
+
+func pingHint() string {
+	switch runtime.GOOS {
+	case "linux":
+		exe, err := os.Executable()
+		if err != nil {
+			exe = "clipsync"
+		}
+		return "Peers will be dropped as unreachable. Run 'sudo setcap cap_net_raw=+ep " + exe + "'."
+	default:
+		return "Peers will be dropped as unreachable. Run ClipSync with permission to send ICMP."
+	}
+}
+
+// checkPeers pings every device the daemon knows about.
+func checkPeers(running bool) []Result {
+	if !running {
+		return []Result{{Name: "peers", Status: Skip, Detail: "the daemon is not running"}}
+	}
+	devices, err := ipc.Devices()
+	if err != nil {
+		return []Result{{Name: "peers", Status: Fail, Detail: err.Error()}}
+	}
+	if len(devices) == 0 {
+		return []Result{{Name: "peers", Status: Warn, Detail: "no devices found",
+			Hint: "Start ClipSync on another device on this network, or add one with 'clipsync connect <ip>'."}}
+	}
+
+	var results []Result
+	for _, dev := range devices {
+		r := Result{Name: "peer " + dev.Ip}
+		if len(ping.PingIPS([]string{dev.Ip})) > 0 {
+			r.Status, r.Detail = OK, dev.Name+" answers ping"
+		} else {
+			r.Status, r.Detail = Fail, dev.Name+" does not answer ping"
+			r.Hint = "Check that the device is on, on the same network, and not blocking ICMP."
+		}
+		results = append(results, r)
+	}
+	return results
+}
@@ -0,0 +1,89 @@
+package doctor_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"clipsync/internal/config"
+	"clipsync/internal/doctor"
+	"clipsync/internal/logging"
+)
+
+func TestBundleRedactsClips(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	dir, err := logging.Dir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(dir, 0700)
+	line := `{"level":"DEBUG","msg":"Received clip","subsystem":"network","clip":"hunter2"}` + "\n"
+	if err := os.WriteFile(filepath.Join(dir, logging.FileName), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := doctor.WriteBundle(&buf, &doctor.Report{}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("logs/" + logging.FileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "redacted 7 bytes") {
+		t.Errorf("clip was not redacted: %s", data)
+	}
+}
+
+func TestBundleRedactsConfig(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("APPDATA", t.TempDir())
+
+	path, err := config.Path()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.MkdirAll(filepath.Dir(path), 0700)
+	cfg := `{"relay": "relay.example.com", "group_key": "c2VjcmV0LWdyb3VwLWtleQ", "relay_fingerprint": "ab12cd34", "history": {"persist": true, "passphrase_file": "/etc/clipsync/passphrase"}}`
+	if err := os.WriteFile(path, []byte(cfg), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := doctor.WriteBundle(&buf, &doctor.Report{}); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, _ := io.ReadAll(f)
+	for _, secret := range []string{"c2VjcmV0LWdyb3VwLWtleQ", "ab12cd34", "/etc/clipsync/passphrase"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("config.json contains %q: %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), "relay.example.com") {
+		t.Errorf("config.json lost the settings that aren't secret: %s", data)
+	}
+}
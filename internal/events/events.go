@@ -0,0 +1,75 @@
+package events
+
+import (
+	"sync"
+
+	"clipsync/internal/globals"
+)
+
+// Event types published by the engine.
+const (
+	DeviceAdded   = "device_added"
+	DeviceRemoved = "device_removed"
+	ClipAdded     = "clip_added"
+	// ClipFetched carries a pending clip once its body arrived.
+	ClipFetched = "clip_fetched"
+	// ClipUpdated carries an entry whose flags changed, e.g. once it is
+	// marked sensitive.
+	ClipUpdated = "clip_updated"
+	// TransferUpdated carries a transfer whenever it progresses or ends.
+	TransferUpdated = "transfer_updated"
+	// SyncPaused carries the reason in Reason; an empty reason means sync
+	// resumed.
+	SyncPaused = "sync_paused"
+	// MembersUpdated carries the relay group members whenever one is
+	// added, renamed or revoked.
+	MembersUpdated = "members_updated"
+)
+
+// Event is a change in engine state, streamed to IPC clients such as the
+// GUI when it runs as a thin client of the daemon.
+type Event struct {
+	Type     string            `json:"type" yaml:"type"`
+	Device   *globals.Device   `json:"device,omitempty" yaml:"device,omitempty"`
+	Clip     *globals.Clip     `json:"clip,omitempty" yaml:"clip,omitempty"`
+	Transfer *globals.Transfer `json:"transfer,omitempty" yaml:"transfer,omitempty"`
+	Reason   string            `json:"reason,omitempty" yaml:"reason,omitempty"`
+	Members  []globals.Member  `json:"members,omitempty" yaml:"members,omitempty"`
+}
+
+var (
+	mu          sync.Mutex
+	subscribers = make(map[chan Event]struct{})
+)
+
+// Publish delivers e to every subscriber. Subscribers that fall behind
+// miss events rather than stall the engine.
+func Publish(e Event) {
+	mu.Lock()
+	defer mu.Unlock()
+	for ch := range subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of future events and a function that ends
+// the subscription and closes the channel.
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+	mu.Lock()
+	subscribers[ch] = struct{}{}
+	mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mu.Lock()
+			delete(subscribers, ch)
+			mu.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,8 @@
+package firewall
+
+// SetRun makes the backends see fn's output instead of running commands.
+func SetRun(fn func(name string, args ...string) (string, error)) (restore func()) {
+	saved := run
+	run = fn
+	return func() { run = saved }
+}
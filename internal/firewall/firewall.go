@@ -0,0 +1,176 @@
+// Package firewall opens the ports ClipSync needs in the host firewall:
+// mDNS for discovery plus the sync and transfer ports. Changes are planned
+// first so they can be shown before anything is touched.
+package firewall
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"clipsync/internal/globals"
+)
+
+// ErrNoFirewall is returned when no supported firewall is installed.
+var ErrNoFirewall = errors.New("no supported firewall found")
+
+// mdnsPort is the well-known mDNS port used for discovery.
+const mdnsPort = 5353
+
+// ruleTag marks the rules ClipSync adds so they can be found again.
+const ruleTag = "clipsync"
+
+// Rule is one port ClipSync needs open for inbound traffic.
+type Rule struct {
+	Name  string `json:"name" yaml:"name"`
+	Proto string `json:"proto" yaml:"proto"`
+	Port  int    `json:"port" yaml:"port"`
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("%d/%s", r.Port, r.Proto)
+}
+
+// Rules returns the ports ClipSync needs: mDNS, the fallback discovery
+// port and the configured sync and TCP ports.
+func Rules() []Rule {
+	return []Rule{
+		{Name: "mDNS", Proto: "udp", Port: mdnsPort},
+		{Name: "discovery", Proto: "udp", Port: globals.DiscoveryPort},
+		{Name: "sync", Proto: "udp", Port: globals.PORT},
+		{Name: "transfer", Proto: "tcp", Port: globals.TCPPort},
+	}
+}
+
+// RuleState reports whether a rule lets traffic through.
+type RuleState struct {
+	Rule
+	Allowed bool `json:"allowed" yaml:"allowed"`
+}
+
+// Status describes the firewall and the ClipSync rules in it.
+type Status struct {
+	Backend string `json:"backend" yaml:"backend"`
+	// Active is false when the firewall is installed but not filtering.
+	Active bool        `json:"active" yaml:"active"`
+	Rules  []RuleState `json:"rules" yaml:"rules"`
+}
+
+// Plan lists the commands that allow or revoke the rules.
+type Plan struct {
+	Backend  string
+	Commands [][]string
+	// Notes are shown alongside the commands, e.g. about persistence.
+	Notes []string
+}
+
+// Print writes a human readable description of the plan to w.
+func (p *Plan) Print(w io.Writer) {
+	for _, cmd := range p.Commands {
+		fmt.Fprintf(w, "run %s\n", quoteArgs(cmd))
+	}
+	for _, note := range p.Notes {
+		fmt.Fprintf(w, "note: %s\n", note)
+	}
+}
+
+// Apply runs the commands in order.
+func (p *Plan) Apply() error {
+	for _, cmd := range p.Commands {
+		if _, err := run(cmd[0], cmd[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backend is a firewall ClipSync knows how to configure.
+type backend interface {
+	name() string
+	// active reports whether the firewall is filtering traffic.
+	active() bool
+	allow(rules []Rule) ([][]string, error)
+	revoke(rules []Rule) ([][]string, error)
+	allowed(rules []Rule) ([]bool, error)
+}
+
+// Check reports whether the firewall lets ClipSync's traffic through.
+// name picks a backend; empty detects one.
+func Check(name string) (*Status, error) {
+	b, err := detect(name)
+	if err != nil {
+		return nil, err
+	}
+	rules := Rules()
+	status := &Status{Backend: b.name(), Active: b.active()}
+	allowed, err := b.allowed(rules)
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range rules {
+		status.Rules = append(status.Rules, RuleState{Rule: r, Allowed: allowed[i] || !status.Active})
+	}
+	return status, nil
+}
+
+// AllowPlan returns the commands that open ClipSync's ports.
+func AllowPlan(name string) (*Plan, error) {
+	b, err := detect(name)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := b.allow(Rules())
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{Backend: b.name(), Commands: cmds}
+	if n, ok := b.(interface{ notes() []string }); ok {
+		plan.Notes = n.notes()
+	}
+	if !b.active() {
+		plan.Notes = append(plan.Notes, b.name()+" is not active; the rules take effect once it is enabled")
+	}
+	return plan, nil
+}
+
+// RevokePlan returns the commands that remove the rules AllowPlan adds.
+func RevokePlan(name string) (*Plan, error) {
+	b, err := detect(name)
+	if err != nil {
+		return nil, err
+	}
+	cmds, err := b.revoke(Rules())
+	if err != nil {
+		return nil, err
+	}
+	return &Plan{Backend: b.name(), Commands: cmds}, nil
+}
+
+// run runs a command and returns its output. Tests replace it to check
+// plans against canned firewall output.
+var run = func(name string, args ...string) (string, error) {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return string(out), fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return string(out), nil
+}
+
+func installed(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// quoteArgs joins a command for display, quoting arguments with spaces.
+func quoteArgs(cmd []string) string {
+	parts := make([]string, len(cmd))
+	for i, arg := range cmd {
+		if strings.ContainsAny(arg, " \"") {
+			arg = fmt.Sprintf("%q", arg)
+		}
+		parts[i] = arg
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,77 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const socketfilterfw = "/usr/libexec/ApplicationFirewall/socketfilterfw"
+
+func detect(name string) (backend, error) {
+	if name != "" && name != "socketfilterfw" {
+		return nil, fmt.Errorf("unknown firewall %q: want socketfilterfw", name)
+	}
+	return appFirewall{}, nil
+}
+
+// Backends lists the firewalls that can be picked by name.
+func Backends() []string {
+	return []string{"socketfilterfw"}
+}
+
+// appFirewall is the macOS application firewall. It filters by program
+// rather than by port, so every rule shares the executable's state.
+type appFirewall struct{}
+
+func (appFirewall) name() string { return "socketfilterfw" }
+
+func (appFirewall) active() bool {
+	out, err := run(socketfilterfw, "--getglobalstate")
+	return err != nil || !strings.Contains(out, "disabled")
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func (appFirewall) allow(rules []Rule) ([][]string, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{
+		{socketfilterfw, "--add", exe},
+		{socketfilterfw, "--unblockapp", exe},
+	}, nil
+}
+
+func (appFirewall) revoke(rules []Rule) ([][]string, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	return [][]string{{socketfilterfw, "--remove", exe}}, nil
+}
+
+func (appFirewall) allowed(rules []Rule) ([]bool, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	out, err := run(socketfilterfw, "--getappblocked", exe)
+	if err != nil {
+		return nil, err
+	}
+	permitted := strings.Contains(out, "permitted")
+	result := make([]bool, len(rules))
+	for i := range result {
+		result[i] = permitted
+	}
+	return result, nil
+}
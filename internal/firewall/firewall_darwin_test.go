@@ -0,0 +1,65 @@
+package firewall_test
+
+import (
+	"fmt"
+	"testing"
+
+	"clipsync/internal/firewall"
+)
+
+func TestPlansSocketfilterfw(t *testing.T) {
+	plan, err := firewall.AllowPlan("socketfilterfw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Commands) != 2 || plan.Commands[0][1] != "--add" || plan.Commands[1][1] != "--unblockapp" {
+		t.Errorf("Commands = %v, want the executable added and unblocked", plan.Commands)
+	}
+
+	plan, err = firewall.RevokePlan("socketfilterfw")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Commands) != 1 || plan.Commands[0][1] != "--remove" {
+		t.Errorf("Commands = %v, want the executable removed", plan.Commands)
+	}
+}
+
+func TestCheckSocketfilterfw(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  string
+		app    string
+		active bool
+		want   bool
+	}{
+		{"permitted", "Firewall is enabled. (State = 1)", "The application is permitted", true, true},
+		{"blocked", "Firewall is enabled. (State = 1)", "The application is blocked", true, false},
+		{"disabled", "Firewall is disabled. (State = 0)", "The application is blocked", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer firewall.SetRun(func(name string, args ...string) (string, error) {
+				switch args[0] {
+				case "--getglobalstate":
+					return tt.state, nil
+				case "--getappblocked":
+					return tt.app, nil
+				}
+				return "", fmt.Errorf("unexpected %v", args)
+			})()
+			status, err := firewall.Check("socketfilterfw")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Active != tt.active {
+				t.Errorf("Active = %v, want %v", status.Active, tt.active)
+			}
+			for _, r := range status.Rules {
+				if r.Allowed != tt.want {
+					t.Errorf("%s allowed = %v, want %v", r.Rule, r.Allowed, tt.want)
+				}
+			}
+		})
+	}
+}
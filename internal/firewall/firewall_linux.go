@@ -0,0 +1,267 @@
+package firewall
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// backends in the order they are preferred when several are installed.
+var backends = []backend{ufw{}, firewalld{}, nftables{}}
+
+// detect returns the named backend, or the first active one, or the first
+// installed one.
+func detect(name string) (backend, error) {
+	if name != "" {
+		for _, b := range backends {
+			if b.name() == name {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown firewall %q: want ufw, firewalld or nftables", name)
+	}
+	for _, b := range backends {
+		if installed(b.name()) && b.active() {
+			return b, nil
+		}
+	}
+	for _, b := range backends {
+		if installed(b.name()) {
+			return b, nil
+		}
+	}
+	return nil, ErrNoFirewall
+}
+
+// Backends lists the firewalls that can be picked by name.
+func Backends() []string {
+	return []string{"ufw", "firewalld", "nftables"}
+}
+
+type ufw struct{}
+
+func (ufw) name() string { return "ufw" }
+
+func (ufw) active() bool {
+	_, err := run("systemctl", "is-active", "--quiet", "ufw")
+	return err == nil
+}
+
+func (ufw) allow(rules []Rule) ([][]string, error) {
+	var cmds [][]string
+	for _, r := range rules {
+		cmds = append(cmds, []string{"ufw", "allow", r.String(), "comment", ruleTag + " " + r.Name})
+	}
+	return cmds, nil
+}
+
+func (ufw) revoke(rules []Rule) ([][]string, error) {
+	var cmds [][]string
+	for _, r := range rules {
+		cmds = append(cmds, []string{"ufw", "delete", "allow", r.String()})
+	}
+	return cmds, nil
+}
+
+func (ufw) allowed(rules []Rule) ([]bool, error) {
+	out, err := run("ufw", "status")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]bool, len(rules))
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[1] != "ALLOW" {
+			continue
+		}
+		for i, r := range rules {
+			if fields[0] == r.String() {
+				result[i] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+type firewalld struct{}
+
+func (firewalld) name() string { return "firewalld" }
+
+func (firewalld) active() bool {
+	_, err := run("firewall-cmd", "--state")
+	return err == nil
+}
+
+// firewalld rules go to the default zone, permanently, then get loaded.
+func (firewalld) allow(rules []Rule) ([][]string, error) {
+	var cmds [][]string
+	for _, r := range rules {
+		cmds = append(cmds, []string{"firewall-cmd", "--permanent", "--add-port=" + r.String()})
+	}
+	return append(cmds, []string{"firewall-cmd", "--reload"}), nil
+}
+
+func (firewalld) revoke(rules []Rule) ([][]string, error) {
+	var cmds [][]string
+	for _, r := range rules {
+		cmds = append(cmds, []string{"firewall-cmd", "--permanent", "--remove-port=" + r.String()})
+	}
+	return append(cmds, []string{"firewall-cmd", "--reload"}), nil
+}
+
+func (firewalld) allowed(rules []Rule) ([]bool, error) {
+	ports, err := run("firewall-cmd", "--list-ports")
+	if err != nil {
+		return nil, err
+	}
+	services, err := run("firewall-cmd", "--list-services")
+	if err != nil {
+		return nil, err
+	}
+	open := strings.Fields(ports)
+	result := make([]bool, len(rules))
+	for i, r := range rules {
+		for _, p := range open {
+			if p == r.String() {
+				result[i] = true
+			}
+		}
+		// The stock mdns service covers discovery just as well
+		if r.Port == mdnsPort && strings.Contains(" "+services+" ", " mdns ") {
+			result[i] = true
+		}
+	}
+	return result, nil
+}
+
+// nftables rules go into the base chain that filters input, tagged with a
+// comment: an accept in a chain of our own would not override a drop there.
+// Without such a chain nothing is dropped, and the rules go into a table of
+// our own, which revoke deletes whole.
+type nftables struct{}
+
+// nftOwn is the chain created when the ruleset has no input chain.
+var nftOwn = []string{"inet", ruleTag, "input"}
+
+func (nftables) name() string { return "nftables" }
+
+// nftChains returns the chain that filters input, if any, and whether our
+// own table exists.
+func nftChains() (chain []string, own bool, err error) {
+	out, err := run("nft", "-j", "list", "chains")
+	if err != nil {
+		return nil, false, err
+	}
+	var listing struct {
+		Nftables []struct {
+			Chain *struct {
+				Family string `json:"family"`
+				Table  string `json:"table"`
+				Name   string `json:"name"`
+				Type   string `json:"type"`
+				Hook   string `json:"hook"`
+			} `json:"chain"`
+		} `json:"nftables"`
+	}
+	if err := json.Unmarshal([]byte(out), &listing); err != nil {
+		return nil, false, fmt.Errorf("reading nft chains: %w", err)
+	}
+	for _, item := range listing.Nftables {
+		c := item.Chain
+		switch {
+		case c == nil || c.Type != "filter" || c.Hook != "input":
+		case c.Family == "inet" && c.Table == ruleTag:
+			own = true
+		// inet covers IPv4 and IPv6, ip only the IPv4 mDNS we use
+		case c.Family == "inet" && (chain == nil || chain[0] != "inet"), c.Family == "ip" && chain == nil:
+			chain = []string{c.Family, c.Table, c.Name}
+		}
+	}
+	return chain, own, nil
+}
+
+func (nftables) active() bool {
+	chain, _, err := nftChains()
+	return err == nil && chain != nil
+}
+
+func (nftables) allow(rules []Rule) ([][]string, error) {
+	chain, own, err := nftChains()
+	if err != nil {
+		return nil, err
+	}
+	var cmds [][]string
+	if chain == nil {
+		chain = nftOwn
+		if !own {
+			cmds = append(cmds,
+				[]string{"nft", "add", "table", "inet", ruleTag},
+				[]string{"nft", "add", "chain", "inet", ruleTag, "input", "{ type filter hook input priority 0; policy accept; }"})
+		}
+	}
+	for _, r := range rules {
+		cmd := append([]string{"nft", "add", "rule"}, chain...)
+		cmds = append(cmds, append(cmd, r.Proto, "dport", strconv.Itoa(r.Port), "accept", "comment", strconv.Quote(ruleTag)))
+	}
+	return cmds, nil
+}
+
+// nftHandle matches a rule we added in `nft -a list chain` output.
+var nftHandle = regexp.MustCompile(`(tcp|udp) dport (\d+) accept comment "` + ruleTag + `" # handle (\d+)`)
+
+// revoke deletes our rules by handle, so the ruleset must be readable, and
+// our own table if there is one.
+func (nftables) revoke(rules []Rule) ([][]string, error) {
+	chain, own, err := nftChains()
+	if err != nil {
+		return nil, err
+	}
+	var cmds [][]string
+	if chain != nil {
+		out, err := run("nft", append([]string{"-a", "list", "chain"}, chain...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range nftHandle.FindAllStringSubmatch(out, -1) {
+			cmd := append([]string{"nft", "delete", "rule"}, chain...)
+			cmds = append(cmds, append(cmd, "handle", m[3]))
+		}
+	}
+	if own {
+		cmds = append(cmds, []string{"nft", "delete", "table", "inet", ruleTag})
+	}
+	return cmds, nil
+}
+
+func (nftables) allowed(rules []Rule) ([]bool, error) {
+	result := make([]bool, len(rules))
+	chain, own, err := nftChains()
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		if !own {
+			return result, nil
+		}
+		chain = nftOwn
+	}
+	out, err := run("nft", append([]string{"list", "chain"}, chain...)...)
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.TrimSpace(line)
+		for i, r := range rules {
+			if strings.HasPrefix(line, fmt.Sprintf("%s dport %d accept", r.Proto, r.Port)) {
+				result[i] = true
+			}
+		}
+	}
+	return result, nil
+}
+
+func (nftables) notes() []string {
+	return []string{"nft rules are lost on reboot unless the ruleset is saved, e.g. 'nft list ruleset > /etc/nftables.conf'"}
+}
@@ -0,0 +1,213 @@
+package firewall_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"clipsync/internal/firewall"
+)
+
+// fakeFirewall answers the commands it knows with canned output and fails
+// the rest, as a missing firewall would.
+type fakeFirewall map[string]string
+
+func (f fakeFirewall) run(name string, args ...string) (string, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	out, ok := f[cmd]
+	if !ok {
+		return "", fmt.Errorf("%s: exit status 1", cmd)
+	}
+	return out, nil
+}
+
+func commands(cmds [][]string) []string {
+	var lines []string
+	for _, cmd := range cmds {
+		lines = append(lines, strings.Join(cmd, " "))
+	}
+	return lines
+}
+
+const (
+	nftFilterInput = `{"nftables": [{"metainfo": {"version": "1.0.9"}},
+{"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "drop"}},
+{"chain": {"family": "inet", "table": "filter", "name": "forward", "handle": 2, "type": "filter", "hook": "forward", "prio": 0, "policy": "drop"}}]}`
+	nftIptables = `{"nftables": [{"metainfo": {"version": "1.0.9"}},
+{"chain": {"family": "ip", "table": "filter", "name": "INPUT", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "drop"}}]}`
+	nftOwnTable = `{"nftables": [{"metainfo": {"version": "1.0.9"}},
+{"chain": {"family": "inet", "table": "clipsync", "name": "input", "handle": 1, "type": "filter", "hook": "input", "prio": 0, "policy": "accept"}}]}`
+	nftEmpty = `{"nftables": [{"metainfo": {"version": "1.0.9"}}]}`
+)
+
+func TestAllowPlanLinux(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		fake    fakeFirewall
+		want    []string
+	}{
+		{"ufw", "ufw", fakeFirewall{"systemctl is-active --quiet ufw": ""}, []string{
+			"ufw allow 5353/udp comment clipsync mDNS",
+			"ufw allow 9996/udp comment clipsync discovery",
+			"ufw allow 9999/udp comment clipsync sync",
+			"ufw allow 9999/tcp comment clipsync transfer",
+		}},
+		{"firewalld", "firewalld", fakeFirewall{"firewall-cmd --state": "running"}, []string{
+			"firewall-cmd --permanent --add-port=5353/udp",
+			"firewall-cmd --permanent --add-port=9996/udp",
+			"firewall-cmd --permanent --add-port=9999/udp",
+			"firewall-cmd --permanent --add-port=9999/tcp",
+			"firewall-cmd --reload",
+		}},
+		{"nftables inet filter", "nftables", fakeFirewall{"nft -j list chains": nftFilterInput}, []string{
+			`nft add rule inet filter input udp dport 5353 accept comment "clipsync"`,
+			`nft add rule inet filter input udp dport 9996 accept comment "clipsync"`,
+			`nft add rule inet filter input udp dport 9999 accept comment "clipsync"`,
+			`nft add rule inet filter input tcp dport 9999 accept comment "clipsync"`,
+		}},
+		{"nftables iptables-nft", "nftables", fakeFirewall{"nft -j list chains": nftIptables}, []string{
+			`nft add rule ip filter INPUT udp dport 5353 accept comment "clipsync"`,
+			`nft add rule ip filter INPUT udp dport 9996 accept comment "clipsync"`,
+			`nft add rule ip filter INPUT udp dport 9999 accept comment "clipsync"`,
+			`nft add rule ip filter INPUT tcp dport 9999 accept comment "clipsync"`,
+		}},
+		{"nftables without input chain", "nftables", fakeFirewall{"nft -j list chains": nftEmpty}, []string{
+			"nft add table inet clipsync",
+			"nft add chain inet clipsync input { type filter hook input priority 0; policy accept; }",
+			`nft add rule inet clipsync input udp dport 5353 accept comment "clipsync"`,
+			`nft add rule inet clipsync input udp dport 9996 accept comment "clipsync"`,
+			`nft add rule inet clipsync input udp dport 9999 accept comment "clipsync"`,
+			`nft add rule inet clipsync input tcp dport 9999 accept comment "clipsync"`,
+		}},
+		{"nftables own table", "nftables", fakeFirewall{"nft -j list chains": nftOwnTable}, []string{
+			`nft add rule inet clipsync input udp dport 5353 accept comment "clipsync"`,
+			`nft add rule inet clipsync input udp dport 9996 accept comment "clipsync"`,
+			`nft add rule inet clipsync input udp dport 9999 accept comment "clipsync"`,
+			`nft add rule inet clipsync input tcp dport 9999 accept comment "clipsync"`,
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer firewall.SetRun(tt.fake.run)()
+			plan, err := firewall.AllowPlan(tt.backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := commands(plan.Commands); !slices.Equal(got, tt.want) {
+				t.Errorf("Commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestRevokePlanLinux(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		fake    fakeFirewall
+		want    []string
+	}{
+		{"ufw", "ufw", fakeFirewall{}, []string{
+			"ufw delete allow 5353/udp",
+			"ufw delete allow 9996/udp",
+			"ufw delete allow 9999/udp",
+			"ufw delete allow 9999/tcp",
+		}},
+		{"firewalld", "firewalld", fakeFirewall{}, []string{
+			"firewall-cmd --permanent --remove-port=5353/udp",
+			"firewall-cmd --permanent --remove-port=9996/udp",
+			"firewall-cmd --permanent --remove-port=9999/udp",
+			"firewall-cmd --permanent --remove-port=9999/tcp",
+			"firewall-cmd --reload",
+		}},
+		{"nftables inet filter", "nftables", fakeFirewall{
+			"nft -j list chains": nftFilterInput,
+			"nft -a list chain inet filter input": `table inet filter {
+	chain input { # handle 1
+		type filter hook input priority filter; policy drop;
+		ct state established,related accept # handle 4
+		tcp dport 22 accept # handle 5
+		udp dport 5353 accept comment "clipsync" # handle 7
+		tcp dport 9999 accept comment "clipsync" # handle 8
+	}
+}`,
+		}, []string{
+			"nft delete rule inet filter input handle 7",
+			"nft delete rule inet filter input handle 8",
+		}},
+		{"nftables own table", "nftables", fakeFirewall{"nft -j list chains": nftOwnTable}, []string{
+			"nft delete table inet clipsync",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer firewall.SetRun(tt.fake.run)()
+			plan, err := firewall.RevokePlan(tt.backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := commands(plan.Commands); !slices.Equal(got, tt.want) {
+				t.Errorf("Commands =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestCheckLinux(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		fake    fakeFirewall
+		active  bool
+		allowed []bool
+	}{
+		{"ufw", "ufw", fakeFirewall{
+			"systemctl is-active --quiet ufw": "",
+			"ufw status": `Status: active
+
+To                         Action      From
+--                         ------      ----
+22/tcp                     ALLOW       Anywhere
+5353/udp                   ALLOW       Anywhere                   # clipsync mDNS
+9999/tcp                   ALLOW       Anywhere                   # clipsync transfer
+`,
+		}, true, []bool{true, false, false, true}},
+		{"firewalld", "firewalld", fakeFirewall{
+			"firewall-cmd --state":         "running",
+			"firewall-cmd --list-ports":    "9996/udp 9999/udp\n",
+			"firewall-cmd --list-services": "dhcpv6-client mdns ssh\n",
+		}, true, []bool{true, true, true, false}},
+		{"nftables", "nftables", fakeFirewall{
+			"nft -j list chains": nftFilterInput,
+			"nft list chain inet filter input": `table inet filter {
+	chain input {
+		type filter hook input priority filter; policy drop;
+		udp dport 9999 accept comment "clipsync"
+	}
+}`,
+		}, true, []bool{false, false, true, false}},
+		// Nothing filters input, so everything gets through
+		{"nftables without input chain", "nftables", fakeFirewall{"nft -j list chains": nftEmpty}, false, []bool{true, true, true, true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer firewall.SetRun(tt.fake.run)()
+			status, err := firewall.Check(tt.backend)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status.Active != tt.active {
+				t.Errorf("Active = %v, want %v", status.Active, tt.active)
+			}
+			var allowed []bool
+			for _, r := range status.Rules {
+				allowed = append(allowed, r.Allowed)
+			}
+			if !slices.Equal(allowed, tt.allowed) {
+				t.Errorf("Allowed = %v, want %v", allowed, tt.allowed)
+			}
+		})
+	}
+}
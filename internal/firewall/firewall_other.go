@@ -0,0 +1,12 @@
+//go:build !linux && !windows && !darwin
+
+package firewall
+
+func detect(name string) (backend, error) {
+	return nil, ErrNoFirewall
+}
+
+// Backends lists the firewalls that can be picked by name.
+func Backends() []string {
+	return nil
+}
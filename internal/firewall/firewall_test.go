@@ -0,0 +1,31 @@
+package firewall_test
+
+import (
+	"strings"
+	"testing"
+
+	"clipsync/internal/firewall"
+)
+
+func TestRules(t *testing.T) {
+	var got []string
+	for _, r := range firewall.Rules() {
+		got = append(got, r.String())
+	}
+	if strings.Join(got, " ") != "5353/udp 9996/udp 9999/udp 9999/tcp" {
+		t.Errorf("Rules = %v, want mDNS plus the sync and TCP ports", got)
+	}
+}
+
+func TestPlanPrint(t *testing.T) {
+	plan := &firewall.Plan{
+		Commands: [][]string{{"ufw", "allow", "5353/udp", "comment", "clipsync mDNS"}},
+		Notes:    []string{"ufw is not active"},
+	}
+	var b strings.Builder
+	plan.Print(&b)
+	want := "run ufw allow 5353/udp comment \"clipsync mDNS\"\nnote: ufw is not active\n"
+	if b.String() != want {
+		t.Errorf("Print = %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,105 @@
+package firewall
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+func detect(name string) (backend, error) {
+	if name != "" && name != "netsh" {
+		return nil, fmt.Errorf("unknown firewall %q: want netsh", name)
+	}
+	return netsh{}, nil
+}
+
+// Backends lists the firewalls that can be picked by name.
+func Backends() []string {
+	return []string{"netsh"}
+}
+
+// netsh manages Windows Defender Firewall rules scoped to the ClipSync
+// executable, and to the local subnet on private and domain networks, so
+// nothing is opened on a public network such as a café's. Outbound traffic
+// is allowed by default.
+type netsh struct{}
+
+// scope limits every rule to the local subnet on trusted network profiles.
+var scope = []string{"profile=private,domain", "remoteip=localsubnet"}
+
+func (netsh) name() string { return "netsh" }
+
+func (netsh) active() bool {
+	out, err := run("netsh", "advfirewall", "show", "currentprofile", "state")
+	return err != nil || !strings.Contains(strings.ToUpper(out), "OFF")
+}
+
+func ruleName(r Rule) string {
+	return fmt.Sprintf("ClipSync %s (%s %d)", r.Name, strings.ToUpper(r.Proto), r.Port)
+}
+
+func (netsh) allow(rules []Rule) ([][]string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	exe, _ = filepath.Abs(exe)
+	var cmds [][]string
+	for _, r := range rules {
+		// Rules added before they were scoped are narrowed in place
+		if _, err := run("netsh", "advfirewall", "firewall", "show", "rule", "name="+ruleName(r)); err == nil {
+			cmds = append(cmds, append([]string{"netsh", "advfirewall", "firewall", "set", "rule",
+				"name=" + ruleName(r), "new"}, scope...))
+			continue
+		}
+		cmds = append(cmds, append([]string{"netsh", "advfirewall", "firewall", "add", "rule",
+			"name=" + ruleName(r), "dir=in", "action=allow", "protocol=" + strings.ToUpper(r.Proto),
+			"localport=" + strconv.Itoa(r.Port), "program=" + exe, "enable=yes"}, scope...))
+	}
+	return cmds, nil
+}
+
+func (netsh) revoke(rules []Rule) ([][]string, error) {
+	var cmds [][]string
+	for _, r := range rules {
+		cmds = append(cmds, []string{"netsh", "advfirewall", "firewall", "delete", "rule", "name=" + ruleName(r)})
+	}
+	return cmds, nil
+}
+
+func (netsh) allowed(rules []Rule) ([]bool, error) {
+	result := make([]bool, len(rules))
+	for i, r := range rules {
+		out, err := run("netsh", "advfirewall", "firewall", "show", "rule", "name="+ruleName(r), "verbose")
+		result[i] = err == nil && scoped(out)
+	}
+	return result, nil
+}
+
+// scoped reports whether every rule netsh listed has the scope allow
+// gives it. A rule open to public networks or any address does not count.
+func scoped(out string) bool {
+	profiles, remotes := 0, 0
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.ToLower(strings.TrimSpace(value))
+		switch strings.TrimSpace(key) {
+		case "Profiles":
+			if strings.Contains(value, "public") || value == "any" {
+				return false
+			}
+			profiles++
+		case "RemoteIP":
+			if value != "localsubnet" {
+				return false
+			}
+			remotes++
+		}
+	}
+	return profiles > 0 && profiles == remotes
+}
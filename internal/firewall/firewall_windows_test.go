@@ -0,0 +1,95 @@
+package firewall_test
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"clipsync/internal/firewall"
+)
+
+func TestPlansNetsh(t *testing.T) {
+	defer firewall.SetRun(func(name string, args ...string) (string, error) {
+		return "", fmt.Errorf("not run in tests")
+	})()
+
+	plan, err := firewall.AllowPlan("netsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Commands) != 4 {
+		t.Fatalf("Commands = %v, want one rule per port", plan.Commands)
+	}
+	add := plan.Commands[0]
+	for _, want := range []string{"name=ClipSync mDNS (UDP 5353)", "dir=in", "action=allow", "protocol=UDP", "localport=5353",
+		"profile=private,domain", "remoteip=localsubnet"} {
+		if !slices.Contains(add, want) {
+			t.Errorf("add rule %v lacks %s", add, want)
+		}
+	}
+	if !slices.ContainsFunc(add, func(arg string) bool { return strings.HasPrefix(arg, "program=") }) {
+		t.Errorf("add rule %v is not scoped to the executable", add)
+	}
+
+	plan, err = firewall.RevokePlan("netsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"netsh", "advfirewall", "firewall", "delete", "rule", "name=ClipSync transfer (TCP 9999)"}
+	if got := plan.Commands[3]; !slices.Equal(got, want) {
+		t.Errorf("delete rule = %v, want %v", got, want)
+	}
+}
+
+func TestPlansNetshNarrowsOldRules(t *testing.T) {
+	defer firewall.SetRun(func(name string, args ...string) (string, error) {
+		if strings.Join(args, " ") == "advfirewall firewall show rule name=ClipSync sync (UDP 9999)" {
+			return "Rule Name: ClipSync sync (UDP 9999)\n", nil
+		}
+		return "", fmt.Errorf("exit status 1")
+	})()
+
+	// A rule from before the scope existed is narrowed, not added twice
+	plan, err := firewall.AllowPlan("netsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"netsh", "advfirewall", "firewall", "set", "rule", "name=ClipSync sync (UDP 9999)", "new",
+		"profile=private,domain", "remoteip=localsubnet"}
+	if !slices.ContainsFunc(plan.Commands, func(cmd []string) bool { return slices.Equal(cmd, want) }) {
+		t.Errorf("Commands = %v, want %v", plan.Commands, want)
+	}
+	for _, cmd := range plan.Commands {
+		if slices.Contains(cmd, "add") && slices.Contains(cmd, "name=ClipSync sync (UDP 9999)") {
+			t.Errorf("existing rule added again: %v", cmd)
+		}
+	}
+}
+
+func TestCheckNetsh(t *testing.T) {
+	defer firewall.SetRun(func(name string, args ...string) (string, error) {
+		switch strings.Join(args, " ") {
+		case "advfirewall show currentprofile state":
+			return "State                                 ON\n", nil
+		case "advfirewall firewall show rule name=ClipSync sync (UDP 9999) verbose":
+			return "Rule Name:    ClipSync sync (UDP 9999)\nProfiles:     Domain,Private\nRemoteIP:     LocalSubnet\n", nil
+		case "advfirewall firewall show rule name=ClipSync transfer (TCP 9999) verbose":
+			// Added before rules were scoped: open on public networks
+			return "Rule Name:    ClipSync transfer (TCP 9999)\nProfiles:     Domain,Private,Public\nRemoteIP:     Any\n", nil
+		}
+		return "No rules match the specified criteria.\n", fmt.Errorf("exit status 1")
+	})()
+
+	status, err := firewall.Check("netsh")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var allowed []bool
+	for _, r := range status.Rules {
+		allowed = append(allowed, r.Allowed)
+	}
+	if !status.Active || !slices.Equal(allowed, []bool{false, false, true, false}) {
+		t.Errorf("Check = active %v, allowed %v; want active, only sync allowed", status.Active, allowed)
+	}
+}
@@ -2,6 +2,7 @@ package globals
 
 import (
 	"sync"
+	"time"
 )
 
 var (
@@ -9,12 +10,18 @@ var (
 	IPS      []string
 	Recieved string
 	PORT     = 9999
-	Username string
+	// TCPPort is where peers accept TCP connections, for transfers that
+	// don't fit in a datagram.
+	TCPPort = 9999
+	// DiscoveryPort carries ClipSync's own announcements, the fallback
+	// for networks that filter mDNS.
+	DiscoveryPort = 9996
+	Username      string
 )
 
 type Device struct {
-	Name string
-	Ip   string
+	Name string `json:"name" yaml:"name"`
+	Ip   string `json:"ip" yaml:"ip"`
 }
 
 var (
@@ -22,5 +29,61 @@ var (
 	ConnDevices   []Device
 
 	ClipHistoryMu sync.Mutex
-	ClipHistory   []string
-)
\ No newline at end of file
+	ClipHistory   []Clip
+	NextClipID    = 1
+)
+
+// Clip is a single clipboard history entry. IDs increase with every entry
+// so they stay stable while the history grows.
+type Clip struct {
+	ID   int       `json:"id" yaml:"id"`
+	Data string    `json:"data" yaml:"data"`
+	Time time.Time `json:"time" yaml:"time"`
+	// Pending marks a clip a peer announced but that was not fetched yet.
+	// Data holds a preview until then, and Hash, Type and Size describe
+	// the clip.
+	Pending bool   `json:"pending,omitempty" yaml:"pending,omitempty"`
+	Hash    string `json:"hash,omitempty" yaml:"hash,omitempty"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty"`
+	Size    int    `json:"size,omitempty" yaml:"size,omitempty"`
+	// Sensitive entries, such as passwords, are never saved to disk.
+	Sensitive bool `json:"sensitive,omitempty" yaml:"sensitive,omitempty"`
+}
+
+// Transfer states.
+const (
+	TransferRunning  = "running"
+	TransferDone     = "done"
+	TransferFailed   = "failed"
+	TransferCanceled = "canceled"
+)
+
+// Transfer is a clip or set of files moving to or from a peer over TCP.
+type Transfer struct {
+	ID string `json:"id" yaml:"id"`
+	// Direction is "in" for fetches from a peer and "out" for a peer
+	// fetching from us.
+	Direction string `json:"direction" yaml:"direction"`
+	Peer      string `json:"peer" yaml:"peer"`
+	// Name describes what is transferred, e.g. "image/png" or "3 files".
+	Name string `json:"name" yaml:"name"`
+	Size int64  `json:"size" yaml:"size"`
+	Done int64  `json:"done" yaml:"done"`
+	// Speed is the average rate in bytes per second.
+	Speed   float64   `json:"speed" yaml:"speed"`
+	State   string    `json:"state" yaml:"state"`
+	Error   string    `json:"error,omitempty" yaml:"error,omitempty"`
+	Started time.Time `json:"started" yaml:"started"`
+}
+
+// Member is a device in the relay group, as known to this one.
+type Member struct {
+	// ID is derived from the device's identity key.
+	ID   string    `json:"id" yaml:"id"`
+	Name string    `json:"name" yaml:"name"`
+	Seen time.Time `json:"seen,omitzero" yaml:"seen,omitempty"`
+	// Revoked devices no longer get the group key when it is rotated.
+	Revoked bool `json:"revoked,omitempty" yaml:"revoked,omitempty"`
+	// Self marks this device.
+	Self bool `json:"self,omitempty" yaml:"self,omitempty"`
+}
@@ -0,0 +1,13 @@
+package history
+
+import "context"
+
+// SetKeyring replaces how the OS keyring is read and written until restore
+// is called.
+func SetKeyring(read func(ctx context.Context) (string, error), write func(ctx context.Context, secret string) error) (restore func()) {
+	oldRead, oldWrite := loadSecret, storeSecret
+	loadSecret, storeSecret = read, write
+	return func() { loadSecret, storeSecret = oldRead, oldWrite }
+}
+
+var ErrNoSecret = errNoSecret
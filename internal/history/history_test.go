@@ -0,0 +1,130 @@
+package history_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/history"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.enc")
+	store, err := history.Open(t.Context(), path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clips, err := store.Load(); err != nil || len(clips) != 0 {
+		t.Fatalf("Load of a missing file = %v, %v", clips, err)
+	}
+
+	now := time.Now().Round(0)
+	saved := []globals.Clip{
+		{ID: 5, Data: "newest", Time: now},
+		{ID: 4, Data: "hunter2", Time: now, Sensitive: true},
+		{ID: 3, Data: "preview…", Time: now, Pending: true, Hash: "abc"},
+		{ID: 2, Data: "older", Time: now},
+		{ID: 1, Data: "oldest", Time: now},
+	}
+	if err := store.Save(saved, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"newest", "hunter2", "older"} {
+		if bytes.Contains(data, []byte(s)) {
+			t.Errorf("history file contains %q in the clear", s)
+		}
+	}
+
+	// Sensitive and pending entries are skipped, then the newest two kept
+	store, err = history.Open(t.Context(), path, "correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clips, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clips) != 2 || clips[0].Data != "newest" || clips[1].Data != "older" || !clips[0].Time.Equal(now) {
+		t.Errorf("Load = %+v, want newest and older", clips)
+	}
+
+	if _, err := history.Open(t.Context(), path, ""); !errors.Is(err, history.ErrNeedPassphrase) {
+		t.Errorf("Open without the passphrase: err = %v, want ErrNeedPassphrase", err)
+	}
+	wrong, err := history.Open(t.Context(), path, "battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wrong.Load(); !errors.Is(err, history.ErrLocked) {
+		t.Errorf("Load with the wrong passphrase: err = %v, want ErrLocked", err)
+	}
+
+	data[len(data)-1] ^= 1
+	os.WriteFile(path, data, 0600)
+	if _, err := store.Load(); !errors.Is(err, history.ErrLocked) {
+		t.Errorf("Load of a tampered file: err = %v, want ErrLocked", err)
+	}
+}
+
+func TestKeyringReadFailure(t *testing.T) {
+	var secret string
+	writes := 0
+	working := func(context.Context) (string, error) {
+		if secret == "" {
+			return "", history.ErrNoSecret
+		}
+		return secret, nil
+	}
+	write := func(_ context.Context, s string) error {
+		writes++
+		secret = s
+		return nil
+	}
+	defer history.SetKeyring(working, write)()
+
+	path := filepath.Join(t.TempDir(), "history.enc")
+	store, err := history.Open(t.Context(), path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Save([]globals.Clip{{ID: 1, Data: "kept", Time: time.Now()}}, 10); err != nil {
+		t.Fatal(err)
+	}
+	if writes != 1 {
+		t.Fatalf("New file stored %d keys, want 1", writes)
+	}
+
+	// A keyring that fails to answer, or answers that it has no key, must
+	// not get a new key over the one the file needs
+	for _, read := range []func(context.Context) (string, error){
+		func(context.Context) (string, error) { return "", history.ErrNoKeyring },
+		func(context.Context) (string, error) { return "", history.ErrNoSecret },
+	} {
+		history.SetKeyring(read, write)
+		if _, err := history.Open(t.Context(), path, ""); err == nil {
+			t.Error("Open succeeded without the key")
+		}
+	}
+	if writes != 1 {
+		t.Errorf("Failed reads stored %d more keys", writes-1)
+	}
+
+	history.SetKeyring(working, write)
+	store, err = history.Open(t.Context(), path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clips, err := store.Load(); err != nil || len(clips) != 1 || clips[0].Data != "kept" {
+		t.Errorf("Load after failed reads = %+v, %v", clips, err)
+	}
+}
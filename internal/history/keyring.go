@@ -0,0 +1,67 @@
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// The history key is kept in the OS keyring under this service and
+// account: the Secret Service on Linux, the login Keychain on macOS and the
+// Credential Manager on Windows.
+const (
+	keyringService = "clipsync"
+	keyringAccount = "history"
+)
+
+// ErrNoKeyring is returned where no OS keyring can be reached, e.g. on a
+// server without a Secret Service or over SSH.
+var ErrNoKeyring = errors.New("no OS keyring available")
+
+// errNoSecret is returned by readSecret when the keyring holds no key yet.
+var errNoSecret = errors.New("no history key in the keyring")
+
+// ErrNoKey is returned for a history file whose key is not in the keyring.
+// The keyring is left alone, so a key that only failed to load is never
+// replaced.
+var ErrNoKey = errors.New("the history key is missing from the OS keyring; move the history file away to start a new one")
+
+// The keyring is reached through these, which tests replace.
+var (
+	loadSecret  = readSecret
+	storeSecret = writeSecret
+)
+
+// keyringKey returns the history key from the OS keyring. It never writes
+// to the keyring.
+func keyringKey(ctx context.Context) ([]byte, error) {
+	secret, err := loadSecret(ctx)
+	if errors.Is(err, errNoSecret) {
+		return nil, ErrNoKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("history key in the keyring is malformed")
+	}
+	return key, nil
+}
+
+// newKeyringKey returns the history key for a new file: the one in the OS
+// keyring, or a new one stored there when it holds none.
+func newKeyringKey(ctx context.Context) ([]byte, error) {
+	key, err := keyringKey(ctx)
+	if !errors.Is(err, ErrNoKey) {
+		return key, err
+	}
+	key = make([]byte, 32)
+	rand.Read(key)
+	if err := storeSecret(ctx, base64.StdEncoding.EncodeToString(key)); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
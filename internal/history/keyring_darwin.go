@@ -0,0 +1,36 @@
+package history
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// errSecItemNotFound is the exit status of security when there is no
+// such item.
+const errSecItemNotFound = 44
+
+func readSecret(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "security", "find-generic-password", "-s", keyringService, "-a", keyringAccount, "-w").Output()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(out)), nil
+	case errors.As(err, &exit) && exit.ExitCode() == errSecItemNotFound:
+		return "", errNoSecret
+	}
+	return "", fmt.Errorf("%w: %v", ErrNoKeyring, err)
+}
+
+func writeSecret(ctx context.Context, secret string) error {
+	// With -w last, security prompts for the password and its confirmation
+	// on standard input, so the key never shows in the process list
+	cmd := exec.CommandContext(ctx, "security", "add-generic-password", "-U", "-s", keyringService, "-a", keyringAccount, "-l", "ClipSync history key", "-w")
+	cmd.Stdin = strings.NewReader(secret + "\n" + secret + "\n")
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %v", ErrNoKeyring, err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package history
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// secret-tool talks to the Secret Service (GNOME Keyring, KWallet, ...)
+// over D-Bus.
+
+func readSecret(ctx context.Context) (string, error) {
+	if _, err := exec.LookPath("secret-tool"); err != nil {
+		return "", fmt.Errorf("%w: secret-tool not found", ErrNoKeyring)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "secret-tool", "lookup", "service", keyringService, "account", keyringAccount)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	var exit *exec.ExitError
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(out)), nil
+	case errors.As(err, &exit) && exit.ExitCode() == 1 && stderr.Len() == 0 && ctx.Err() == nil:
+		// A lookup that finds nothing exits 1 without a message. Anything
+		// else, such as a missing D-Bus session or a killed lookup, is an
+		// error, and Open never replaces a key over one
+		return "", errNoSecret
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoKeyring, strings.TrimSpace(cmp.Or(stderr.String(), err.Error())))
+}
+
+func writeSecret(ctx context.Context, secret string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "secret-tool", "store", "--label=ClipSync history key", "service", keyringService, "account", keyringAccount)
+	cmd.Stdin = strings.NewReader(secret)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%w: %s", ErrNoKeyring, strings.TrimSpace(cmp.Or(stderr.String(), err.Error())))
+	}
+	return nil
+}
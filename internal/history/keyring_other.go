@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package history
+
+import "context"
+
+func readSecret(ctx context.Context) (string, error) {
+	return "", ErrNoKeyring
+}
+
+func writeSecret(ctx context.Context, secret string) error {
+	return ErrNoKeyring
+}
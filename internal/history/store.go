@@ -0,0 +1,178 @@
+// Package history keeps the clipboard history on disk across restarts.
+// The file is encrypted with a key held in the OS keyring, or derived from
+// a passphrase on machines without one, and entries marked sensitive are
+// never written to it.
+package history
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"clipsync/internal/globals"
+)
+
+// The file starts with a header naming where its key comes from, which is
+// authenticated along with the entries: version, key source, salt, nonce,
+// then the ciphertext.
+const (
+	fileVersion = 1
+	saltSize    = 16
+	headerSize  = 2 + saltSize
+
+	// Where the key comes from.
+	fromKeyring    byte = 1
+	fromPassphrase byte = 2
+
+	// pbkdf2Rounds follows the OWASP recommendation for PBKDF2-SHA256.
+	pbkdf2Rounds = 600_000
+)
+
+var (
+	// ErrLocked is returned when the history file can't be decrypted with
+	// the key at hand.
+	ErrLocked = errors.New("history could not be decrypted: wrong key or passphrase, or the file is corrupted")
+	// ErrNeedPassphrase is returned for a history file encrypted with a
+	// passphrase when none was given.
+	ErrNeedPassphrase = errors.New("history is encrypted with a passphrase, set CLIPSYNC_HISTORY_PASSPHRASE or history.passphrase_file")
+)
+
+// Store is an encrypted history file.
+type Store struct {
+	path   string
+	header []byte
+	aead   cipher.AEAD
+}
+
+// Open opens the history file at path, which is created on the first Save.
+// A new file is keyed from passphrase if one is set, for machines without
+// a keyring, and from the OS keyring otherwise. An existing file keeps the
+// kind of key it was created with, and only ever reads the keyring.
+func Open(ctx context.Context, path, passphrase string) (*Store, error) {
+	header, err := readHeader(path)
+	var key []byte
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		header = make([]byte, headerSize)
+		header[0], header[1] = fileVersion, fromPassphrase
+		if passphrase != "" {
+			rand.Read(header[2:])
+			key, err = passphraseKey(passphrase, header[2:])
+			break
+		}
+		header[1] = fromKeyring
+		if key, err = newKeyringKey(ctx); err != nil {
+			return nil, fmt.Errorf("%w; set a history passphrase instead", err)
+		}
+	case err != nil:
+		return nil, err
+	case header[1] == fromKeyring:
+		key, err = keyringKey(ctx)
+	case header[1] == fromPassphrase:
+		if passphrase == "" {
+			return nil, ErrNeedPassphrase
+		}
+		key, err = passphraseKey(passphrase, header[2:])
+	default:
+		err = ErrLocked
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{path: path, header: header, aead: aead}, nil
+}
+
+func passphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	return pbkdf2.Key(sha256.New, passphrase, salt, pbkdf2Rounds, 32)
+}
+
+// readHeader returns the header of the history file at path.
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(f, header); err != nil || header[0] != fileVersion {
+		return nil, ErrLocked
+	}
+	return header, nil
+}
+
+// Load returns the saved entries, newest first. A missing file holds none.
+func (s *Store) Load() ([]globals.Clip, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	n := s.aead.NonceSize()
+	if len(data) < headerSize+n {
+		return nil, ErrLocked
+	}
+	plain, err := s.aead.Open(nil, data[headerSize:headerSize+n], data[headerSize+n:], data[:headerSize])
+	if err != nil {
+		return nil, ErrLocked
+	}
+	var clips []globals.Clip
+	if err := json.Unmarshal(plain, &clips); err != nil {
+		return nil, fmt.Errorf("history file is malformed: %w", err)
+	}
+	return clips, nil
+}
+
+// Save replaces the file with the newest limit entries of history, newest
+// first. Sensitive entries, and pending ones whose body never arrived,
+// are left out.
+func (s *Store) Save(history []globals.Clip, limit int) error {
+	clips := []globals.Clip{}
+	for _, c := range history {
+		if len(clips) == limit {
+			break
+		}
+		if !c.Sensitive && !c.Pending {
+			clips = append(clips, c)
+		}
+	}
+	plain, err := json.Marshal(clips)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	data := append(slices.Clone(s.header), nonce...)
+	data = s.aead.Seal(data, nonce, plain, s.header)
+
+	// Write a new file and swap it in, so a crash never leaves half of one
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
@@ -1,14 +0,0 @@
-package init
-
-import (
-	"log"
-	"os/exec"
-)
-
-func AllowFirewall(){
-	cmd := exec.Command("start", )
-	err := cmd.Run()
-	if err != nil{
-		log.Println(err)
-	}
-}
\ No newline at end of file
@@ -0,0 +1,309 @@
+// Package install copies the ClipSync binary to a standard location and
+// puts that directory on the user's PATH, in a way that can be undone.
+// Every change is planned first so it can be shown before it is made.
+package install
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Lines ClipSync adds to shell startup files are wrapped in these markers
+// so uninstall can take them out again without touching anything else.
+const (
+	beginMarker = "# >>> clipsync >>>"
+	endMarker   = "# <<< clipsync <<<"
+)
+
+// Options configures install and uninstall.
+type Options struct {
+	// Dir is where the binary goes. Empty picks the platform default.
+	Dir string
+}
+
+// Copy is the binary being installed.
+type Copy struct {
+	From string
+	To   string
+}
+
+// Edit is a change to a shell startup file.
+type Edit struct {
+	Path    string
+	Added   []string
+	Removed []string
+	// content is the file after the edit.
+	content []byte
+	// removeEmpty deletes the file instead of leaving it empty, for files
+	// ClipSync may have created itself.
+	removeEmpty bool
+}
+
+// PathChange adds or removes a directory from the persistent user PATH
+// where that isn't done through shell files, i.e. on Windows.
+type PathChange struct {
+	Dir string
+	Add bool
+}
+
+// Plan lists the changes an install or uninstall makes. Apply performs
+// them in field order.
+type Plan struct {
+	Copy     *Copy
+	Edits    []Edit
+	UserPath *PathChange
+	Remove   []string
+	Notes    []string
+}
+
+// Empty reports whether there is nothing to do.
+func (p *Plan) Empty() bool {
+	return p.Copy == nil && len(p.Edits) == 0 && p.UserPath == nil && len(p.Remove) == 0
+}
+
+// Print writes a human readable description of the plan to w.
+func (p *Plan) Print(w io.Writer) {
+	if p.Copy != nil {
+		fmt.Fprintf(w, "copy %s -> %s\n", p.Copy.From, p.Copy.To)
+	}
+	for _, e := range p.Edits {
+		fmt.Fprintf(w, "edit %s:\n", e.Path)
+		for _, line := range e.Removed {
+			fmt.Fprintf(w, "  - %s\n", line)
+		}
+		for _, line := range e.Added {
+			fmt.Fprintf(w, "  + %s\n", line)
+		}
+	}
+	if c := p.UserPath; c != nil {
+		if c.Add {
+			fmt.Fprintf(w, "add %s to the user PATH\n", c.Dir)
+		} else {
+			fmt.Fprintf(w, "remove %s from the user PATH\n", c.Dir)
+		}
+	}
+	for _, path := range p.Remove {
+		fmt.Fprintf(w, "remove %s\n", path)
+	}
+	for _, note := range p.Notes {
+		fmt.Fprintf(w, "note: %s\n", note)
+	}
+}
+
+// Apply makes the changes.
+func (p *Plan) Apply() error {
+	if p.Copy != nil {
+		if err := copyBinary(p.Copy.From, p.Copy.To); err != nil {
+			return err
+		}
+	}
+	for _, e := range p.Edits {
+		if err := e.apply(); err != nil {
+			return err
+		}
+	}
+	if c := p.UserPath; c != nil {
+		if err := setUserPath(c.Dir, c.Add); err != nil {
+			return err
+		}
+	}
+	for _, path := range p.Remove {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e Edit) apply() error {
+	if e.removeEmpty && len(bytes.TrimSpace(e.content)) == 0 {
+		err := os.Remove(e.Path)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(e.Path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(e.Path, e.content, mode)
+}
+
+// InstallPlan copies the running binary into the install directory and
+// adds that directory to PATH if it is not there yet.
+func InstallPlan(opts Options) (*Plan, error) {
+	dir, err := installDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	if isTempBuild(exe) {
+		return nil, fmt.Errorf("%s looks like a temporary 'go run' build; build or download ClipSync first", exe)
+	}
+
+	plan := &Plan{}
+	target := filepath.Join(dir, binaryName)
+	if !samePath(exe, target) {
+		plan.Copy = &Copy{From: exe, To: target}
+	}
+	if err := planPath(plan, dir, true); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// UninstallPlan removes the installed binary and everything InstallPlan
+// added to PATH.
+func UninstallPlan(opts Options) (*Plan, error) {
+	dir, err := installDir(opts)
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	target := filepath.Join(dir, binaryName)
+	if _, err := os.Stat(target); err == nil {
+		plan.Remove = append(plan.Remove, target)
+		if exe, err := executable(); err == nil && samePath(exe, target) && runningLocked {
+			plan.Notes = append(plan.Notes, "the running binary cannot delete itself; remove "+target+" once ClipSync exits")
+			plan.Remove = nil
+		}
+	}
+	if _, err := os.Stat(target + ".old"); err == nil {
+		plan.Remove = append(plan.Remove, target+".old")
+	}
+	if err := planPath(plan, dir, false); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func installDir(opts Options) (string, error) {
+	if opts.Dir != "" {
+		return filepath.Abs(opts.Dir)
+	}
+	return defaultDir()
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// isTempBuild spots binaries built by `go run` into the temp directory.
+func isTempBuild(exe string) bool {
+	tmp, err := filepath.EvalSymlinks(os.TempDir())
+	if err != nil {
+		tmp = os.TempDir()
+	}
+	rel, err := filepath.Rel(tmp, exe)
+	return err == nil && strings.HasPrefix(rel, "go-build")
+}
+
+func samePath(a, b string) bool {
+	ia, errA := os.Stat(a)
+	ib, errB := os.Stat(b)
+	if errA == nil && errB == nil {
+		return os.SameFile(ia, ib)
+	}
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// onPath reports whether dir is in the current PATH.
+func onPath(dir string) bool {
+	for _, p := range filepath.SplitList(os.Getenv("PATH")) {
+		if p != "" && strings.EqualFold(filepath.Clean(p), filepath.Clean(dir)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyBinary copies through a temporary file so a half-written binary is
+// never left at to.
+func copyBinary(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(to), ".clipsync-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0755); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return replaceFile(tmp.Name(), to)
+}
+
+// addBlock returns content with lines in a marked block, replacing any
+// block already there. changed is false if the block was already current.
+func addBlock(content []byte, lines []string) (out []byte, removed []string, changed bool) {
+	stripped, removed := stripBlock(content)
+	block := beginMarker + "\n" + strings.Join(lines, "\n") + "\n" + endMarker + "\n"
+	if slices.Equal(removed, lines) {
+		return content, nil, false
+	}
+	if len(stripped) > 0 && !bytes.HasSuffix(stripped, []byte("\n")) {
+		stripped = append(stripped, '\n')
+	}
+	if len(stripped) > 0 {
+		stripped = append(stripped, '\n')
+	}
+	return append(stripped, block...), removed, true
+}
+
+// stripBlock removes every marked block and the blank line before it,
+// returning what was inside.
+func stripBlock(content []byte) ([]byte, []string) {
+	var out []string
+	var removed []string
+	lines := strings.SplitAfter(string(content), "\n")
+	inBlock := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == beginMarker:
+			inBlock = true
+			if n := len(out); n > 0 && strings.TrimSpace(out[n-1]) == "" {
+				out = out[:n-1]
+			}
+		case trimmed == endMarker && inBlock:
+			inBlock = false
+		case inBlock:
+			removed = append(removed, strings.TrimRight(line, "\r\n"))
+		default:
+			out = append(out, line)
+		}
+	}
+	return []byte(strings.Join(out, "")), removed
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package install_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"clipsync/internal/install"
+)
+
+func TestUninstallRemovesMarkedLines(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	original := "alias ll='ls -l'\n"
+	rc := filepath.Join(home, ".bashrc")
+	content := original + "\n# >>> clipsync >>>\nexport PATH=\"$PATH:/opt/clipsync\"\n# <<< clipsync <<<\n"
+	if err := os.WriteFile(rc, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := install.UninstallPlan(install.Options{Dir: filepath.Join(home, "bin")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Edits) != 1 || plan.Edits[0].Path != rc {
+		t.Fatalf("Edits = %+v, want one edit of %s", plan.Edits, rc)
+	}
+	if err := plan.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(rc)
+	if string(got) != original {
+		t.Errorf(".bashrc = %q, want %q", got, original)
+	}
+	info, _ := os.Stat(rc)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf(".bashrc mode = %v, want it kept at 0600", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,122 @@
+package install
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+const binaryName = "clipsync.exe"
+
+// runningLocked is whether a running binary can't be deleted.
+const runningLocked = true
+
+func defaultDir() (string, error) {
+	dir := os.Getenv("LOCALAPPDATA")
+	if dir == "" {
+		return "", os.ErrNotExist
+	}
+	return filepath.Join(dir, "Programs", "ClipSync"), nil
+}
+
+// replaceFile moves a running binary out of the way first, since Windows
+// won't overwrite it but does allow renaming it.
+func replaceFile(from, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		old := to + ".old"
+		os.Remove(old)
+		if err := os.Rename(to, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(from, to)
+}
+
+// planPath adds or removes dir from the user PATH in the registry.
+func planPath(plan *Plan, dir string, add bool) error {
+	entries, err := userPath()
+	if err != nil {
+		return err
+	}
+	has := indexPath(entries, dir) >= 0
+	if has != add {
+		plan.UserPath = &PathChange{Dir: dir, Add: add}
+		if add {
+			plan.Notes = append(plan.Notes, "open a new terminal for the PATH change to take effect")
+		}
+	}
+	return nil
+}
+
+func userPath() ([]string, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, "Environment", registry.QUERY_VALUE)
+	if err != nil {
+		return nil, err
+	}
+	defer key.Close()
+	value, _, err := key.GetStringValue("Path")
+	if err == registry.ErrNotExist {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return strings.Split(value, ";"), nil
+}
+
+func indexPath(entries []string, dir string) int {
+	for i, p := range entries {
+		if p != "" && strings.EqualFold(filepath.Clean(p), filepath.Clean(dir)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func setUserPath(dir string, add bool) error {
+	entries, err := userPath()
+	if err != nil {
+		return err
+	}
+	if i := indexPath(entries, dir); add && i < 0 {
+		entries = append(entries, dir)
+	} else if !add && i >= 0 {
+		entries = append(entries[:i], entries[i+1:]...)
+	} else {
+		return nil
+	}
+
+	var kept []string
+	for _, p := range entries {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	key, err := registry.OpenKey(registry.CURRENT_USER, "Environment", registry.SET_VALUE)
+	if err != nil {
+		return err
+	}
+	defer key.Close()
+	if err := key.SetExpandStringValue("Path", strings.Join(kept, ";")); err != nil {
+		return err
+	}
+	broadcastEnvChange()
+	return nil
+}
+
+// broadcastEnvChange tells Explorer the environment changed, so programs
+// started from it afterwards see the new PATH.
+func broadcastEnvChange() {
+	const (
+		hwndBroadcast   = 0xffff
+		wmSettingChange = 0x001A
+		smtoAbortIfHung = 0x0002
+	)
+	env, _ := windows.UTF16PtrFromString("Environment")
+	proc := windows.NewLazySystemDLL("user32.dll").NewProc("SendMessageTimeoutW")
+	proc.Call(hwndBroadcast, wmSettingChange, 0, uintptr(unsafe.Pointer(env)), smtoAbortIfHung, 5000, 0)
+}
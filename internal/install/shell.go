@@ -0,0 +1,191 @@
+//go:build !windows
+
+package install
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const binaryName = "clipsync"
+
+// runningLocked is whether a running binary can't be deleted.
+const runningLocked = false
+
+func defaultDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "bin"), nil
+}
+
+func replaceFile(from, to string) error {
+	return os.Rename(from, to)
+}
+
+func setUserPath(dir string, add bool) error {
+	return errors.New("the user PATH is set through shell startup files on this platform")
+}
+
+// shellFile is a startup file PATH can be set in.
+type shellFile struct {
+	path string
+	// line returns the shell's statement appending dir to PATH.
+	line func(dir string) string
+	// create allows creating the file when it does not exist.
+	create      bool
+	removeEmpty bool
+}
+
+func shellFiles() ([]shellFile, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	xdgConfig := os.Getenv("XDG_CONFIG_HOME")
+	if xdgConfig == "" {
+		xdgConfig = filepath.Join(home, ".config")
+	}
+	files := []shellFile{
+		{path: filepath.Join(home, ".bashrc"), line: posixLine},
+		{path: filepath.Join(home, ".zshrc"), line: posixLine},
+		{path: filepath.Join(home, ".profile"), line: posixLine},
+	}
+	// Fish reads every file in conf.d, so it gets one of its own
+	fishDir := filepath.Join(xdgConfig, "fish")
+	files = append(files, shellFile{
+		path:        filepath.Join(fishDir, "conf.d", "clipsync.fish"),
+		line:        fishLine,
+		create:      exists(fishDir) || installed("fish"),
+		removeEmpty: true,
+	})
+	// Nushell keeps its config under the platform config directory
+	if config, err := os.UserConfigDir(); err == nil {
+		nuDir := filepath.Join(config, "nushell")
+		files = append(files, shellFile{
+			path:        filepath.Join(nuDir, "env.nu"),
+			line:        nuLine,
+			create:      exists(nuDir),
+			removeEmpty: true,
+		})
+	}
+	return files, nil
+}
+
+// planPath adds the shell file edits that put dir on PATH, or take it off.
+func planPath(plan *Plan, dir string, add bool) error {
+	files, err := shellFiles()
+	if err != nil {
+		return err
+	}
+	if add && onPath(dir) && !hasBlock(files) {
+		return nil
+	}
+
+	posixFound := false
+	for i, f := range files {
+		content, err := os.ReadFile(f.path)
+		found := err == nil
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		isPosix := i <= 2
+		if isPosix && found {
+			posixFound = true
+		}
+		// Fall back to creating .profile when no POSIX shell file exists yet
+		create := f.create || (i == 2 && !posixFound)
+		if add && !found && !create {
+			continue
+		}
+
+		edit := Edit{Path: f.path, removeEmpty: f.removeEmpty}
+		if add {
+			var changed bool
+			edit.content, edit.Removed, changed = addBlock(content, []string{f.line(dir)})
+			if !changed {
+				continue
+			}
+			edit.Added = []string{f.line(dir)}
+		} else {
+			if !found {
+				continue
+			}
+			edit.content, edit.Removed = stripBlock(content)
+			edit.content, edit.Removed = stripLegacy(edit.content, edit.Removed, dir)
+			if len(edit.Removed) == 0 {
+				continue
+			}
+		}
+		plan.Edits = append(plan.Edits, edit)
+	}
+	if add && len(plan.Edits) > 0 {
+		plan.Notes = append(plan.Notes, "open a new terminal for the PATH change to take effect")
+	}
+	return nil
+}
+
+// stripLegacy removes the unmarked lines older versions appended on every
+// launch, for the install directory and the running binary's directory.
+func stripLegacy(content []byte, removed []string, dir string) ([]byte, []string) {
+	dirs := []string{dir}
+	if exe, err := executable(); err == nil {
+		dirs = append(dirs, filepath.Dir(exe))
+	}
+	var out []string
+	for _, line := range strings.SplitAfter(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		legacy := false
+		for _, d := range dirs {
+			if trimmed == fmt.Sprintf(`export PATH="$PATH:%s"`, d) {
+				legacy = true
+			}
+		}
+		if legacy {
+			removed = append(removed, trimmed)
+			continue
+		}
+		out = append(out, line)
+	}
+	return []byte(strings.Join(out, "")), removed
+}
+
+func hasBlock(files []shellFile) bool {
+	for _, f := range files {
+		content, err := os.ReadFile(f.path)
+		if err == nil && strings.Contains(string(content), beginMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+func posixLine(dir string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "`", "\\`")
+	return `export PATH="$PATH:` + r.Replace(dir) + `"`
+}
+
+func fishLine(dir string) string {
+	q := "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(dir) + "'"
+	return "contains -- " + q + " $PATH; or set -gx PATH $PATH " + q
+}
+
+func nuLine(dir string) string {
+	return fmt.Sprintf("$env.PATH = ($env.PATH | split row (char esep) | append %q)", dir)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func installed(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
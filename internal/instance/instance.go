@@ -0,0 +1,89 @@
+package instance
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"clipsync/internal/logging"
+	"clipsync/internal/utils"
+)
+
+// ErrRunning is returned by Acquire when another instance holds the lock.
+var ErrRunning = errors.New("another ClipSync instance is already running")
+
+// Lock is the single-instance lock held by the running engine. The file
+// holds the owner's PID; the OS releases the lock if the process dies, so
+// a leftover file never blocks a new instance.
+type Lock struct {
+	f *os.File
+}
+
+func lockPath() (string, error) {
+	dir, err := utils.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clipsync.lock"), nil
+}
+
+// Acquire takes the single-instance lock or reports who holds it.
+func Acquire() (*Lock, error) {
+	path, err := lockPath()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := tryLock(f); err != nil {
+		pid := readPID(f)
+		f.Close()
+		return nil, fmt.Errorf("%w (PID %d)", ErrRunning, pid)
+	}
+
+	if pid := readPID(f); pid != 0 && pid != os.Getpid() {
+		logging.For(logging.Daemon).Info("Taking over stale lock", "pid", pid)
+	}
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	return &Lock{f: f}, nil
+}
+
+// Release drops the lock. The file stays: removing it would let a new
+// instance lock a fresh file while another still waits on the old one.
+func (l *Lock) Release() {
+	l.f.Truncate(0)
+	unlock(l.f)
+	l.f.Close()
+}
+
+// Running reports whether an instance currently holds the lock, and its PID.
+func Running() (int, bool) {
+	path, err := lockPath()
+	if err != nil {
+		return 0, false
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	if err := tryLock(f); err != nil {
+		return readPID(f), true
+	}
+	unlock(f)
+	return 0, false
+}
+
+func readPID(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return pid
+}
@@ -0,0 +1,38 @@
+package instance_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"clipsync/internal/instance"
+)
+
+func TestSingleInstance(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+
+	lock, err := instance.Acquire()
+	if err != nil {
+		t.Fatalf("First Acquire failed: %v", err)
+	}
+
+	if _, err := instance.Acquire(); !errors.Is(err, instance.ErrRunning) {
+		t.Errorf("Second Acquire got %v, want ErrRunning", err)
+	}
+	if pid, running := instance.Running(); !running || pid != os.Getpid() {
+		t.Errorf("Running got (%d, %v), want (%d, true)", pid, running, os.Getpid())
+	}
+
+	lock.Release()
+	if _, running := instance.Running(); running {
+		t.Error("Running still true after Release")
+	}
+
+	// The file left behind must not block the next instance
+	lock, err = instance.Acquire()
+	if err != nil {
+		t.Fatalf("Acquire after Release failed: %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,99 @@
+package ipc
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"clipsync/internal/utils"
+)
+
+// The API is only for the user running the daemon. Every request must carry
+// the token the daemon writes to its state directory on start, which only
+// that user can read. Requests from browsers are refused outright: they
+// carry an Origin, or a Host other than loopback when a page rebinds its
+// DNS name to 127.0.0.1.
+
+// tokenFile is the name of the token file in the state directory.
+const tokenFile = "ipc.token"
+
+// ErrUnauthorized is returned when the daemon refused our token, e.g.
+// because it runs as another user.
+var ErrUnauthorized = errors.New("daemon refused the request: it runs as another user, or its token could not be read")
+
+// TokenPath returns the location of the token file.
+func TokenPath() (string, error) {
+	dir, err := utils.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, tokenFile), nil
+}
+
+// newToken writes a fresh token for this run of the daemon.
+func newToken() (string, error) {
+	path, err := TokenPath()
+	if err != nil {
+		return "", err
+	}
+	token := rand.Text()
+	// Replace rather than rewrite, so a file left readable by others is not
+	// reused
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, os.Rename(tmp, path)
+}
+
+// authorize adds the token to a request to the daemon. Without a token
+// file the request goes out bare and is refused.
+func authorize(req *http.Request) {
+	path, err := TokenPath()
+	if err != nil {
+		return
+	}
+	token, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+}
+
+// guard lets through requests from local clients holding token. open
+// paths, such as /metrics for scrapers, need no token but are still closed
+// to browsers.
+func guard(next http.Handler, token string, open ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Origin") != "" || !loopbackHost(r.Host) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		given, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 && !slices.Contains(open, r.URL.Path) {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// loopbackHost reports whether a Host header names this machine by a
+// loopback address or localhost.
+func loopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,325 @@
+package ipc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"clipsync/internal/events"
+	"clipsync/internal/globals"
+	"clipsync/internal/network"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// IsRunning reports whether a daemon answers on the IPC port.
+func IsRunning() bool {
+	_, err := Status()
+	return err == nil
+}
+
+// Status checks that the daemon is up and reports how it is running.
+func Status() (*DaemonStatus, error) {
+	body, err := call(http.MethodGet, "/status", nil)
+	if err != nil {
+		return nil, err
+	}
+	status := &DaemonStatus{}
+	if err := json.Unmarshal(body, status); err != nil || status.App != appName {
+		return nil, fmt.Errorf("%w: port %d is held by another program", ErrDaemonNotRunning, PORT)
+	}
+	return status, nil
+}
+
+// Clipboard returns the daemon's current clipboard contents.
+func Clipboard() (string, error) {
+	body, err := call(http.MethodGet, "/clipboard", nil)
+	return string(body), err
+}
+
+// SendClipboard puts data on the daemon's clipboard, which syncs it to peers.
+func SendClipboard(data string) error {
+	_, err := callBody(http.MethodPost, "/clipboard", nil, strings.NewReader(data))
+	return err
+}
+
+// SendSensitive is SendClipboard for a clip that must never be saved to
+// disk, such as a password.
+func SendSensitive(data string) error {
+	_, err := callBody(http.MethodPost, "/clipboard", url.Values{"sensitive": {"1"}}, strings.NewReader(data))
+	return err
+}
+
+// Devices returns the devices the daemon has discovered.
+func Devices() ([]globals.Device, error) {
+	body, err := call(http.MethodGet, "/devices", nil)
+	if err != nil {
+		return nil, err
+	}
+	var devices []globals.Device
+	if err := json.Unmarshal(body, &devices); err != nil {
+		return nil, fmt.Errorf("failed to parse response from daemon: %w", err)
+	}
+	return devices, nil
+}
+
+// History returns the daemon's clipboard history, newest first.
+func History() ([]globals.Clip, error) {
+	body, err := call(http.MethodGet, "/history", nil)
+	if err != nil {
+		return nil, err
+	}
+	var history []globals.Clip
+	if err := json.Unmarshal(body, &history); err != nil {
+		return nil, fmt.Errorf("failed to parse response from daemon: %w", err)
+	}
+	return history, nil
+}
+
+// CopyHistory puts the history entry with the given id back on the clipboard.
+func CopyHistory(id int) error {
+	_, err := call(http.MethodPost, "/history/copy", url.Values{"id": {strconv.Itoa(id)}})
+	return err
+}
+
+// MarkSensitive keeps the history entry with the given id from being saved
+// to disk.
+func MarkSensitive(id int) error {
+	_, err := call(http.MethodPost, "/history/sensitive", url.Values{"id": {strconv.Itoa(id)}})
+	return err
+}
+
+// Events streams engine events from the daemon until ctx is done or the
+// daemon goes away, at which point the channel is closed.
+func Events(ctx context.Context) (<-chan events.Event, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL()+"/events", nil)
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+	// No timeout: the stream stays open for the life of the daemon
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, ErrUnauthorized
+		}
+		return nil, fmt.Errorf("daemon returned %d for event stream", resp.StatusCode)
+	}
+
+	ch := make(chan events.Event)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var e events.Event
+			if err := dec.Decode(&e); err != nil {
+				return
+			}
+			select {
+			case ch <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// LogQuery selects which daemon log lines Logs returns.
+type LogQuery struct {
+	// Lines is how many past lines to start with.
+	Lines int
+	// Level is the minimum level: debug, info, warn or error.
+	Level string
+	// Subsystem limits the lines to one subsystem, e.g. network.
+	Subsystem string
+	// Follow keeps the stream open for new lines.
+	Follow bool
+}
+
+// Logs calls fn with each JSON log line the daemon sends until the stream
+// ends, ctx is done or fn returns an error.
+func Logs(ctx context.Context, q LogQuery, fn func(line []byte) error) error {
+	query := url.Values{"lines": {strconv.Itoa(q.Lines)}}
+	if q.Level != "" {
+		query.Set("level", q.Level)
+	}
+	if q.Subsystem != "" {
+		query.Set("subsystem", q.Subsystem)
+	}
+	if q.Follow {
+		query.Set("follow", "1")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL()+"/logs?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	authorize(req)
+	// No timeout: a followed stream stays open until the caller gives up
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return ErrDaemonNotRunning
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%w: %s", ErrBadRequest, strings.TrimSpace(string(msg)))
+	case http.StatusUnauthorized:
+		return ErrUnauthorized
+	default:
+		return fmt.Errorf("daemon returned %d for log stream", resp.StatusCode)
+	}
+
+	s := bufio.NewScanner(resp.Body)
+	s.Buffer(make([]byte, 64<<10), 1<<20)
+	for s.Scan() {
+		if err := fn(s.Bytes()); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return s.Err()
+}
+
+// Connect asks the daemon to handshake with the device at ip.
+func Connect(ip string) error {
+	_, err := call(http.MethodPost, "/connect", url.Values{"ip": {ip}})
+	return err
+}
+
+// StaticPeers returns the configured static peers and what they resolved to.
+func StaticPeers() ([]network.StaticPeer, error) {
+	body, err := call(http.MethodGet, "/peers", nil)
+	if err != nil {
+		return nil, err
+	}
+	var peers []network.StaticPeer
+	if err := json.Unmarshal(body, &peers); err != nil {
+		return nil, err
+	}
+	return peers, nil
+}
+
+// ReloadPeers makes the daemon pick up changes to the static peer list.
+func ReloadPeers() error {
+	_, err := call(http.MethodPost, "/peers/reload", nil)
+	return err
+}
+
+// Transfers returns the daemon's running and recently finished transfers,
+// oldest first.
+func Transfers() ([]globals.Transfer, error) {
+	body, err := call(http.MethodGet, "/transfers", nil)
+	if err != nil {
+		return nil, err
+	}
+	var transfers []globals.Transfer
+	if err := json.Unmarshal(body, &transfers); err != nil {
+		return nil, fmt.Errorf("failed to parse response from daemon: %w", err)
+	}
+	return transfers, nil
+}
+
+// CancelTransfer stops the running transfer with the given id.
+func CancelTransfer(id string) error {
+	_, err := call(http.MethodPost, "/transfers/cancel", url.Values{"id": {id}})
+	return err
+}
+
+// RelayMembers returns the members of the relay group the daemon syncs
+// through.
+func RelayMembers() ([]globals.Member, error) {
+	body, err := call(http.MethodGet, "/relay/members", nil)
+	if err != nil {
+		return nil, err
+	}
+	var members []globals.Member
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, fmt.Errorf("failed to parse response from daemon: %w", err)
+	}
+	return members, nil
+}
+
+// RotateRelay replaces the relay group key, revoking the members with the
+// given IDs, and returns the new key.
+func RotateRelay(revoke []string) (string, error) {
+	body, err := call(http.MethodPost, "/relay/rotate", url.Values{"revoke": revoke})
+	if err != nil {
+		return "", err
+	}
+	var res struct {
+		GroupKey string `json:"group_key"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return "", fmt.Errorf("failed to parse response from daemon: %w", err)
+	}
+	return res.GroupKey, nil
+}
+
+// Stop asks the daemon to shut down.
+func Stop() error {
+	_, err := call(http.MethodPost, "/stop", nil)
+	return err
+}
+
+// call performs a request against the daemon and maps failures onto the
+// package's error classes so callers can pick an exit code.
+func call(method, path string, query url.Values) ([]byte, error) {
+	return callBody(method, path, query, nil)
+}
+
+func callBody(method, path string, query url.Values, body io.Reader) ([]byte, error) {
+	u := baseURL() + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	authorize(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, ErrDaemonNotRunning
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	msg := strings.TrimSpace(string(respBody))
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return respBody, nil
+	case resp.StatusCode == http.StatusBadRequest:
+		return nil, fmt.Errorf("%w: %s", ErrBadRequest, msg)
+	case resp.StatusCode == http.StatusBadGateway:
+		return nil, fmt.Errorf("%w: %s", ErrPeerUnreachable, msg)
+	case resp.StatusCode == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case resp.StatusCode == http.StatusConflict:
+		// The daemon can't do it in its current state, e.g. while paused
+		return nil, errors.New(msg)
+	default:
+		return nil, fmt.Errorf("daemon returned %d: %s", resp.StatusCode, msg)
+	}
+}
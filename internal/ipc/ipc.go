@@ -0,0 +1,42 @@
+package ipc
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PORT is the loopback port the daemon serves its control API on.
+const PORT = 9998
+
+var (
+	// ErrDaemonNotRunning is returned when nothing answers on the IPC port.
+	ErrDaemonNotRunning = errors.New("daemon is not running")
+	// ErrPeerUnreachable is returned when the daemon could not reach a peer.
+	ErrPeerUnreachable = errors.New("peer is unreachable")
+	// ErrBadRequest is returned when the daemon rejected the arguments.
+	ErrBadRequest = errors.New("bad request")
+)
+
+func baseURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", PORT)
+}
+
+// appName identifies a ClipSync daemon on /status, so another program that
+// happens to hold the port is not mistaken for one.
+const appName = "clipsync"
+
+// DaemonStatus is what the daemon reports about itself on /status.
+type DaemonStatus struct {
+	App      string `json:"app" yaml:"app"`
+	PID      int    `json:"pid" yaml:"pid"`
+	Headless bool   `json:"headless" yaml:"headless"`
+	// Paused is why sync is paused, e.g. "untrusted network".
+	Paused string `json:"paused,omitempty" yaml:"paused,omitempty"`
+	// Relay is the relay the daemon syncs through, if any.
+	Relay          string `json:"relay,omitempty" yaml:"relay,omitempty"`
+	RelayConnected bool   `json:"relay_connected,omitempty" yaml:"relay_connected,omitempty"`
+	// Blocked maps the sources blocked for flooding to when their block
+	// ends.
+	Blocked map[string]time.Time `json:"blocked,omitempty" yaml:"blocked,omitempty"`
+}
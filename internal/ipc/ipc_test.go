@@ -0,0 +1,79 @@
+package ipc_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"clipsync/internal/ipc"
+)
+
+func TestServeRefusesForeignRequests(t *testing.T) {
+	// Keep the token away from a daemon running for the real user
+	dir := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("LOCALAPPDATA", dir)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	go ipc.Serve(ctx, ln, cancel)
+
+	path, err := ipc.TokenPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var token []byte
+	for deadline := time.Now().Add(5 * time.Second); len(token) == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("daemon did not write its token")
+		}
+		token, _ = os.ReadFile(path)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("token file mode %v is readable by others", info.Mode())
+	}
+
+	base := "http://" + ln.Addr().String()
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		want    int
+	}{
+		{"with token", http.MethodGet, "/status", map[string]string{"Authorization": "Bearer " + string(token)}, http.StatusOK},
+		{"without token", http.MethodGet, "/history", nil, http.StatusUnauthorized},
+		{"wrong token", http.MethodGet, "/clipboard", map[string]string{"Authorization": "Bearer nope"}, http.StatusUnauthorized},
+		{"from a web page", http.MethodPost, "/clipboard", map[string]string{"Authorization": "Bearer " + string(token), "Origin": "https://evil.example", "Content-Type": "text/plain"}, http.StatusForbidden},
+		{"rebound host", http.MethodGet, "/logs", map[string]string{"Authorization": "Bearer " + string(token), "Host": "evil.example:9998"}, http.StatusForbidden},
+		{"metrics without token", http.MethodGet, "/metrics", nil, http.StatusOK},
+		{"metrics from a web page", http.MethodGet, "/metrics", map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, base+tt.path, strings.NewReader("pwned"))
+		for k, v := range tt.headers {
+			if k == "Host" {
+				req.Host = v
+				continue
+			}
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s: %s %s = %d, want %d", tt.name, tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+}
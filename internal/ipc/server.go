@@ -0,0 +1,389 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"clipsync/internal/clipboard"
+	"clipsync/internal/config"
+	"clipsync/internal/events"
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+	"clipsync/internal/network"
+	"clipsync/internal/relay"
+	"clipsync/internal/view"
+)
+
+// maxClipSize is the largest clip a client may hand to the daemon. It
+// matches the largest clip that can be announced to peers.
+const maxClipSize = network.MaxOffer
+
+// connectTimeout is how long /connect waits for the peer to answer.
+const connectTimeout = 3 * time.Second
+
+var logger = logging.For(logging.IPC)
+
+// Serve runs the daemon's control API on ln, or on the loopback PORT if ln
+// is nil, until ctx is done. cancelFunc is invoked when a client asks the
+// daemon to stop.
+func Serve(ctx context.Context, ln net.Listener, cancelFunc context.CancelFunc) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		status := DaemonStatus{
+			App:      appName,
+			PID:      os.Getpid(),
+			Headless: clipboard.Headless(),
+			Paused:   network.Paused(),
+			Blocked:  network.Blocked(),
+		}
+		if c := relay.Active(); c != nil {
+			status.Relay = c.Addr
+			status.RelayConnected = c.Connected()
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+
+	mux.HandleFunc("/clipboard", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			w.Write([]byte(clipboard.CopyClipboard()))
+		case http.MethodPost, http.MethodPut:
+			data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxClipSize))
+			if err != nil {
+				http.Error(w, "Clipboard data too large", http.StatusBadRequest)
+				return
+			}
+			// The clipboard watcher picks this up and syncs it like a local copy
+			if r.URL.Query().Has("sensitive") {
+				view.ExpectSensitive(string(data))
+				clipboard.WriteSensitive(string(data))
+			} else {
+				clipboard.WriteClipboard(string(data))
+			}
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte("Sent"))
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/devices", func(w http.ResponseWriter, r *http.Request) {
+		globals.ConnDevicesMu.Lock()
+		defer globals.ConnDevicesMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		devices := globals.ConnDevices
+		if devices == nil {
+			devices = []globals.Device{}
+		}
+		json.NewEncoder(w).Encode(devices)
+	})
+
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		globals.ClipHistoryMu.Lock()
+		defer globals.ClipHistoryMu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		history := globals.ClipHistory
+		if history == nil {
+			history = []globals.Clip{}
+		}
+		json.NewEncoder(w).Encode(history)
+	})
+
+	mux.HandleFunc("/history/copy", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Missing or invalid 'id' parameter", http.StatusBadRequest)
+			return
+		}
+
+		var clip globals.Clip
+		found := false
+		globals.ClipHistoryMu.Lock()
+		for _, c := range globals.ClipHistory {
+			if c.ID == id {
+				clip, found = c, true
+				break
+			}
+		}
+		globals.ClipHistoryMu.Unlock()
+
+		if !found {
+			http.Error(w, fmt.Sprintf("No history entry with id %d", id), http.StatusBadRequest)
+			return
+		}
+		data := clip.Data
+		if clip.Pending {
+			body, err := network.FetchClip(r.Context(), clip)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Could not fetch the clip: %v", err), http.StatusBadGateway)
+				return
+			}
+			data = string(body)
+		}
+
+		// The clipboard watcher picks this up and syncs it like a local copy
+		clipboard.WriteClipboard(data)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Copied"))
+	})
+
+	mux.HandleFunc("/history/sensitive", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Missing or invalid 'id' parameter", http.StatusBadRequest)
+			return
+		}
+		if !view.MarkSensitive(id) {
+			http.Error(w, fmt.Sprintf("No history entry with id %d", id), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Marked"))
+	})
+
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		stream, unsubscribe := events.Subscribe()
+		defer unsubscribe()
+
+		// One JSON event per line for as long as the client stays connected
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		enc := json.NewEncoder(w)
+		for {
+			select {
+			case e := <-stream:
+				if err := enc.Encode(e); err != nil {
+					return
+				}
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+
+	mux.Handle("/metrics", metrics.Handler())
+
+	mux.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		level, err := logging.ParseLevel(q.Get("level"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid level %q", q.Get("level")), http.StatusBadRequest)
+			return
+		}
+		lines := 100
+		if s := q.Get("lines"); s != "" {
+			if lines, err = strconv.Atoi(s); err != nil || lines < 0 {
+				http.Error(w, "Invalid 'lines' parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		follow := q.Get("follow") == "1"
+		filter := logging.Filter{Level: level, Subsystem: q.Get("subsystem")}
+
+		// Followers see records below the configured level while attached
+		if follow {
+			defer logging.Verbose(level)()
+		}
+
+		flusher, _ := w.(http.Flusher)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		streamCtx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		go func() {
+			select {
+			case <-ctx.Done():
+				cancel()
+			case <-streamCtx.Done():
+			}
+		}()
+		logging.Tail(streamCtx, lines, filter, follow, func(line []byte) error {
+			if _, err := w.Write(append(line, '\n')); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+	})
+
+	mux.HandleFunc("/connect", func(w http.ResponseWriter, r *http.Request) {
+		ip := r.URL.Query().Get("ip")
+		if ip == "" {
+			http.Error(w, "Missing 'ip' parameter", http.StatusBadRequest)
+			return
+		}
+		if reason := network.Paused(); reason != "" {
+			http.Error(w, "Sync is paused: "+reason, http.StatusConflict)
+			return
+		}
+		host, port, err := network.ParsePeer(ip)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		addr, err := net.ResolveIPAddr("ip", host)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Could not resolve %q", host), http.StatusBadGateway)
+			return
+		}
+		ip = addr.IP.String()
+
+		logger.Info("Connecting manually", "peer", ip, "port", port)
+		since := time.Now()
+		network.AddPeer(ip, port)
+
+		// The peer says hello back once it has our handshake
+		wait, cancel := context.WithTimeout(r.Context(), connectTimeout)
+		defer cancel()
+		if !network.WaitHello(wait, ip, since) {
+			http.Error(w, fmt.Sprintf("%s did not answer; it stays a peer, so check that ClipSync runs there and connects to this device too", ip), http.StatusBadGateway)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Connected"))
+	})
+
+	mux.HandleFunc("/peers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(network.StaticPeers())
+	})
+
+	mux.HandleFunc("/peers/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		cfg, err := config.Load()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		network.SetStaticPeers(cfg.Peers)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Reloaded"))
+	})
+
+	mux.HandleFunc("/transfers", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(network.Transfers())
+	})
+
+	mux.HandleFunc("/transfers/cancel", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if err := network.CancelTransfer(id); err != nil {
+			http.Error(w, fmt.Sprintf("No running transfer with id %q", id), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Canceled"))
+	})
+
+	mux.HandleFunc("/relay/members", func(w http.ResponseWriter, r *http.Request) {
+		c := relay.Active()
+		if c == nil {
+			http.Error(w, "Not syncing through a relay", http.StatusConflict)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Group.Members())
+	})
+
+	mux.HandleFunc("/relay/rotate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		c := relay.Active()
+		if c == nil {
+			http.Error(w, "Not syncing through a relay", http.StatusConflict)
+			return
+		}
+		key, err := c.Rotate(r.URL.Query()["revoke"])
+		switch {
+		case errors.Is(err, relay.ErrUnknownMember), errors.Is(err, relay.ErrRevokeSelf):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, relay.ErrNoIdentity):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Could not rotate the group key: %v", err), http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"group_key": key})
+	})
+
+	mux.HandleFunc("/stop", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Stopping daemon..."))
+
+		// The engine shuts down gracefully and the process exits once it is done
+		cancelFunc()
+	})
+
+	token, err := newToken()
+	if err != nil {
+		logger.Error("Could not write the IPC token", logging.Err(err))
+		os.Exit(1)
+	}
+	server := &http.Server{
+		Addr:    fmt.Sprintf("127.0.0.1:%d", PORT),
+		Handler: guard(mux, token, "/metrics"),
+	}
+
+	if ln == nil {
+		ln, err = net.Listen("tcp", server.Addr)
+		if err != nil {
+			logger.Error("IPC server failed", logging.Err(err))
+			os.Exit(1)
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("Starting IPC server", "addr", ln.Addr().String())
+	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+		logger.Error("IPC server failed", logging.Err(err))
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,259 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"clipsync/internal/utils"
+)
+
+// Subsystems that tag every record they log.
+const (
+	Network   = "network"
+	Discovery = "discovery"
+	Clipboard = "clipboard"
+	IPC       = "ipc"
+	Sync      = "sync"
+	Daemon    = "daemon"
+	Relay     = "relay"
+)
+
+// Subsystems lists every subsystem, for filtering and completion.
+var Subsystems = []string{Network, Discovery, Clipboard, IPC, Sync, Daemon, Relay}
+
+const (
+	// FileName is the active log file in the log directory.
+	FileName = "clipsync.log"
+	// GUIFileName is the log file of the GUI, which rotates its own file
+	// rather than sharing the daemon's.
+	GUIFileName = "clipsync-gui.log"
+	// maxSize is the size at which the log file is rotated.
+	maxSize = 5 << 20
+	// maxBackups is how many rotated files are kept.
+	maxBackups = 3
+)
+
+// Options configures Setup.
+type Options struct {
+	// Level is the minimum level written.
+	Level slog.Level
+	// Console, if set, also receives human readable records.
+	Console io.Writer
+	// LogClips writes clip contents to the log instead of redacting them.
+	LogClips bool
+	// File is the name of the log file in Dir, FileName if empty.
+	File string
+}
+
+var (
+	logClips bool
+	// fileName is the log file this process writes, which Tail reads.
+	fileName = FileName
+	// level is shared by every handler Setup installs.
+	level = new(slog.LevelVar)
+
+	levelMu   sync.Mutex
+	baseLevel slog.Level
+	// watchers counts readers that asked for a lower level, by level.
+	watchers = map[slog.Level]int{}
+)
+
+// Dir returns the directory the logs are written to.
+func Dir() (string, error) {
+	dir, err := utils.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "logs"), nil
+}
+
+// Setup makes slog's default logger write JSON records to the rotated log
+// file, and text records to opts.Console if set. It returns the file so the
+// caller can close it on exit.
+func Setup(opts Options) (io.Closer, error) {
+	logClips = opts.LogClips
+	if opts.File != "" {
+		fileName = opts.File
+	}
+	levelMu.Lock()
+	baseLevel = opts.Level
+	updateLevel()
+	levelMu.Unlock()
+	handlerOpts := &slog.HandlerOptions{Level: level}
+
+	var handlers []slog.Handler
+	if opts.Console != nil {
+		handlers = append(handlers, slog.NewTextHandler(opts.Console, handlerOpts))
+	}
+
+	dir, err := Dir()
+	var file *RotatingFile
+	if err == nil {
+		file, err = OpenRotating(filepath.Join(dir, fileName), maxSize, maxBackups)
+	}
+	if err == nil {
+		handlers = append(handlers, slog.NewJSONHandler(file, handlerOpts))
+	}
+
+	slog.SetDefault(slog.New(fanout(handlers)))
+	if err != nil {
+		return io.NopCloser(nil), fmt.Errorf("logging to console only: %w", err)
+	}
+	return file, nil
+}
+
+// ParseLevel turns debug, info, warn or error into a slog.Level.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	err := level.UnmarshalText([]byte(strings.ToUpper(s)))
+	return level, err
+}
+
+// Verbose lowers the level records are written at to l, if it is higher,
+// until the returned function is called. It lets a log reader see debug
+// records without restarting the daemon.
+func Verbose(l slog.Level) func() {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	watchers[l]++
+	updateLevel()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			levelMu.Lock()
+			defer levelMu.Unlock()
+			if watchers[l]--; watchers[l] == 0 {
+				delete(watchers, l)
+			}
+			updateLevel()
+		})
+	}
+}
+
+// updateLevel applies the lowest requested level. levelMu must be held.
+func updateLevel() {
+	l := baseLevel
+	for w := range watchers {
+		l = min(l, w)
+	}
+	level.Set(l)
+}
+
+// For returns a logger that tags records with the subsystem. It follows
+// whatever Setup installs, so it is safe to create in package variables.
+func For(subsystem string) *slog.Logger {
+	return slog.New(deferred{attrs: []slog.Attr{slog.String("subsystem", subsystem)}})
+}
+
+// Clip describes clip contents for the log. Contents are redacted unless
+// clip logging was turned on, since clips often hold passwords and tokens.
+func Clip(data []byte) slog.Attr {
+	if logClips {
+		return slog.String("clip", string(data))
+	}
+	return slog.String("clip", fmt.Sprintf("<redacted %d bytes>", len(data)))
+}
+
+// SensitiveClip describes a clip marked sensitive, such as a password. Its
+// contents are never logged, not even with clip logging on.
+func SensitiveClip(data []byte) slog.Attr {
+	return slog.String("clip", fmt.Sprintf("<sensitive %d bytes>", len(data)))
+}
+
+// Err is shorthand for an "error" attribute.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// deferred resolves slog's default handler at log time rather than when
+// the logger is created.
+type deferred struct {
+	attrs []slog.Attr
+}
+
+func (d deferred) Enabled(ctx context.Context, level slog.Level) bool {
+	return slog.Default().Handler().Enabled(ctx, level)
+}
+
+func (d deferred) Handle(ctx context.Context, r slog.Record) error {
+	return slog.Default().Handler().WithAttrs(d.attrs).Handle(ctx, r)
+}
+
+func (d deferred) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return deferred{attrs: append(append([]slog.Attr(nil), d.attrs...), attrs...)}
+}
+
+func (d deferred) WithGroup(name string) slog.Handler {
+	return groupHandler{parent: d, name: name}
+}
+
+// groupHandler applies a group on top of a deferred handler.
+type groupHandler struct {
+	parent deferred
+	name   string
+}
+
+func (g groupHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return g.parent.Enabled(ctx, level)
+}
+
+func (g groupHandler) Handle(ctx context.Context, r slog.Record) error {
+	return slog.Default().Handler().WithAttrs(g.parent.attrs).WithGroup(g.name).Handle(ctx, r)
+}
+
+func (g groupHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return slog.Default().Handler().WithAttrs(g.parent.attrs).WithGroup(g.name).WithAttrs(attrs)
+}
+
+func (g groupHandler) WithGroup(name string) slog.Handler {
+	return slog.Default().Handler().WithAttrs(g.parent.attrs).WithGroup(g.name).WithGroup(name)
+}
+
+// fanout sends each record to every handler.
+type fanout []slog.Handler
+
+func (f fanout) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range f {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var firstErr error
+	for _, h := range f {
+		if h.Enabled(ctx, r.Level) {
+			if err := h.Handle(ctx, r.Clone()); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	return firstErr
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithAttrs(attrs)
+	}
+	return out
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	out := make(fanout, len(f))
+	for i, h := range f {
+		out[i] = h.WithGroup(name)
+	}
+	return out
+}
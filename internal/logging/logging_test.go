@@ -0,0 +1,75 @@
+package logging_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"clipsync/internal/logging"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	f, err := logging.OpenRotating(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"first line 1234\n", "second line 123\n", "third line 1234\n", "fourth line 123\n"} {
+		if _, err := f.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth line 123\n",
+		path + ".1": "third line 1234\n",
+		path + ".2": "second line 123\n",
+	}
+	for p, content := range want {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more backups than asked for")
+	}
+}
+
+func TestRedactionAndTail(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv("LOCALAPPDATA", t.TempDir())
+
+	f, err := logging.Setup(logging.Options{Level: slog.LevelInfo})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	logging.For(logging.Network).Info("sent", logging.Clip([]byte("hunter2")))
+	logging.For(logging.Clipboard).Warn("changed")
+	logging.For(logging.Network).Debug("hidden")
+
+	var lines []string
+	err = logging.Tail(context.Background(), 10, logging.Filter{Subsystem: logging.Network}, false, func(line []byte) error {
+		lines = append(lines, string(line))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("got %d network lines, want 1: %q", len(lines), lines)
+	}
+	if strings.Contains(lines[0], "hunter2") || !strings.Contains(lines[0], "redacted 7 bytes") {
+		t.Errorf("clip was not redacted: %s", lines[0])
+	}
+}
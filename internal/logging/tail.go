@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// pollInterval is how often a followed log file is checked for new lines.
+const pollInterval = 500 * time.Millisecond
+
+// Filter selects log records by minimum level and subsystem.
+type Filter struct {
+	Level     slog.Level
+	Subsystem string
+}
+
+// Match reports whether a JSON log line passes the filter.
+func (f Filter) Match(line []byte) bool {
+	var rec struct {
+		Level     slog.Level `json:"level"`
+		Subsystem string     `json:"subsystem"`
+	}
+	if err := json.Unmarshal(line, &rec); err != nil {
+		return false
+	}
+	return rec.Level >= f.Level && (f.Subsystem == "" || rec.Subsystem == f.Subsystem)
+}
+
+// Tail calls fn with the last n lines of this process's log that match the
+// filter, oldest first. If follow is set it then keeps calling fn with new
+// lines, across rotations, until ctx is done or fn returns an error.
+func Tail(ctx context.Context, n int, filter Filter, follow bool, fn func(line []byte) error) error {
+	dir, err := Dir()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fileName)
+
+	var last [][]byte
+	keep := func(line []byte) {
+		if !filter.Match(line) {
+			return
+		}
+		last = append(last, bytes.Clone(line))
+		if len(last) > n {
+			last = last[1:]
+		}
+	}
+	// The newest backup first, so a fresh rotation doesn't hide recent lines
+	if f, err := os.Open(backupName(path, 1)); err == nil {
+		eachLine(f, keep)
+		f.Close()
+	}
+	f, err := os.Open(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var offset int64
+	if f != nil {
+		offset = eachLine(f, keep)
+		f.Seek(offset, io.SeekStart)
+		defer func() { f.Close() }()
+	}
+	for _, line := range last {
+		if err := fn(line); err != nil {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	var partial []byte
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		// Start over from the top when the file was rotated away
+		if f == nil || rotated(f, path, offset) {
+			if f != nil {
+				f.Close()
+			}
+			if f, err = os.Open(path); err != nil {
+				f = nil
+				continue
+			}
+			offset, partial = 0, nil
+		}
+		data, err := io.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		offset += int64(len(data))
+		data = append(partial, data...)
+		for {
+			i := bytes.IndexByte(data, '\n')
+			if i < 0 {
+				break
+			}
+			if line := data[:i]; filter.Match(line) {
+				if err := fn(line); err != nil {
+					return err
+				}
+			}
+			data = data[i+1:]
+		}
+		partial = bytes.Clone(data)
+	}
+}
+
+// eachLine calls fn for every complete line in r and returns the offset
+// just past the last one. A trailing partial line is left for following.
+func eachLine(r io.Reader, fn func([]byte)) int64 {
+	var read int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err != nil {
+			return read
+		}
+		read += int64(len(line))
+		fn(line[:len(line)-1])
+	}
+}
+
+// rotated reports whether path no longer refers to the open file f.
+func rotated(f *os.File, path string, offset int64) bool {
+	open, err := f.Stat()
+	if err != nil {
+		return true
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !os.SameFile(open, current) || current.Size() < offset
+}
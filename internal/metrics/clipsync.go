@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"runtime"
+
+	"clipsync/internal/globals"
+)
+
+// The daemon's metrics. Per-peer series are labelled by peer IP.
+var (
+	ClipsSent     = NewCounterVec("clipsync_clips_sent_total", "Clips sent, by peer.", "peer")
+	ClipsReceived = NewCounterVec("clipsync_clips_received_total", "Clips received, by peer.", "peer")
+	BytesSent     = NewCounterVec("clipsync_bytes_sent_total", "Clip bytes sent, by peer.", "peer")
+	BytesReceived = NewCounterVec("clipsync_bytes_received_total", "Clip bytes received, by peer.", "peer")
+	SendErrors    = NewCounterVec("clipsync_send_errors_total", "Sends that failed, by peer.", "peer")
+
+	// FramesDropped counts frames that were not delivered, by reason:
+	// oversize, unknown_kind.
+	FramesDropped = NewCounterVec("clipsync_frames_dropped_total", "Frames dropped, by reason.", "reason")
+	DecodeErrors  = NewCounter("clipsync_decode_errors_total", "Datagrams that could not be decoded.")
+
+	// FramesRejected counts datagrams turned away before they were acted
+	// on, by reason: rate_limited, oversize, unauthenticated, malformed,
+	// blocked. SourcesBlocked counts the sources blocked for breaking
+	// those rules too often.
+	FramesRejected = NewCounterVec("clipsync_frames_rejected_total", "Datagrams rejected by the receive limits, by reason.", "reason")
+	SourcesBlocked = NewCounter("clipsync_sources_blocked_total", "Sources temporarily blocked for repeated rejections.")
+
+	// ClipsCompressed and BytesSaved show what compression saves on the
+	// wire, by codec.
+	ClipsCompressed = NewCounterVec("clipsync_clips_compressed_total", "Clips sent compressed, by codec.", "codec")
+	BytesSaved      = NewCounterVec("clipsync_compression_saved_bytes_total", "Bytes saved by compressing clips, by codec.", "codec")
+
+	// ClipsOffered counts clips announced rather than sent. Peers fetch
+	// them by hash, and FetchCacheHits counts the fetches the clip cache
+	// saved.
+	ClipsOffered   = NewCounter("clipsync_clips_offered_total", "Clips announced to peers instead of sent.")
+	ClipsFetched   = NewCounterVec("clipsync_clips_fetched_total", "Announced clips fetched, by peer.", "peer")
+	FetchCacheHits = NewCounter("clipsync_fetch_cache_hits_total", "Announced clips found in the clip cache.")
+
+	SendLatency = RegisterHistogram("clipsync_send_duration_seconds", "Time to send a clip to every peer.",
+		NewHistogram(.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1))
+
+	// PeerUp is 1 while a peer answers pings and 0 once it stopped.
+	PeerUp = NewGaugeVec("clipsync_peer_up", "Whether a peer answered the last ping.", "peer")
+
+	ClipboardChanges = NewCounter("clipsync_clipboard_changes_total", "Changes to the local clipboard.")
+	ClipboardWrites  = NewCounter("clipsync_clipboard_writes_total", "Clips written to the local clipboard.")
+)
+
+func init() {
+	NewGaugeFunc("clipsync_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	NewGaugeFunc("clipsync_history_entries", "Entries in the clipboard history.", func() float64 {
+		globals.ClipHistoryMu.Lock()
+		defer globals.ClipHistoryMu.Unlock()
+		return float64(len(globals.ClipHistory))
+	})
+}
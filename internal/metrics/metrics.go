@@ -0,0 +1,237 @@
+// Package metrics keeps the daemon's counters and renders them in the
+// Prometheus text exposition format, without any external dependencies.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Add increases the counter by n.
+func (c *Counter) Add(n uint64) { c.v.Add(n) }
+
+// Inc increases the counter by one.
+func (c *Counter) Inc() { c.v.Add(1) }
+
+// Value returns the current count.
+func (c *Counter) Value() uint64 { return c.v.Load() }
+
+// CounterVec is a set of counters told apart by one label.
+type CounterVec struct {
+	label string
+	mu    sync.Mutex
+	m     map[string]*Counter
+}
+
+// With returns the counter for a label value, creating it on first use.
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = map[string]*Counter{}
+	}
+	c, ok := v.m[value]
+	if !ok {
+		c = &Counter{}
+		v.m[value] = c
+	}
+	return c
+}
+
+func (v *CounterVec) snapshot() map[string]uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := make(map[string]uint64, len(v.m))
+	for k, c := range v.m {
+		out[k] = c.Value()
+	}
+	return out
+}
+
+// GaugeVec holds the latest value per label value.
+type GaugeVec struct {
+	label string
+	mu    sync.Mutex
+	m     map[string]float64
+}
+
+// Set records the value for a label value.
+func (v *GaugeVec) Set(value string, f float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.m == nil {
+		v.m = map[string]float64{}
+	}
+	v.m[value] = f
+}
+
+// Delete forgets a label value.
+func (v *GaugeVec) Delete(value string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.m, value)
+}
+
+func (v *GaugeVec) snapshot() map[string]float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	out := make(map[string]float64, len(v.m))
+	for k, f := range v.m {
+		out[k] = f
+	}
+	return out
+}
+
+// Histogram counts observations into fixed buckets.
+type Histogram struct {
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram returns a histogram with the given upper bounds, which must
+// be sorted.
+func NewHistogram(buckets ...float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Since records the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// metric is one family in the exposition.
+type metric struct {
+	name, help, kind string
+	write            func(w io.Writer, name string)
+}
+
+var (
+	mu       sync.Mutex
+	registry []metric
+)
+
+func register(name, help, kind string, write func(w io.Writer, name string)) {
+	mu.Lock()
+	defer mu.Unlock()
+	registry = append(registry, metric{name, help, kind, write})
+}
+
+// NewCounter registers a counter.
+func NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	})
+	return c
+}
+
+// NewCounterVec registers a counter partitioned by label.
+func NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label}
+	register(name, help, "counter", func(w io.Writer, name string) {
+		snap := v.snapshot()
+		for _, k := range sortedKeys(snap) {
+			fmt.Fprintf(w, "%s{%s=%s} %d\n", name, v.label, quote(k), snap[k])
+		}
+	})
+	return v
+}
+
+// NewGaugeVec registers a gauge partitioned by label.
+func NewGaugeVec(name, help, label string) *GaugeVec {
+	v := &GaugeVec{label: label}
+	register(name, help, "gauge", func(w io.Writer, name string) {
+		snap := v.snapshot()
+		for _, k := range sortedKeys(snap) {
+			fmt.Fprintf(w, "%s{%s=%s} %s\n", name, v.label, quote(k), formatFloat(snap[k]))
+		}
+	})
+	return v
+}
+
+// NewGaugeFunc registers a gauge read from fn at scrape time.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %s\n", name, formatFloat(fn()))
+	})
+}
+
+// RegisterHistogram registers h under name.
+func RegisterHistogram(name, help string, h *Histogram) *Histogram {
+	register(name, help, "histogram", func(w io.Writer, name string) {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{le=%s} %d\n", name, quote(formatFloat(b)), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+		fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_count %d\n", name, h.count)
+	})
+	return h
+}
+
+// Write renders every registered metric in the Prometheus text format.
+func Write(w io.Writer) {
+	mu.Lock()
+	metrics := append([]metric(nil), registry...)
+	mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		m.write(w, m.name)
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,35 @@
+package metrics_test
+
+import (
+	"strings"
+	"testing"
+
+	"clipsync/internal/metrics"
+)
+
+func TestWrite(t *testing.T) {
+	sent := metrics.NewCounterVec("test_sent_total", "Sent.", "peer")
+	sent.With("10.0.0.2").Add(3)
+	sent.With("10.0.0.1").Inc()
+	h := metrics.RegisterHistogram("test_seconds", "Latency.", metrics.NewHistogram(0.1, 1))
+	h.Observe(0.05)
+	h.Observe(0.5)
+
+	var b strings.Builder
+	metrics.Write(&b)
+	got := b.String()
+
+	for _, want := range []string{
+		"# TYPE test_sent_total counter\n",
+		"test_sent_total{peer=\"10.0.0.1\"} 1\ntest_sent_total{peer=\"10.0.0.2\"} 3\n",
+		"test_seconds_bucket{le=\"0.1\"} 1\n",
+		"test_seconds_bucket{le=\"1\"} 2\n",
+		"test_seconds_bucket{le=\"+Inf\"} 2\n",
+		"test_seconds_count 2\n",
+		"# TYPE clipsync_goroutines gauge\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output is missing %q:\n%s", want, got)
+		}
+	}
+}
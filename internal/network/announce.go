@@ -0,0 +1,383 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+
+	"golang.org/x/net/ipv4"
+)
+
+// Announcements are ClipSync's own discovery, for networks that filter
+// mDNS. Every device listens on DiscoveryPort for small JSON datagrams sent
+// to a multicast group and to each subnet's broadcast address. A device
+// probes when it starts, so the others answer right away, and announces
+// itself every announceInterval after that. A source address is easily
+// forged, so an announcing device only becomes a peer once it has echoed a
+// nonce sent to the address it claims.
+
+// DefaultMulticastGroup is the group announcements go to unless configured
+// otherwise. It is in the organization-local scope, so routers keep it on
+// the site.
+const DefaultMulticastGroup = "239.255.67.83"
+
+const announceInterval = 30 * time.Second
+
+const (
+	msgAnnounce  = "announce"
+	msgProbe     = "probe"
+	msgChallenge = "challenge"
+	msgResponse  = "response"
+)
+
+const (
+	// challengeTimeout is how long a device has to answer a challenge.
+	challengeTimeout = 5 * time.Second
+	// maxChallenges bounds the challenges awaiting an answer, so a flood of
+	// forged announcements can't grow them without limit.
+	maxChallenges = 256
+)
+
+type announcement struct {
+	App  string `json:"app"`
+	Type string `json:"type"`
+	// Instance is the device name, the same as its mDNS instance.
+	Instance string `json:"instance"`
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port"`
+	// ID is random per run, so a device can skip its own announcements.
+	ID string `json:"id"`
+	// Nonce is set on challenges and echoed in responses.
+	Nonce string `json:"nonce,omitempty"`
+}
+
+// DiscoveryOptions switches the ways devices find each other.
+type DiscoveryOptions struct {
+	MDNS      bool
+	Multicast bool
+	Broadcast bool
+	// MulticastGroup is the IPv4 group for announcements.
+	MulticastGroup string
+	// Include and Exclude pick the interfaces discovery runs on, by name
+	// pattern or CIDR. An empty Include means every interface.
+	Include []string
+	Exclude []string
+}
+
+// Discovery is how this device finds others. Set it before StartSync.
+var Discovery = DiscoveryOptions{MDNS: true, Multicast: true, Broadcast: true, MulticastGroup: DefaultMulticastGroup}
+
+var runID = rand.Text()
+
+// RunAnnouncements announces this device and listens for others on the
+// multicast group and subnet broadcasts, as enabled in Discovery, until
+// ctx is done.
+func RunAnnouncements(ctx context.Context) error {
+	opts := Discovery
+	if !opts.Multicast && !opts.Broadcast {
+		return nil
+	}
+	group := net.ParseIP(opts.MulticastGroup).To4()
+	if opts.Multicast && (group == nil || !group.IsMulticast()) {
+		discoveryLog.Error("Invalid multicast group, using broadcasts only", "group", opts.MulticastGroup)
+		opts.Multicast = false
+	}
+
+	conn, err := net.ListenPacket("udp4", ":"+strconv.Itoa(globals.DiscoveryPort))
+	if err != nil {
+		// mDNS and static peers still work, so carry on without
+		discoveryLog.Error("Could not open the discovery socket", logging.Err(err))
+		return nil
+	}
+	defer conn.Close()
+	p := ipv4.NewPacketConn(conn)
+
+	a := &announcer{conn: p, opts: opts, group: group, joined: map[string]bool{}, pending: challenges{}}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	go a.loop(ctx)
+	return a.receive(ctx)
+}
+
+type announcer struct {
+	conn  *ipv4.PacketConn
+	opts  DiscoveryOptions
+	group net.IP
+	// joined is the interfaces the multicast group was joined on.
+	joined map[string]bool
+	// pending is the devices challenged to prove their address, only used
+	// by receive.
+	pending challenges
+}
+
+// join joins the multicast group on interfaces that came up since the last
+// call.
+func (a *announcer) join() {
+	ifaces := multicastInterfaces()
+	// Interfaces that went away lose their membership
+	for name := range a.joined {
+		if !slices.ContainsFunc(ifaces, func(i net.Interface) bool { return i.Name == name }) {
+			delete(a.joined, name)
+		}
+	}
+	if a.opts.Multicast {
+		for _, iface := range ifaces {
+			if a.joined[iface.Name] {
+				continue
+			}
+			if err := a.conn.JoinGroup(&iface, &net.UDPAddr{IP: a.group}); err != nil {
+				discoveryLog.Debug("Could not join the multicast group", "iface", iface.Name, logging.Err(err))
+				continue
+			}
+			a.joined[iface.Name] = true
+		}
+		discoveryLog.Info("Announcing on multicast", "group", a.group.String(), "interfaces", len(a.joined))
+	}
+	if a.opts.Broadcast {
+		discoveryLog.Info("Announcing on subnet broadcasts", "addresses", len(broadcastAddrs(ifaces)))
+	}
+}
+
+// loop probes, then announces every announceInterval. It probes again
+// whenever the interfaces change, as that usually means a new network.
+func (a *announcer) loop(ctx context.Context) {
+	changes := InterfaceChanges(ctx)
+	a.join()
+	kind := msgProbe
+	for {
+		if Paused() == "" {
+			a.send(kind, nil)
+			kind = msgAnnounce
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-changes:
+			a.join()
+			kind = msgProbe
+		case <-time.After(announceInterval):
+		}
+	}
+}
+
+// send sends an announcement to to, or to every enabled destination.
+func (a *announcer) send(kind string, to net.Addr) {
+	a.sendNonce(kind, "", to)
+}
+
+// sendNonce sends an announcement carrying nonce.
+func (a *announcer) sendNonce(kind, nonce string, to net.Addr) {
+	host, _ := os.Hostname()
+	instance := globals.Username
+	if instance == "" {
+		instance = host
+	}
+	msg, _ := json.Marshal(announcement{
+		App:      "clipsync",
+		Type:     kind,
+		Instance: instance,
+		Host:     host,
+		Port:     globals.PORT,
+		ID:       runID,
+		Nonce:    nonce,
+	})
+	if to != nil {
+		a.conn.WriteTo(msg, nil, to)
+		return
+	}
+
+	ifaces := multicastInterfaces()
+	if a.opts.Multicast {
+		dst := &net.UDPAddr{IP: a.group, Port: globals.DiscoveryPort}
+		for _, iface := range ifaces {
+			if err := a.conn.SetMulticastInterface(&iface); err != nil {
+				continue
+			}
+			if _, err := a.conn.WriteTo(msg, nil, dst); err != nil {
+				discoveryLog.Debug("Multicast announcement failed", "iface", iface.Name, logging.Err(err))
+			}
+		}
+	}
+	if a.opts.Broadcast {
+		for _, ip := range broadcastAddrs(ifaces) {
+			dst := &net.UDPAddr{IP: ip, Port: globals.DiscoveryPort}
+			if _, err := a.conn.WriteTo(msg, nil, dst); err != nil {
+				discoveryLog.Debug("Broadcast announcement failed", "addr", ip.String(), logging.Err(err))
+			}
+		}
+	}
+}
+
+// receive handles announcements from other devices until the socket is
+// closed.
+func (a *announcer) receive(ctx context.Context) error {
+	buf := make([]byte, 2048)
+	for {
+		n, _, src, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			discoveryLog.Warn("Discovery receive failed", logging.Err(err))
+			continue
+		}
+		if Paused() != "" {
+			continue
+		}
+		var msg announcement
+		if json.Unmarshal(buf[:n], &msg) != nil || msg.App != "clipsync" || msg.ID == runID {
+			continue
+		}
+		addr, ok := src.(*net.UDPAddr)
+		if !ok || msg.Port < 1 || msg.Port > 65535 {
+			continue
+		}
+		// The socket hears every interface, discovery only runs on some
+		if !onDiscoveryInterface(addr.IP) {
+			continue
+		}
+		ip := addr.IP.String()
+		switch msg.Type {
+		case msgChallenge:
+			a.sendNonce(msgResponse, msg.Nonce, src)
+		case msgResponse:
+			claimed, ok := a.pending.verify(ip, msg.Nonce, time.Now())
+			if !ok {
+				discoveryLog.Debug("Ignoring unexpected challenge response", "ip", ip)
+				continue
+			}
+			name := claimed.Host
+			if name == "" {
+				name = claimed.Instance
+			}
+			foundDevice(claimed.Instance, globals.Device{Name: name, Ip: ip}, claimed.Port, "announcement")
+		case msgProbe, msgAnnounce:
+			if msg.Type == msgProbe {
+				a.send(msgAnnounce, src)
+			}
+			if isPeer(ip) {
+				continue
+			}
+			if nonce := a.pending.challenge(ip, msg, time.Now()); nonce != "" {
+				a.sendNonce(msgChallenge, nonce, src)
+			}
+		}
+	}
+}
+
+// challenge is a nonce sent to an announcing device, and what it claimed.
+type challenge struct {
+	nonce   string
+	claimed announcement
+	expires time.Time
+}
+
+// challenges maps an address to the challenge awaiting its answer.
+type challenges map[string]challenge
+
+// challenge returns a nonce for the device announcing msg from ip to echo,
+// or "" when too many challenges are pending or one is already out.
+func (c challenges) challenge(ip string, msg announcement, now time.Time) string {
+	for addr, ch := range c {
+		if now.After(ch.expires) {
+			delete(c, addr)
+		}
+	}
+	if _, ok := c[ip]; ok || len(c) >= maxChallenges {
+		return ""
+	}
+	nonce := rand.Text()
+	c[ip] = challenge{nonce: nonce, claimed: msg, expires: now.Add(challengeTimeout)}
+	return nonce
+}
+
+// verify returns what the device at ip announced if nonce answers its
+// challenge in time.
+func (c challenges) verify(ip, nonce string, now time.Time) (announcement, bool) {
+	ch, ok := c[ip]
+	if !ok || nonce == "" || now.After(ch.expires) || subtle.ConstantTimeCompare([]byte(nonce), []byte(ch.nonce)) != 1 {
+		return announcement{}, false
+	}
+	delete(c, ip)
+	return ch.claimed, true
+}
+
+// onDiscoveryInterface reports whether ip is on the subnet of a discovery
+// interface.
+func onDiscoveryInterface(ip net.IP) bool {
+	for _, iface := range getAllInterfaces() {
+		addrs, _ := iface.Addrs()
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(ip) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// multicastInterfaces returns the discovery interfaces that can multicast.
+func multicastInterfaces() []net.Interface {
+	var out []net.Interface
+	for _, iface := range getAllInterfaces() {
+		if iface.Flags&net.FlagMulticast != 0 {
+			out = append(out, iface)
+		}
+	}
+	return out
+}
+
+// broadcastAddrs returns the directed broadcast address of every IPv4
+// subnet on ifaces.
+func broadcastAddrs(ifaces []net.Interface) []net.IP {
+	var out []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			b := subnetBroadcast(ipnet)
+			if b != nil && !slices.ContainsFunc(out, b.Equal) {
+				out = append(out, b)
+			}
+		}
+	}
+	return out
+}
+
+// subnetBroadcast returns the broadcast address of an IPv4 subnet, or nil
+// for IPv6 and single-host networks.
+func subnetBroadcast(n *net.IPNet) net.IP {
+	ip := n.IP.To4()
+	if ip == nil || len(n.Mask) != net.IPv4len {
+		return nil
+	}
+	if ones, _ := n.Mask.Size(); ones >= 31 {
+		return nil
+	}
+	b := make(net.IP, net.IPv4len)
+	for i := range ip {
+		b[i] = ip[i] | ^n.Mask[i]
+	}
+	return b
+}
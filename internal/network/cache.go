@@ -0,0 +1,78 @@
+package network
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+)
+
+// cacheSize bounds the clip bodies kept for fetching, in bytes.
+const cacheSize = 128 << 20
+
+// clipCache keeps recent clip bodies by content hash, evicting the least
+// recently used once it holds more than max bytes. It serves the clips we
+// offered to peers, and spares fetching a clip we already have.
+type clipCache struct {
+	mu      sync.Mutex
+	max     int
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	hash string
+	data []byte
+}
+
+func newClipCache(max int) *clipCache {
+	return &clipCache{max: max, lru: list.New(), entries: map[string]*list.Element{}}
+}
+
+var cache = newClipCache(cacheSize)
+
+// hashClip is the content hash clips are cached and offered by.
+func hashClip(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *clipCache) get(hash string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[hash]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*cacheEntry).data, true
+}
+
+func (c *clipCache) put(hash string, data []byte) {
+	if len(data) > c.max {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[hash]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[hash] = c.lru.PushFront(&cacheEntry{hash: hash, data: data})
+	c.size += len(data)
+	for c.size > c.max {
+		oldest := c.lru.Back()
+		entry := oldest.Value.(*cacheEntry)
+		c.lru.Remove(oldest)
+		delete(c.entries, entry.hash)
+		c.size -= len(entry.data)
+	}
+}
+
+// Cached reports whether the body of the clip with hash is at hand, so
+// fetching it costs nothing.
+func Cached(hash string) bool {
+	_, ok := cache.get(hash)
+	return ok
+}
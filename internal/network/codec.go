@@ -0,0 +1,224 @@
+package network
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Clips are compressed per peer with the best codec both sides support,
+// which they tell each other in a hello frame after the handshake. The
+// codec goes in the high nibble of the frame kind, so peers that never
+// sent a hello only ever get plain frames.
+const (
+	codecNone byte = 0
+	codecGzip byte = 1
+	codecZstd byte = 2
+)
+
+var codecNames = map[byte]string{codecNone: "none", codecGzip: "gzip", codecZstd: "zstd"}
+
+// supportedCodecs are offered in our hello, best first.
+var supportedCodecs = []byte{codecZstd, codecGzip}
+
+// compressThreshold is the smallest clip worth compressing.
+const compressThreshold = 512
+
+// maxClip bounds what a compressed frame may expand to.
+const maxClip = 16 << 20
+
+type hello struct {
+	Codecs []string `json:"codecs,omitempty"`
+	// Fetch is set by peers that fetch announced clips, see lazy.go.
+	Fetch bool `json:"fetch,omitempty"`
+}
+
+var (
+	codecsMu sync.Mutex
+	// codecs is the codec each peer that sent a hello accepts.
+	codecs = map[string]byte{}
+	// fetchers are the peers that can be sent offers.
+	fetchers = map[string]bool{}
+	// hellos is when each peer last said hello.
+	hellos = map[string]time.Time{}
+)
+
+func encodeHello() []byte {
+	h := hello{Fetch: true}
+	for _, c := range supportedCodecs {
+		h.Codecs = append(h.Codecs, codecNames[c])
+	}
+	data, _ := json.Marshal(h)
+	return data
+}
+
+// handleHello records the codecs a peer accepts. It reports whether the
+// peer is new to us, so we can say hello back.
+func handleHello(ip string, payload []byte) bool {
+	var h hello
+	if err := json.Unmarshal(payload, &h); err != nil {
+		logger.Debug("Ignoring malformed hello", "peer", ip, logging.Err(err))
+		return false
+	}
+	best := codecNone
+	for _, c := range supportedCodecs {
+		if slices.Contains(h.Codecs, codecNames[c]) {
+			best = c
+			break
+		}
+	}
+	codecsMu.Lock()
+	_, known := codecs[ip]
+	codecs[ip] = best
+	fetchers[ip] = h.Fetch
+	hellos[ip] = time.Now()
+	codecsMu.Unlock()
+	logger.Debug("Peer said hello", "peer", ip, "codec", codecNames[best])
+	return !known
+}
+
+// peerCodec returns the codec to send to ip with.
+func peerCodec(ip string) byte {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	return codecs[ip]
+}
+
+// peerFetches reports whether ip can be sent offers.
+func peerFetches(ip string) bool {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	return fetchers[ip]
+}
+
+func forgetHello(ip string) {
+	codecsMu.Lock()
+	delete(codecs, ip)
+	delete(fetchers, ip)
+	delete(hellos, ip)
+	codecsMu.Unlock()
+}
+
+// WaitHello waits for ip to say hello after since. It reports false if
+// ctx ends first.
+func WaitHello(ctx context.Context, ip string, since time.Time) bool {
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		codecsMu.Lock()
+		at, ok := hellos[ip]
+		codecsMu.Unlock()
+		if ok && !at.Before(since) {
+			return true
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// compressClip compresses data with codec. It returns codecNone and data
+// unchanged for small clips, for formats that are compressed already and
+// whenever compressing does not pay off.
+func compressClip(codec byte, data []byte) (byte, []byte) {
+	if codec == codecNone || len(data) < compressThreshold || precompressed(data) {
+		return codecNone, data
+	}
+	var buf bytes.Buffer
+	switch codec {
+	case codecGzip:
+		w, _ := gzip.NewWriterLevel(&buf, gzip.DefaultCompression)
+		w.Write(data)
+		w.Close()
+	case codecZstd:
+		buf.Write(zstdEncoder.EncodeAll(data, nil))
+	default:
+		return codecNone, data
+	}
+	// Not worth the receiver's time below 10% saving
+	if buf.Len() > len(data)*9/10 {
+		return codecNone, data
+	}
+	name := codecNames[codec]
+	metrics.ClipsCompressed.With(name).Inc()
+	metrics.BytesSaved.With(name).Add(uint64(len(data) - buf.Len()))
+	return codec, buf.Bytes()
+}
+
+var errTooLarge = errors.New("decompressed clip too large")
+
+// decompressClip undoes compressClip.
+func decompressClip(codec byte, data []byte) ([]byte, error) {
+	var r io.Reader
+	switch codec {
+	case codecNone:
+		return data, nil
+	case codecGzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = gz
+	case codecZstd:
+		out, err := zstdDecoder.DecodeAll(data, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(out) > maxClip {
+			return nil, errTooLarge
+		}
+		return out, nil
+	default:
+		return nil, errors.New("unknown codec")
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxClip+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxClip {
+		return nil, errTooLarge
+	}
+	return out, nil
+}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault), zstd.WithEncoderConcurrency(1))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxClip))
+)
+
+// compressedMagic are the signatures of formats that are compressed
+// already, such as images and archives.
+var compressedMagic = [][]byte{
+	[]byte("\x89PNG\r\n\x1a\n"),
+	[]byte("\xff\xd8\xff"),       // JPEG
+	[]byte("GIF8"),               // GIF
+	[]byte("PK\x03\x04"),         // zip, docx, jar
+	[]byte("\x1f\x8b"),           // gzip
+	[]byte("\x28\xb5\x2f\xfd"),   // zstd
+	[]byte("7z\xbc\xaf\x27\x1c"), // 7-Zip
+	[]byte("BZh"),                // bzip2
+	[]byte("\xfd7zXZ\x00"),       // xz
+}
+
+func precompressed(data []byte) bool {
+	for _, m := range compressedMagic {
+		if bytes.HasPrefix(data, m) {
+			return true
+		}
+	}
+	// WebP is RIFF....WEBP
+	return len(data) >= 12 && bytes.HasPrefix(data, []byte("RIFF")) && string(data[8:12]) == "WEBP"
+}
@@ -3,14 +3,16 @@ package network
 import (
 	// "bufio"
 	"context"
-	"encoding/binary"
-	"log"
 	"net"
 	"strconv"
+	"sync"
 
 	"clipsync/internal/globals"
+	"clipsync/internal/logging"
 )
 
+var logger = logging.For(logging.Network)
+
 // type Info struct {
 
 // 	ConnectedTo map[string]string
@@ -20,43 +22,103 @@ import (
 var Conn *net.UDPConn
 var Ready = make(chan struct{})
 
+var (
+	// connMu guards closing so nothing is sent once shutdown has begun
+	connMu  sync.Mutex
+	closing bool
+	// sending tracks sends in flight so shutdown can let them finish
+	sending sync.WaitGroup
+)
+
 func Connect(ip string) {
 	if Conn == nil {
-		log.Println("Cannot connect, Conn is not initialized. Waiting for Ready channel...")
+		logger.Debug("Socket is not open yet, waiting to connect", "peer", ip)
 		<-Ready
 	}
-	addr, err := net.ResolveUDPAddr("udp", ip+":"+strconv.Itoa(globals.PORT))
+	if Paused() != "" {
+		return
+	}
+	addr, err := peerAddr(ip)
 	if err != nil {
-		log.Println(err)
+		logger.Warn("Could not resolve peer", "peer", ip, logging.Err(err))
 		return
 	}
-	msg := []byte("---ClipSync---")
-	payload := make([]byte, 4+len(msg))
-	binary.BigEndian.PutUint32(payload[:4], uint32(len(msg)))
-	copy(payload[4:], msg)
-	_, err = Conn.WriteToUDP(payload, addr)
+	if !beginSend() {
+		return
+	}
+	defer sending.Done()
+	_, err = Conn.WriteToUDP(encodeFrame(frameData, handshake), addr)
 	if err != nil {
-		log.Println("Connect Write error:", err)
+		logger.Warn("Could not send handshake", "peer", ip, logging.Err(err))
+		return
+	}
+	// Older peers drop the hello, and so get plain clips
+	Conn.WriteToUDP(encodeFrame(frameHello, encodeHello()), addr)
+}
+
+// sayHello tells ip which codecs we accept, in answer to its hello.
+func sayHello(ip string) {
+	addr, err := peerAddr(ip)
+	if err != nil || !beginSend() {
+		return
 	}
+	defer sending.Done()
+	Conn.WriteToUDP(encodeFrame(frameHello, encodeHello()), addr)
 }
 
 func Listen(ctx context.Context) error {
 	addr, err := net.ResolveUDPAddr("udp", ":"+strconv.Itoa(globals.PORT))
 	if err != nil {
-		log.Println(err)
 		return err
 	}
-	Conn, err = net.ListenUDP("udp", addr)
+	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		log.Println(err)
+		logger.Error("Could not open the sync socket", "addr", addr.String(), logging.Err(err))
 		return err
 	}
+	Conn = conn
 
-	log.Println("Listening For Connection...")
+	logger.Info("Listening for connections", "addr", Conn.LocalAddr().String())
 	close(Ready)
 
 	<-ctx.Done()
+	shutdown()
 	return nil
 }
 
+// beginSend registers a send in flight. It returns false once shutdown
+// has started; otherwise the caller must call sending.Done.
+func beginSend() bool {
+	connMu.Lock()
+	defer connMu.Unlock()
+	if closing {
+		return false
+	}
+	sending.Add(1)
+	return true
+}
 
+// shutdown lets queued sends finish, says goodbye to every peer so they
+// drop us right away, and closes the socket to unblock receivers.
+func shutdown() {
+	connMu.Lock()
+	closing = true
+	connMu.Unlock()
+	sending.Wait()
+
+	globals.IPSMu.Lock()
+	ips := make([]string, len(globals.IPS))
+	copy(ips, globals.IPS)
+	globals.IPSMu.Unlock()
+
+	bye := encodeFrame(frameBye, nil)
+	for _, ip := range ips {
+		addr, err := peerAddr(ip)
+		if err != nil {
+			continue
+		}
+		Conn.WriteToUDP(bye, addr)
+	}
+	logger.Info("Said goodbye to devices", "peers", len(ips))
+	Conn.Close()
+}
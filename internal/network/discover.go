@@ -2,18 +2,19 @@ package network
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net"
 	"os"
+	"slices"
 
 	"clipsync/internal/globals"
-	"clipsync/internal/view"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
 
 	"github.com/grandcat/zeroconf"
 )
 
-var Entries = make(chan *zeroconf.ServiceEntry)
+// ServiceType is the mDNS service ClipSync devices announce.
+const ServiceType = "_clipsync._tcp"
 
 func getAllInterfaces() []net.Interface {
 	ifaces, err := net.Interfaces()
@@ -35,11 +36,17 @@ func getAllInterfaces() []net.Interface {
 		if err != nil || len(addrs) == 0 {
 			continue
 		}
+		if !selectInterface(iface) || !trustedInterface(iface.Name) {
+			continue
+		}
 		result = append(result, iface)
 	}
 	return result
 }
 
+// discoveryLog tags mDNS records separately from the sync traffic.
+var discoveryLog = logging.For(logging.Discovery)
+
 func RegisterDevice(ctx context.Context, name string) error {
 	if name == "" {
 		globals.Username, _ = os.Hostname()
@@ -48,14 +55,14 @@ func RegisterDevice(ctx context.Context, name string) error {
 
 	ifaces := getAllInterfaces()
 
-	server, err := zeroconf.Register(name, "_clipsync._tcp", "local.", globals.PORT, []string{""}, ifaces)
+	server, err := zeroconf.Register(name, ServiceType, "local.", globals.PORT, []string{""}, ifaces)
 
 	if err != nil {
-		log.Println(err)
+		discoveryLog.Error("Could not register the mDNS service", logging.Err(err))
 		return err
 	}
 
-	log.Println("Broadcasting Presence...")
+	discoveryLog.Info("Broadcasting presence", "name", name)
 	defer server.Shutdown()
 	<-ctx.Done()
 	return nil
@@ -68,20 +75,23 @@ func BrowseForDevices(ctx context.Context) error {
 	reslover, err := zeroconf.NewResolver(zeroconf.SelectIfaces(ifaces))
 
 	if err != nil {
-		log.Println(err)
+		discoveryLog.Error("Could not start the mDNS resolver", logging.Err(err))
 		return err
 	}
 
-	go entry(Entries)
+	// The resolver closes the channel when ctx is done, so every browse
+	// needs its own
+	entries := make(chan *zeroconf.ServiceEntry)
+	go entry(entries)
 
-	err = reslover.Browse(ctx, "_clipsync._tcp", "local.", Entries)
+	err = reslover.Browse(ctx, ServiceType, "local.", entries)
 
 	if err != nil {
-		log.Println(err)
+		discoveryLog.Error("Could not browse for devices", logging.Err(err))
 		return err
 	}
 
-	log.Println("Starting to Discover Services...")
+	discoveryLog.Info("Browsing for devices")
 
 	<-ctx.Done()
 	return nil
@@ -89,20 +99,30 @@ func BrowseForDevices(ctx context.Context) error {
 
 func entry(results <-chan *zeroconf.ServiceEntry) {
 	for entry := range results {
-		if entry.Instance != globals.Username {
+		if entry.Instance != globals.Username && len(entry.AddrIPv4) > 0 {
 			newIP := string(entry.AddrIPv4[0].String())
-			newDevice := globals.Device{Name: entry.HostName, Ip: newIP}
-			go view.UpdateDevices(newDevice)
-			globals.IPSMu.Lock()
-			globals.IPS = append(globals.IPS, newIP)
-			globals.IPSMu.Unlock()
-
-			go Connect(newIP)
-			log.Println("Found Device: Name: ", entry.Instance, " IP: ", entry.AddrIPv4)
-
-			fmt.Println("Connected Device:", entry.Instance)
-			
-		 
+			foundDevice(entry.Instance, globals.Device{Name: entry.HostName, Ip: newIP}, entry.Port, "mdns")
 		}
 	}
 }
+
+// foundDevice adds a device found by any discovery mechanism and greets
+// it. Devices already on the peer list are left as they are, so mDNS and
+// announcements finding the same device merge into one entry.
+func foundDevice(instance string, dev globals.Device, port int, via string) {
+	globals.IPSMu.Lock()
+	if slices.Contains(globals.IPS, dev.Ip) {
+		globals.IPSMu.Unlock()
+		return
+	}
+	globals.IPS = append(globals.IPS, dev.Ip)
+	globals.IPSMu.Unlock()
+
+	if port != 0 {
+		rememberPort(dev.Ip, port)
+	}
+	go addDevice(dev)
+	metrics.PeerUp.Set(dev.Ip, 1)
+	go Connect(dev.Ip)
+	discoveryLog.Info("Found device", "name", instance, "ip", dev.Ip, "via", via)
+}
@@ -0,0 +1,65 @@
+package network
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+var SubnetBroadcast = subnetBroadcast
+
+// NewChallenges returns the challenge and verify steps of a fresh table of
+// announcement challenges, reporting devices by instance name.
+func NewChallenges() (challenge func(ip, instance string, now time.Time) string, verify func(ip, nonce string, now time.Time) (string, bool)) {
+	c := challenges{}
+	challenge = func(ip, instance string, now time.Time) string {
+		return c.challenge(ip, announcement{Instance: instance}, now)
+	}
+	verify = func(ip, nonce string, now time.Time) (string, bool) {
+		msg, ok := c.verify(ip, nonce, now)
+		return msg.Instance, ok
+	}
+	return challenge, verify
+}
+
+// SelectInterface applies include and exclude to an interface named name
+// with the addresses cidrs.
+func SelectInterface(name string, cidrs []string, include, exclude []string) bool {
+	addrs := func() ([]net.Addr, error) {
+		var out []net.Addr
+		for _, c := range cidrs {
+			ip, ipnet, err := net.ParseCIDR(c)
+			if err != nil {
+				return nil, err
+			}
+			ipnet.IP = ip
+			out = append(out, ipnet)
+		}
+		return out, nil
+	}
+	return selectByPatterns(name, addrs, include, exclude)
+}
+
+var ResolveStatic = resolveStatic
+
+// SetLookupHost replaces the resolver for static peers until restore is
+// called.
+func SetLookupHost(fn func(ctx context.Context, host string) ([]string, error)) (restore func()) {
+	old := lookupHost
+	lookupHost = fn
+	return func() { lookupHost = old }
+}
+
+const MaxSources = maxSources
+
+var (
+	Admit  = admit
+	Reject = reject
+)
+
+// Sources returns how many sources are tracked.
+func Sources() int {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	return len(sources)
+}
@@ -0,0 +1,455 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+)
+
+// Copied files and folders are announced with a files frame and fetched
+// over TCP from the clip server, like large clips: first the manifest,
+// which lists every file with its size and SHA-256, then each file. The
+// receiver checks both before a file is moved into place.
+
+// FileOffer announces files a peer can fetch.
+type FileOffer struct {
+	ID    string `json:"id"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+	Port  int    `json:"port"`
+	// From is the address of the peer that sent the offer.
+	From string `json:"-"`
+}
+
+// Manifest lists the files of a transfer.
+type Manifest struct {
+	Files []FileEntry `json:"files"`
+}
+
+// FileEntry is a file or folder in a manifest. Path is slash separated
+// and starts with the name of the copied file or folder.
+type FileEntry struct {
+	Path string      `json:"path"`
+	Dir  bool        `json:"dir,omitempty"`
+	Size int64       `json:"size,omitempty"`
+	Hash string      `json:"hash,omitempty"`
+	Mode fs.FileMode `json:"mode,omitempty"`
+}
+
+// DefaultMaxTransfer bounds the files sent or received at once.
+const DefaultMaxTransfer = 1 << 30
+
+// MaxTransfer is set by the engine before sync starts.
+var MaxTransfer int64 = DefaultMaxTransfer
+
+// maxShared bounds the transfers kept available for fetching.
+const maxShared = 8
+
+// FileOffers delivers the files peers announce, for the engine to fetch.
+var FileOffers = make(chan FileOffer, 4)
+
+type sharedFiles struct {
+	manifest Manifest
+	// local holds the path of each manifest entry on this machine.
+	local []string
+	size  int64
+	// out tracks the transfer to each peer fetching the files.
+	out map[string]*transfer
+}
+
+var (
+	sharedMu    sync.Mutex
+	shared      = map[string]*sharedFiles{}
+	sharedOrder []string
+)
+
+// SendFiles offers the files and folders at paths to every peer that can
+// fetch. Folders are sent with everything in them; symlinks and other
+// special files are skipped.
+func SendFiles(paths []string) error {
+	if Paused() != "" {
+		return nil
+	}
+	files := &sharedFiles{out: map[string]*transfer{}}
+	var total int64
+	for _, p := range paths {
+		root := filepath.Dir(p)
+		err := filepath.WalkDir(p, func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, name)
+			if err != nil {
+				return err
+			}
+			entry := FileEntry{Path: filepath.ToSlash(rel), Dir: d.IsDir()}
+			if !d.IsDir() && !d.Type().IsRegular() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			entry.Mode = info.Mode().Perm()
+			if !d.IsDir() {
+				entry.Size = info.Size()
+				total += entry.Size
+				if total > MaxTransfer {
+					return fmt.Errorf("files are larger than the %d byte limit", MaxTransfer)
+				}
+				if entry.Hash, err = hashFile(name); err != nil {
+					return err
+				}
+			}
+			files.manifest.Files = append(files.manifest.Files, entry)
+			files.local = append(files.local, name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(files.manifest.Files) == 0 {
+		return nil
+	}
+
+	files.size = total
+	offer := FileOffer{ID: rand.Text(), Size: total, Port: globals.TCPPort}
+	for _, f := range files.manifest.Files {
+		if !f.Dir {
+			offer.Count++
+		}
+	}
+	sharedMu.Lock()
+	shared[offer.ID] = files
+	sharedOrder = append(sharedOrder, offer.ID)
+	if len(sharedOrder) > maxShared {
+		delete(shared, sharedOrder[0])
+		sharedOrder = sharedOrder[1:]
+	}
+	sharedMu.Unlock()
+
+	payload, _ := json.Marshal(offer)
+	frame := encodeFrame(frameFiles, payload)
+
+	globals.IPSMu.Lock()
+	ips := slices.Clone(globals.IPS)
+	globals.IPSMu.Unlock()
+	if !beginSend() {
+		return nil
+	}
+	defer sending.Done()
+	logger.Info("Offering files", "files", offer.Count, "bytes", total, "peers", len(ips))
+	for _, ip := range ips {
+		if !peerFetches(ip) {
+			continue
+		}
+		addr, err := peerAddr(ip)
+		if err != nil {
+			logger.Warn("Could not resolve peer", "peer", ip, logging.Err(err))
+			continue
+		}
+		if _, err := Conn.WriteToUDP(frame, addr); err != nil {
+			logger.Warn("Could not offer files", "peer", ip, logging.Err(err))
+			metrics.SendErrors.With(ip).Inc()
+		}
+	}
+	return nil
+}
+
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// handleFiles hands a files offer to the engine.
+func handleFiles(ip string, payload []byte) {
+	var o FileOffer
+	if err := json.Unmarshal(payload, &o); err != nil || o.ID == "" || o.Port <= 0 {
+		logger.Debug("Ignoring invalid files offer", "peer", ip)
+		metrics.DecodeErrors.Inc()
+		return
+	}
+	o.From = net.JoinHostPort(ip, strconv.Itoa(o.Port))
+	logger.Info("Peer offered files", "peer", ip, "files", o.Count, "bytes", o.Size)
+	select {
+	case FileOffers <- o:
+	default:
+		logger.Warn("Dropping files offer, engine is busy", "peer", ip)
+	}
+}
+
+// ReceiveFiles fetches the files of o into dir, and returns the paths of
+// the top-level files and folders it created. Names already taken in dir
+// get a number appended.
+func ReceiveFiles(ctx context.Context, o FileOffer, dir string) ([]string, error) {
+	if o.Size > MaxTransfer {
+		return nil, fmt.Errorf("files are larger than the %d byte limit", MaxTransfer)
+	}
+	var m Manifest
+	if err := getJSON(ctx, "http://"+o.From+"/files/"+o.ID, &m); err != nil {
+		return nil, err
+	}
+	if err := m.check(o.Size); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	// Pick a free name for each top-level file or folder
+	renamed := map[string]string{}
+	var tops []string
+	for _, f := range m.Files {
+		top, _, _ := strings.Cut(f.Path, "/")
+		if _, ok := renamed[top]; !ok {
+			renamed[top] = freeName(dir, top)
+			tops = append(tops, filepath.Join(dir, renamed[top]))
+		}
+	}
+
+	ip, _, _ := net.SplitHostPort(o.From)
+	t, ctx := startTransfer(ctx, "in", ip, describeFiles(o.Count), o.Size)
+	err := receiveManifest(ctx, o, m, dir, renamed, t)
+	t.finish(err)
+	if err != nil {
+		return tops, err
+	}
+	metrics.BytesReceived.With(ip).Add(uint64(o.Size))
+	logger.Info("Received files", "peer", ip, "files", o.Count, "bytes", o.Size, "dir", dir, "took", time.Since(t.snapshot().Started).Round(time.Millisecond))
+	return tops, nil
+}
+
+// receiveManifest fetches each file of m, counting them against t.
+func receiveManifest(ctx context.Context, o FileOffer, m Manifest, dir string, renamed map[string]string, t *transfer) error {
+	for i, f := range m.Files {
+		top, rest, _ := strings.Cut(f.Path, "/")
+		dest := filepath.Join(dir, renamed[top], filepath.FromSlash(rest))
+		if f.Dir {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		url := fmt.Sprintf("http://%s/files/%s/%d", o.From, o.ID, i)
+		if err := fetchFile(ctx, url, dest, f, t); err != nil {
+			return fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
+
+func describeFiles(n int) string {
+	if n == 1 {
+		return "1 file"
+	}
+	return fmt.Sprintf("%d files", n)
+}
+
+// check rejects manifests that would write outside the inbox or that
+// don't add up to the offered size.
+func (m Manifest) check(size int64) error {
+	var total int64
+	for _, f := range m.Files {
+		if f.Path == "." || !filepath.IsLocal(filepath.FromSlash(f.Path)) || path.Clean(f.Path) != f.Path {
+			return fmt.Errorf("unsafe path %q in manifest", f.Path)
+		}
+		if f.Size < 0 {
+			return fmt.Errorf("invalid size for %q in manifest", f.Path)
+		}
+		total += f.Size
+	}
+	if total != size {
+		return errors.New("manifest does not match the offer")
+	}
+	return nil
+}
+
+// freeName returns name, or name with a number appended if dir already
+// has an entry called that.
+func freeName(dir, name string) string {
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(filepath.Join(dir, name)); errors.Is(err, fs.ErrNotExist) {
+			return name
+		}
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+}
+
+// fetchFile downloads one file next to dest and moves it into place once
+// its size and checksum match.
+func fetchFile(ctx context.Context, url, dest string, f FileEntry, t *transfer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := fileClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer answered %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h, t), io.LimitReader(resp.Body, f.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != f.Size {
+		return fmt.Errorf("got %d bytes, want %d", n, f.Size)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != f.Hash {
+		return errors.New("checksum mismatch")
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if f.Mode != 0 {
+		os.Chmod(tmp.Name(), f.Mode.Perm())
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+// fileClient has no overall timeout, as large files take a while; a
+// stalled peer is caught by the dial and header timeouts.
+var fileClient = &http.Client{Transport: &http.Transport{
+	DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+	ResponseHeaderTimeout: 30 * time.Second,
+}}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("peer answered %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 16<<20)).Decode(v)
+}
+
+// serveManifest lists the files of a transfer.
+func serveManifest(w http.ResponseWriter, r *http.Request) {
+	sharedMu.Lock()
+	files, ok := shared[r.PathValue("id")]
+	sharedMu.Unlock()
+	if !ok {
+		http.Error(w, "No such transfer", http.StatusNotFound)
+		return
+	}
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	sharedMu.Lock()
+	if old, ok := files.out[ip]; ok {
+		old.finish(errors.New("fetch restarted"))
+	}
+	// The transfer outlives this request; each file request adds to it
+	count := len(files.local) - countDirs(files.manifest)
+	t, _ := startTransfer(context.Background(), "out", ip, describeFiles(count), files.size)
+	files.out[ip] = t
+	sharedMu.Unlock()
+	if count == 0 {
+		t.finish(nil)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files.manifest)
+}
+
+func countDirs(m Manifest) int {
+	n := 0
+	for _, f := range m.Files {
+		if f.Dir {
+			n++
+		}
+	}
+	return n
+}
+
+// serveFile sends one file of a transfer.
+func serveFile(w http.ResponseWriter, r *http.Request) {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	sharedMu.Lock()
+	files, ok := shared[r.PathValue("id")]
+	var t *transfer
+	if ok {
+		t = files.out[ip]
+	}
+	sharedMu.Unlock()
+	if t != nil && t.snapshot().State != globals.TransferRunning {
+		http.Error(w, "Transfer was canceled", http.StatusGone)
+		return
+	}
+	index, err := strconv.Atoi(r.PathValue("index"))
+	if !ok || err != nil || index < 0 || index >= len(files.local) || files.manifest.Files[index].Dir {
+		http.Error(w, "No such file", http.StatusNotFound)
+		return
+	}
+	f, err := os.Open(files.local[index])
+	if err != nil {
+		http.Error(w, "File is gone", http.StatusGone)
+		return
+	}
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.FormatInt(files.manifest.Files[index].Size, 10))
+	var out io.Writer = w
+	if t != nil {
+		out = progressWriter{w: w, t: t}
+	}
+	n, err := io.CopyN(out, f, files.manifest.Files[index].Size)
+	metrics.BytesSent.With(ip).Add(uint64(n))
+	if t == nil {
+		return
+	}
+	if err != nil {
+		t.finish(err)
+	} else if s := t.snapshot(); s.Done >= s.Size {
+		t.finish(nil)
+	}
+}
@@ -0,0 +1,57 @@
+package network
+
+import "encoding/binary"
+
+// Every datagram starts with a 4 byte big-endian header. The low 24 bits
+// hold the payload length and the top byte the frame kind, with the codec
+// the payload is compressed with in its high nibble. Older peers read the
+// whole header as a length, so any kind other than plain frameData looks
+// like an incomplete payload to them and is dropped.
+//
+// Frames carry no sequence number or timestamp. They are not
+// authenticated, so a host able to spoof a peer's address could forge
+// those along with the clip; replay protection is limited to the relay
+// envelopes, see relay/envelope.go.
+const (
+	frameData  byte = 0 // clipboard contents, or the handshake
+	frameBye   byte = 1 // the sender is shutting down
+	frameHello byte = 2 // the codecs the sender accepts
+	frameOffer byte = 3 // a clip to fetch rather than its contents
+	frameFiles byte = 4 // copied files to fetch
+	// frameSensitive is clipboard contents that must not be saved to disk,
+	// such as a password. Peers that predate it drop it.
+	frameSensitive byte = 5
+)
+
+// handshake is the frameData payload devices greet each other with.
+var handshake = []byte("---ClipSync---")
+
+const headerSize = 4
+
+// MaxPayload is the largest clip that fits in one UDP datagram.
+const MaxPayload = 65507 - headerSize
+
+func encodeFrame(kind byte, payload []byte) []byte {
+	frame := make([]byte, headerSize+len(payload))
+	binary.BigEndian.PutUint32(frame[:headerSize], uint32(kind)<<24|uint32(len(payload)))
+	copy(frame[headerSize:], payload)
+	return frame
+}
+
+// splitKind separates the frame kind from the codec.
+func splitKind(b byte) (kind, codec byte) {
+	return b & 0x0F, b >> 4
+}
+
+// decodeFrame splits a datagram into its kind and payload.
+func decodeFrame(buf []byte) (byte, []byte, bool) {
+	if len(buf) < headerSize {
+		return 0, nil, false
+	}
+	header := binary.BigEndian.Uint32(buf[:headerSize])
+	length := int(header & 0xFFFFFF)
+	if length > len(buf)-headerSize {
+		return 0, nil, false
+	}
+	return byte(header >> 24), buf[headerSize : headerSize+length], true
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interfacePoll is how often the interfaces are checked for changes, such
+// as joining another Wi-Fi, docking onto Ethernet or bringing up a VPN.
+const interfacePoll = 5 * time.Second
+
+var (
+	watchersMu sync.Mutex
+	watchers   = map[chan struct{}]bool{}
+)
+
+// InterfaceChanges returns a channel that receives whenever the discovery
+// interfaces change, or sync is paused or resumed, until ctx is done.
+func InterfaceChanges(ctx context.Context) <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	watchersMu.Lock()
+	watchers[ch] = true
+	watchersMu.Unlock()
+	context.AfterFunc(ctx, func() {
+		watchersMu.Lock()
+		delete(watchers, ch)
+		watchersMu.Unlock()
+	})
+	return ch
+}
+
+// WatchInterfaces polls the discovery interfaces and tells everything
+// bound to them when they change, until ctx is done.
+func WatchInterfaces(ctx context.Context) error {
+	last := interfaceState()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interfacePoll):
+		}
+		state := interfaceState()
+		if state == last {
+			continue
+		}
+		discoveryLog.Info("Network interfaces changed", "interfaces", state)
+		last = state
+		notifyWatchers()
+	}
+}
+
+// notifyWatchers wakes everything waiting on InterfaceChanges.
+func notifyWatchers() {
+	watchersMu.Lock()
+	defer watchersMu.Unlock()
+	for ch := range watchers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// interfaceState describes the discovery interfaces and their addresses,
+// so two calls compare equal unless something changed.
+func interfaceState() string {
+	var parts []string
+	for _, iface := range getAllInterfaces() {
+		addrs, _ := iface.Addrs()
+		ips := make([]string, len(addrs))
+		for i, a := range addrs {
+			ips[i] = a.String()
+		}
+		slices.Sort(ips)
+		parts = append(parts, fmt.Sprintf("%s=%s", iface.Name, strings.Join(ips, ",")))
+	}
+	slices.Sort(parts)
+	return strings.Join(parts, " ")
+}
+
+// selectInterface reports whether iface passes the include and exclude
+// lists in Discovery. Entries are interface names, which may use
+// wildcards like docker*, or CIDRs matched against the addresses.
+func selectInterface(iface net.Interface) bool {
+	return selectByPatterns(iface.Name, iface.Addrs, Discovery.Include, Discovery.Exclude)
+}
+
+// selectByPatterns applies include and exclude lists to an interface by
+// name and addresses, which are only listed when a CIDR pattern needs them.
+// An exclude wins over an include.
+func selectByPatterns(name string, addrs func() ([]net.Addr, error), include, exclude []string) bool {
+	if len(include) > 0 && !matchInterface(name, addrs, include) {
+		return false
+	}
+	return !matchInterface(name, addrs, exclude)
+}
+
+func matchInterface(name string, addrs func() ([]net.Addr, error), patterns []string) bool {
+	var listed []net.Addr
+	for _, p := range patterns {
+		if _, subnet, err := net.ParseCIDR(p); err == nil {
+			if listed == nil {
+				listed, _ = addrs()
+			}
+			for _, a := range listed {
+				if ipnet, ok := a.(*net.IPNet); ok && subnet.Contains(ipnet.IP) {
+					return true
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckInterfacePatterns returns an error for the first entry that is
+// neither a valid CIDR nor a valid name pattern.
+func CheckInterfacePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.Contains(p, "/") {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				return fmt.Errorf("invalid interface CIDR %q", p)
+			}
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid interface pattern %q", p)
+		}
+	}
+	return nil
+}
+
+// RunMDNS registers this device and browses for others with mDNS, and
+// starts both over on the current interfaces whenever they change, until
+// ctx is done.
+func RunMDNS(ctx context.Context) error {
+	changes := InterfaceChanges(ctx)
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		if reason := Paused(); reason != "" {
+			discoveryLog.Info("mDNS paused", "reason", reason)
+		} else if len(getAllInterfaces()) == 0 {
+			discoveryLog.Warn("No network interface to run mDNS on, waiting for one")
+		} else {
+			// Both log their own errors; a failure waits for the next change
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				RegisterDevice(runCtx, "")
+			}()
+			go func() {
+				defer wg.Done()
+				BrowseForDevices(runCtx)
+			}()
+		}
+
+		select {
+		case <-changes:
+			discoveryLog.Info("Restarting mDNS")
+		case <-ctx.Done():
+		}
+		cancel()
+		wg.Wait()
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
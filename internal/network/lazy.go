@@ -0,0 +1,300 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+	"clipsync/internal/view"
+)
+
+// Clips that don't fit in a datagram, and in lazy mode every clip over
+// lazyMin, are announced instead of sent to peers that said they can
+// fetch: an offer frame carries the clip's hash, type, size and a short
+// preview, and the peer fetches the body over TCP when it wants it.
+// Bodies are kept in the clip cache, so a clip copied again is free.
+
+// Offer announces a clip a peer can fetch.
+type Offer struct {
+	Hash    string `json:"hash"`
+	Type    string `json:"type"`
+	Size    int    `json:"size"`
+	Preview string `json:"preview,omitempty"`
+	// Port is where the sender serves clips.
+	Port int `json:"port"`
+	// Sensitive clips must not be saved to disk, and have no preview.
+	Sensitive bool `json:"sensitive,omitempty"`
+}
+
+// LazyOptions configures announce-then-fetch.
+type LazyOptions struct {
+	// Enabled announces every clip over lazyMin bytes, not just the ones
+	// too large to send.
+	Enabled bool
+	// FetchBelow is the size up to which announced clips are fetched as
+	// soon as they arrive.
+	FetchBelow int
+}
+
+// DefaultFetchBelow is the size up to which offers are fetched right away.
+const DefaultFetchBelow = 256 << 10
+
+// Lazy is set by the engine before sync starts.
+var Lazy = LazyOptions{FetchBelow: DefaultFetchBelow}
+
+const (
+	// lazyMin is the smallest clip worth announcing; below that the offer
+	// costs about as much as the clip.
+	lazyMin = 16 << 10
+	// MaxOffer is the largest clip that is announced.
+	MaxOffer = 64 << 20
+	// previewRunes is how much of a text clip an offer previews.
+	previewRunes = 200
+	// maxOffers bounds the offers remembered for fetching.
+	maxOffers = 64
+)
+
+// Offers delivers the clips peers announce, for the engine to fetch or
+// list in the history.
+var Offers = make(chan Offer, 16)
+
+var (
+	offersMu sync.Mutex
+	// offered maps each recent offer's hash to the offer and the
+	// addresses it can be fetched from, oldest hash first in offerOrder.
+	offered    = map[string]*offerSources{}
+	offerOrder []string
+)
+
+type offerSources struct {
+	offer Offer
+	addrs []string
+}
+
+// ErrNotOffered is returned when fetching a clip no peer announced.
+var ErrNotOffered = errors.New("clip is no longer offered by any peer")
+
+// newOffer caches data so peers can fetch it and returns its offer.
+func newOffer(data []byte, sensitive bool) Offer {
+	o := Offer{
+		Hash:      hashClip(data),
+		Type:      http.DetectContentType(data),
+		Size:      len(data),
+		Port:      globals.TCPPort,
+		Sensitive: sensitive,
+	}
+	if utf8.Valid(data) && !sensitive {
+		runes := []rune(string(data[:min(len(data), previewRunes*utf8.UTFMax)]))
+		o.Preview = string(runes[:min(len(runes), previewRunes)])
+	}
+	cache.put(o.Hash, data)
+	return o
+}
+
+// handleOffer remembers where an announced clip can be fetched from and
+// hands the offer to the engine.
+func handleOffer(ip string, payload []byte) {
+	var o Offer
+	if err := json.Unmarshal(payload, &o); err != nil {
+		logger.Debug("Ignoring malformed offer", "peer", ip, logging.Err(err))
+		metrics.DecodeErrors.Inc()
+		return
+	}
+	if _, err := hex.DecodeString(o.Hash); err != nil || len(o.Hash) != 64 || o.Size <= 0 || o.Size > MaxOffer || o.Port <= 0 {
+		logger.Debug("Ignoring invalid offer", "peer", ip, "hash", o.Hash, "bytes", o.Size)
+		metrics.DecodeErrors.Inc()
+		return
+	}
+	addr := net.JoinHostPort(ip, strconv.Itoa(o.Port))
+
+	offersMu.Lock()
+	src, ok := offered[o.Hash]
+	if !ok {
+		src = &offerSources{offer: o}
+		offered[o.Hash] = src
+		offerOrder = append(offerOrder, o.Hash)
+		if len(offerOrder) > maxOffers {
+			delete(offered, offerOrder[0])
+			offerOrder = offerOrder[1:]
+		}
+	}
+	if !slices.Contains(src.addrs, addr) {
+		src.addrs = append(src.addrs, addr)
+	}
+	offersMu.Unlock()
+
+	logger.Debug("Peer offered a clip", "peer", ip, "type", o.Type, "bytes", o.Size)
+	select {
+	case Offers <- o:
+	default:
+		logger.Warn("Dropping offer, engine is busy", "peer", ip)
+	}
+}
+
+var fetchClient = &http.Client{Timeout: 2 * time.Minute}
+
+// Fetch returns the body of an announced clip, from the clip cache or
+// from one of the peers that offered it.
+func Fetch(ctx context.Context, hash string) ([]byte, error) {
+	if data, ok := cache.get(hash); ok {
+		metrics.FetchCacheHits.Inc()
+		return accept(data), nil
+	}
+	offersMu.Lock()
+	src, ok := offered[hash]
+	var o Offer
+	var addrs []string
+	if ok {
+		o, addrs = src.offer, slices.Clone(src.addrs)
+	}
+	offersMu.Unlock()
+	if len(addrs) == 0 {
+		return nil, ErrNotOffered
+	}
+
+	var err error
+	for _, addr := range addrs {
+		var data []byte
+		data, err = fetchFrom(ctx, addr, o)
+		if errors.Is(err, context.Canceled) {
+			return nil, err
+		}
+		if err != nil {
+			logger.Warn("Could not fetch clip", "peer", addr, logging.Err(err))
+			continue
+		}
+		ip, _, _ := net.SplitHostPort(addr)
+		if o.Sensitive {
+			logger.Debug("Fetched clip", "peer", ip, logging.SensitiveClip(data))
+		} else {
+			logger.Debug("Fetched clip", "peer", ip, logging.Clip(data))
+		}
+		metrics.ClipsFetched.With(ip).Inc()
+		metrics.BytesReceived.With(ip).Add(uint64(len(data)))
+		cache.put(hash, data)
+		return accept(data), nil
+	}
+	return nil, err
+}
+
+// FetchClip fetches the body of a pending history entry and fills it in.
+func FetchClip(ctx context.Context, clip globals.Clip) ([]byte, error) {
+	data, err := Fetch(ctx, clip.Hash)
+	if err != nil {
+		return nil, err
+	}
+	clip.Data, clip.Pending = string(data), false
+	view.FillClip(clip)
+	return data, nil
+}
+
+// fetchFrom fetches the clip o announces from addr, as a transfer.
+func fetchFrom(ctx context.Context, addr string, o Offer) (data []byte, err error) {
+	ip, _, _ := net.SplitHostPort(addr)
+	t, ctx := startTransfer(ctx, "in", ip, o.Type, int64(o.Size))
+	defer func() { t.finish(err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/clips/"+o.Hash, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("peer answered %s", resp.Status)
+	}
+	var buf bytes.Buffer
+	if _, err := io.Copy(io.MultiWriter(&buf, t), io.LimitReader(resp.Body, MaxOffer+1)); err != nil {
+		return nil, err
+	}
+	if hashClip(buf.Bytes()) != o.Hash {
+		return nil, errors.New("clip does not match its hash")
+	}
+	return buf.Bytes(), nil
+}
+
+// accept makes data the last received clip, so the clipboard watcher
+// does not send it back.
+func accept(data []byte) []byte {
+	data, _ = SetReceived(data)
+	return data
+}
+
+// ServeClips serves offered clips to peers on the TCP port until ctx is
+// done. Without the port peers can't fetch, which is logged rather than
+// fatal: clips that fit in a datagram still sync.
+func ServeClips(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /clips/{hash}", peersOnly(serveClip))
+	mux.HandleFunc("GET /files/{id}", peersOnly(serveManifest))
+	mux.HandleFunc("GET /files/{id}/{index}", peersOnly(serveFile))
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(globals.TCPPort))
+	if err != nil {
+		logger.Warn("Could not open the transfer port, peers can't fetch large clips", logging.Err(err))
+		return nil
+	}
+	logger.Info("Serving clips to peers", "addr", ln.Addr().String())
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// peersOnly serves h to known peers while sync is not paused.
+func peersOnly(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if Paused() != "" {
+			http.Error(w, "Sync is paused", http.StatusServiceUnavailable)
+			return
+		}
+		globals.IPSMu.Lock()
+		known := slices.Contains(globals.IPS, ip)
+		globals.IPSMu.Unlock()
+		if !known {
+			logger.Debug("Refusing transfer to unknown host", "from", ip, "path", r.URL.Path)
+			http.Error(w, "Not a peer", http.StatusForbidden)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// serveClip hands a cached clip to a peer.
+func serveClip(w http.ResponseWriter, r *http.Request) {
+	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+	data, ok := cache.get(r.PathValue("hash"))
+	if !ok {
+		http.Error(w, "No such clip", http.StatusNotFound)
+		return
+	}
+	t, _ := startTransfer(r.Context(), "out", ip, http.DetectContentType(data), int64(len(data)))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	n, err := io.Copy(progressWriter{w: w, t: t}, bytes.NewReader(data))
+	t.finish(err)
+	metrics.BytesSent.With(ip).Add(uint64(n))
+}
@@ -0,0 +1,185 @@
+package network
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/metrics"
+)
+
+// Every datagram is checked against its source before it is decoded.
+// Sources get a token bucket of frames, tighter for hosts that are not
+// peers yet, and those may only send the handshake. A stranger that
+// breaks the rules strikeLimit times within strikeWindow is blocked for
+// blockFor, and everything it sends is dropped unread. Peers are never
+// blocked: frames over their rate are dropped, nothing more.
+const (
+	peerRate      = 20 // frames per second
+	peerBurst     = 50
+	strangerRate  = 1
+	strangerBurst = 5
+
+	strikeLimit  = 10
+	strikeWindow = time.Minute
+	blockFor     = 5 * time.Minute
+
+	// maxControlFrame bounds every frame but clips, which carry at most
+	// a handshake, a codec list or a small JSON offer.
+	maxControlFrame = 4 << 10
+	// maxSources bounds the sources tracked. Idle ones are dropped first,
+	// then the one seen longest ago.
+	maxSources = 1024
+)
+
+type source struct {
+	tokens  float64
+	last    time.Time
+	strikes []time.Time
+	blocked time.Time
+}
+
+var (
+	sourcesMu sync.Mutex
+	sources   = map[string]*source{}
+)
+
+func init() {
+	metrics.NewGaugeFunc("clipsync_blocked_sources", "Source addresses currently blocked.", func() float64 {
+		return float64(len(Blocked()))
+	})
+}
+
+// admit reports whether ip may send another frame right now. Blocked
+// strangers and sources over their rate are turned away.
+func admit(ip string) bool {
+	known := isPeer(ip)
+	now := time.Now()
+
+	sourcesMu.Lock()
+	s := lookupSource(ip, now)
+	if !known && now.Before(s.blocked) {
+		sourcesMu.Unlock()
+		metrics.FramesRejected.With("blocked").Inc()
+		return false
+	}
+	rate, burst := float64(strangerRate), float64(strangerBurst)
+	if known {
+		rate, burst = peerRate, peerBurst
+	}
+	s.tokens = min(burst, s.tokens+now.Sub(s.last).Seconds()*rate)
+	s.last = now
+	ok := s.tokens >= 1
+	if ok {
+		s.tokens--
+	}
+	sourcesMu.Unlock()
+
+	if !ok {
+		reject(ip, "rate_limited")
+	}
+	return ok
+}
+
+// checkFrame enforces the size of each frame kind, and that only peers
+// send anything but the handshake.
+func checkFrame(ip string, kind, codec byte, payload []byte) bool {
+	if kind != frameData && kind != frameSensitive && len(payload) > maxControlFrame {
+		reject(ip, "oversize")
+		return false
+	}
+	// A goodbye from a stranger is harmless: there is nothing to forget
+	if isPeer(ip) || kind == frameBye || kind == frameData && codec == codecNone && slices.Equal(payload, handshake) {
+		return true
+	}
+	reject(ip, "unauthenticated")
+	return false
+}
+
+// reject counts a broken rule against ip, and blocks it once it has too
+// many. Peers are not held to strikes.
+func reject(ip, reason string) {
+	metrics.FramesRejected.With(reason).Inc()
+	if isPeer(ip) {
+		logger.Debug("Dropped frame from peer", "peer", ip, "reason", reason)
+		return
+	}
+	now := time.Now()
+
+	sourcesMu.Lock()
+	s := lookupSource(ip, now)
+	s.strikes = slices.DeleteFunc(append(s.strikes, now), func(t time.Time) bool {
+		return now.Sub(t) > strikeWindow
+	})
+	blocked := len(s.strikes) >= strikeLimit
+	if blocked {
+		s.blocked, s.strikes = now.Add(blockFor), nil
+	}
+	sourcesMu.Unlock()
+
+	if blocked {
+		logger.Warn("Blocking misbehaving source", "source", ip, "reason", reason, "for", blockFor)
+		metrics.SourcesBlocked.Inc()
+	} else {
+		logger.Debug("Rejected frame", "source", ip, "reason", reason)
+	}
+}
+
+// lookupSource returns the state of ip, dropping idle sources when there
+// are too many. sourcesMu must be held.
+func lookupSource(ip string, now time.Time) *source {
+	s, ok := sources[ip]
+	if ok {
+		return s
+	}
+	if len(sources) >= maxSources {
+		var oldest string
+		for k, old := range sources {
+			switch {
+			case now.Sub(old.last) > strikeWindow && now.After(old.blocked):
+				delete(sources, k)
+			case oldest == "" || evictFirst(old, sources[oldest], now):
+				oldest = k
+			}
+		}
+		// Still full of active sources, as when a flood comes from many
+		// addresses: forget the one seen longest ago
+		if len(sources) >= maxSources {
+			delete(sources, oldest)
+		}
+	}
+	s = &source{tokens: strangerBurst, last: now}
+	sources[ip] = s
+	return s
+}
+
+// evictFirst reports whether a should be dropped before b. Blocked
+// sources are kept while there are others, so a flood can't lift a block.
+func evictFirst(a, b *source, now time.Time) bool {
+	if aBlocked, bBlocked := now.Before(a.blocked), now.Before(b.blocked); aBlocked != bBlocked {
+		return bBlocked
+	}
+	return a.last.Before(b.last)
+}
+
+func isPeer(ip string) bool {
+	globals.IPSMu.Lock()
+	defer globals.IPSMu.Unlock()
+	return slices.Contains(globals.IPS, ip)
+}
+
+// Blocked returns the sources blocked right now and when their block
+// ends.
+func Blocked() map[string]time.Time {
+	now := time.Now()
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	out := map[string]time.Time{}
+	for ip, s := range sources {
+		if now.Before(s.blocked) {
+			out[ip] = s.blocked
+		}
+	}
+	return out
+}
@@ -1,12 +1,621 @@
 package network_test
 
 import (
+	"bytes"
 	"clipsync/internal/globals"
 	"clipsync/internal/network"
+	"clipsync/internal/view"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// The focused tests share one node listening on the sync and transfer
+// ports, which is its own peer over loopback. TestFullNetworkWorkflow
+// comes last, as it leaves a receiver running.
+
+var startNode = sync.OnceFunc(func() {
+	go network.Listen(context.Background())
+	go network.ServeClips(context.Background())
+	<-network.Ready
+})
+
+// loopback starts the node and makes it its own peer, handshake and
+// hello included.
+func loopback(t *testing.T) {
+	t.Helper()
+	startNode()
+	network.AddPeer("127.0.0.1", globals.PORT)
+	receiveUntil(500*time.Millisecond, func([]byte) bool { return false })
+}
+
+// receiveUntil handles incoming frames until done accepts a clip, or
+// whatever else it waits for, or timeout passes. done is called after
+// every frame, with nil for frames that are not clips.
+func receiveUntil(timeout time.Duration, done func(clip []byte) bool) bool {
+	deadline := time.Now().Add(timeout)
+	network.Conn.SetReadDeadline(deadline)
+	defer network.Conn.SetReadDeadline(time.Time{})
+	for time.Now().Before(deadline) {
+		buf, n := network.RecieveClipboard()
+		if done(bytes.Clone(buf[:n])) {
+			return true
+		}
+	}
+	return false
+}
+
+// receiveClip returns the next clip the node accepts, or nil.
+func receiveClip(timeout time.Duration) []byte {
+	var got []byte
+	receiveUntil(timeout, func(clip []byte) bool {
+		got = clip
+		return len(clip) > 0
+	})
+	return got
+}
+
+// receiveOffer returns the next clip a peer announces.
+func receiveOffer(t *testing.T) network.Offer {
+	t.Helper()
+	var got network.Offer
+	ok := receiveUntil(5*time.Second, func([]byte) bool {
+		select {
+		case got = <-network.Offers:
+			return true
+		default:
+			return false
+		}
+	})
+	if !ok {
+		t.Fatal("Timed out waiting for the offer")
+	}
+	return got
+}
+
+func TestCompressedClip(t *testing.T) {
+	loopback(t)
+
+	// Too large for one datagram unless compressed, and not announced
+	// since the peer said it takes zstd
+	big := strings.Repeat("2026-10-18T09:12:44Z INFO request served in 3ms\n", 5000)
+	network.SendClipboard([]byte(big))
+	if got := receiveClip(5 * time.Second); string(got) != big {
+		t.Errorf("Compressed clip arrived as %d bytes, want %d", len(got), len(big))
+	}
+}
+
+func TestSensitiveClip(t *testing.T) {
+	loopback(t)
+
+	// The receiver learns the clip is sensitive, so its history entry is
+	// never saved
+	network.SendSensitive([]byte("hunter2"))
+	if got := receiveClip(5 * time.Second); string(got) != "hunter2" {
+		t.Fatalf("Sensitive clip arrived as %q", got)
+	}
+	if !view.Sensitive("hunter2") {
+		t.Error("Received clip was not marked sensitive")
+	}
+	network.SendClipboard([]byte("public"))
+	receiveClip(5 * time.Second)
+	if view.Sensitive("public") {
+		t.Error("Plain clip was marked sensitive")
+	}
+}
+
+func TestLazyOffer(t *testing.T) {
+	loopback(t)
+
+	// Random data does not compress, so it is announced and served over TCP
+	image := make([]byte, 200<<10)
+	rand.Read(image)
+	network.SendClipboard(image)
+	o := receiveOffer(t)
+	if o.Size != len(image) || o.Type != "application/octet-stream" {
+		t.Fatalf("Offer = %+v, want %d bytes of octet-stream", o, len(image))
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%s/clips/%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(o.Port)), o.Hash))
+	if err != nil {
+		t.Fatalf("Fetching the clip failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !bytes.Equal(body, image) {
+		t.Errorf("Fetched %d bytes (%s), want the %d byte clip", len(body), resp.Status, len(image))
+	}
+
+	// Clips only go to peers
+	if status := strangerGet(fmt.Sprintf("/clips/%s", o.Hash), o.Port); status != 0 && status != http.StatusForbidden {
+		t.Errorf("A stranger fetching the clip got %d, want 403", status)
+	}
+}
+
+// strangerGet fetches path from 127.0.0.2, which is not a peer, and
+// returns the status, or 0 where that address is not available.
+// TestReceivedConcurrently sets the last received clip from several
+// goroutines, as fetched offers and the relay do, while it is read; run
+// with -race.
+func TestReceivedConcurrently(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			clip := []byte("clip " + strconv.Itoa(i))
+			for range 100 {
+				network.SetReceived(clip)
+				network.IsReceived(clip)
+			}
+		})
+	}
+	wg.Wait()
+	if _, changed := network.SetReceived([]byte("last")); !changed {
+		t.Error("New clip was reported as already received")
+	}
+	if _, changed := network.SetReceived([]byte("last")); changed {
+		t.Error("Same clip was reported as new")
+	}
+	if !network.IsReceived([]byte("last")) {
+		t.Error("Last received clip is not reported as received")
+	}
+}
+
+func strangerGet(path string, port int) int {
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 2)}}
+	client := &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	resp, err := client.Get(fmt.Sprintf("http://%s%s", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)), path))
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+// sendProject sends a folder of two files, one of them size bytes, and
+// returns its offer and the large file.
+func sendProject(t *testing.T, size int) (network.FileOffer, []byte) {
+	t.Helper()
+	data := make([]byte, size)
+	rand.Read(data)
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "project", "docs"), 0755)
+	os.WriteFile(filepath.Join(src, "project", "main.go"), []byte("package main\n"), 0644)
+	os.WriteFile(filepath.Join(src, "project", "docs", "notes.txt"), data, 0644)
+	if err := network.SendFiles([]string{filepath.Join(src, "project")}); err != nil {
+		t.Fatalf("SendFiles: %v", err)
+	}
+	var o network.FileOffer
+	ok := receiveUntil(5*time.Second, func([]byte) bool {
+		select {
+		case o = <-network.FileOffers:
+			return true
+		default:
+			return false
+		}
+	})
+	if !ok {
+		t.Fatal("Timed out waiting for the files offer")
+	}
+	return o, data
+}
+
+func TestFiles(t *testing.T) {
+	loopback(t)
+	o, data := sendProject(t, 100<<10)
+
+	// Files only go to peers, and not while sync is paused
+	for _, path := range []string{"/files/" + o.ID, "/files/" + o.ID + "/0"} {
+		if status := strangerGet(path, o.Port); status != 0 && status != http.StatusForbidden {
+			t.Errorf("A stranger fetching %s got %d, want 403", path, status)
+		}
+	}
+	network.Pause("test")
+	_, err := network.ReceiveFiles(t.Context(), o, t.TempDir())
+	// The node said goodbye to itself on pausing
+	receiveUntil(200*time.Millisecond, func([]byte) bool { return false })
+	network.Resume()
+	if err == nil {
+		t.Error("Files were served while sync was paused")
+	}
+	// Pausing forgot the peer
+	loopback(t)
+
+	// Copied folders arrive in the inbox with their checksums verified,
+	// and a name that is taken already gets a number
+	inbox := t.TempDir()
+	os.Mkdir(filepath.Join(inbox, "project"), 0755)
+	paths, err := network.ReceiveFiles(t.Context(), o, inbox)
+	if err != nil {
+		t.Fatalf("ReceiveFiles: %v", err)
+	}
+	if want := filepath.Join(inbox, "project (1)"); len(paths) != 1 || paths[0] != want {
+		t.Errorf("ReceiveFiles returned %v, want [%s]", paths, want)
+	}
+	got, _ := os.ReadFile(filepath.Join(inbox, "project (1)", "docs", "notes.txt"))
+	if !bytes.Equal(got, data) {
+		t.Errorf("Received file has %d bytes, want %d", len(got), len(data))
+	}
+	if got, _ := os.ReadFile(filepath.Join(inbox, "project (1)", "main.go")); string(got) != "package main\n" {
+		t.Errorf("Received main.go = %q", got)
+	}
+}
+
+func TestTransfers(t *testing.T) {
+	loopback(t)
+	before := network.Transfers()
+	o, _ := sendProject(t, 300<<10)
+	if _, err := network.ReceiveFiles(t.Context(), o, t.TempDir()); err != nil {
+		t.Fatalf("ReceiveFiles: %v", err)
+	}
+
+	// Both ends of the fetch were tracked to completion
+	var in, out int
+	for _, tr := range network.Transfers() {
+		if slices.ContainsFunc(before, func(b globals.Transfer) bool { return b.ID == tr.ID }) {
+			continue
+		}
+		if tr.State != globals.TransferDone || tr.Done != tr.Size {
+			t.Errorf("Transfer %+v did not complete", tr)
+		}
+		if tr.Direction == "in" {
+			in++
+		} else {
+			out++
+		}
+		if err := network.CancelTransfer(tr.ID); err != network.ErrNoTransfer {
+			t.Errorf("CancelTransfer of a finished transfer = %v, want ErrNoTransfer", err)
+		}
+	}
+	if in != 1 || out == 0 {
+		t.Errorf("Got %d inbound and %d outbound transfers, want one inbound and some outbound", in, out)
+	}
+	if err := network.CancelTransfer("nope"); err != network.ErrNoTransfer {
+		t.Errorf("CancelTransfer of an unknown id = %v, want ErrNoTransfer", err)
+	}
+}
+
+// stranger returns a socket on another loopback address, one that is not
+// a peer of the node. Each test uses its own, as strangers stay blocked.
+func stranger(t *testing.T, ip net.IP) *net.UDPConn {
+	t.Helper()
+	conn, err := net.DialUDP("udp", &net.UDPAddr{IP: ip}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: globals.PORT})
+	if err != nil {
+		t.Skipf("%s is not available: %v", ip, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestStrangerBlocked(t *testing.T) {
+	loopback(t)
+	conn := stranger(t, net.IPv4(127, 0, 0, 2))
+
+	// A host that never did the handshake can't set the clipboard, and is
+	// blocked once it keeps trying
+	frame := append([]byte{0, 0, 0, 5}, "spoof"...)
+	for range 12 {
+		conn.Write(frame)
+	}
+	var accepted []byte
+	ok := receiveUntil(2*time.Second, func(clip []byte) bool {
+		if len(clip) > 0 {
+			accepted = clip
+		}
+		return !network.Blocked()["127.0.0.2"].IsZero()
+	})
+	if accepted != nil {
+		t.Errorf("Clip %q from a stranger was accepted", accepted)
+	}
+	if !ok {
+		t.Error("Stranger was not blocked")
+	}
+}
+
+func TestHandshakeFlood(t *testing.T) {
+	loopback(t)
+	conn := stranger(t, net.IPv4(127, 0, 0, 3))
+
+	// The handshake alone does not make a host a peer, so the clips it
+	// sends after it are refused until it is blocked
+	conn.Write(append([]byte{0, 0, 0, 14}, "---ClipSync---"...))
+	frame := append([]byte{0, 0, 0, 5}, "flood"...)
+	for range 12 {
+		conn.Write(frame)
+	}
+	var accepted []byte
+	ok := receiveUntil(2*time.Second, func(clip []byte) bool {
+		if len(clip) > 0 {
+			accepted = clip
+		}
+		return !network.Blocked()["127.0.0.3"].IsZero()
+	})
+	if accepted != nil {
+		t.Errorf("Clip %q sent after a handshake was accepted", accepted)
+	}
+	if !ok {
+		t.Error("Host flooding after a handshake was not blocked")
+	}
+	globals.IPSMu.Lock()
+	promoted := slices.Contains(globals.IPS, "127.0.0.3")
+	globals.IPSMu.Unlock()
+	if promoted {
+		t.Error("Handshake made a stranger a peer")
+	}
+}
+
+func TestPeerFlood(t *testing.T) {
+	loopback(t)
+
+	// A peer over its rate loses the extra frames but is never blocked
+	for i := range 200 {
+		network.SendClipboard([]byte("flood " + strconv.Itoa(i)))
+	}
+	receiveUntil(time.Second, func([]byte) bool { return false })
+	if until, ok := network.Blocked()["127.0.0.1"]; ok {
+		t.Fatalf("Flooding peer was blocked until %v", until)
+	}
+	time.Sleep(100 * time.Millisecond)
+	network.SendClipboard([]byte("after the flood"))
+	if got := receiveClip(2 * time.Second); string(got) != "after the flood" {
+		t.Errorf("Clip after the flood = %q, want it accepted", got)
+	}
+}
+
+// TestSourceFlood checks frames from more addresses than are tracked
+// neither grow the table past its bound nor lift a block.
+func TestSourceFlood(t *testing.T) {
+	for range 10 {
+		network.Reject("10.255.0.1", "malformed")
+	}
+	if network.Blocked()["10.255.0.1"].IsZero() {
+		t.Fatal("Source was not blocked")
+	}
+	for i := range network.MaxSources + 500 {
+		network.Admit(fmt.Sprintf("10.%d.%d.%d", i>>16&0xFF, i>>8&0xFF, i&0xFF))
+	}
+	if n := network.Sources(); n > network.MaxSources {
+		t.Errorf("%d sources tracked, want at most %d", n, network.MaxSources)
+	}
+	if network.Blocked()["10.255.0.1"].IsZero() {
+		t.Error("Flood from other addresses lifted a block")
+	}
+}
+
+// TestHandshakeAnswered checks the handshake of a peer is answered with a
+// hello, even before it says hello itself, which clipsync connect waits for.
+func TestHandshakeAnswered(t *testing.T) {
+	loopback(t)
+	conn := stranger(t, net.IPv4(127, 0, 0, 4))
+	network.AddPeer("127.0.0.4", conn.LocalAddr().(*net.UDPAddr).Port)
+	defer func() {
+		conn.Write([]byte{1, 0, 0, 0})
+		receiveUntil(200*time.Millisecond, func([]byte) bool { return false })
+	}()
+
+	// Our own handshake and hello, sent by AddPeer
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			break
+		}
+	}
+
+	conn.Write(append([]byte{0, 0, 0, 14}, "---ClipSync---"...))
+	receiveUntil(500*time.Millisecond, func([]byte) bool { return false })
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Handshake was not answered: %v", err)
+	}
+	if n < 4 || buf[0] != 2 {
+		t.Errorf("Handshake was answered with % x, want a hello", buf[:n])
+	}
+}
+
+func TestStaticPeerResolverFailure(t *testing.T) {
+	var fail bool
+	defer network.SetLookupHost(func(ctx context.Context, host string) ([]string, error) {
+		if fail {
+			return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+		}
+		return []string{"192.0.2.7"}, nil
+	})()
+	// isPeer waits a moment for the greeting, which runs in the background
+	isPeer := func() bool {
+		for range 50 {
+			globals.IPSMu.Lock()
+			ok := slices.Contains(globals.IPS, "192.0.2.7")
+			globals.IPSMu.Unlock()
+			if ok {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+
+	network.SetStaticPeers([]string{"desk.example"})
+	network.ResolveStatic(t.Context())
+	if !network.IsStatic("192.0.2.7") || !isPeer() {
+		t.Fatal("Static peer was not added")
+	}
+
+	// A failed lookup keeps the peer on its last good address
+	fail = true
+	network.ResolveStatic(t.Context())
+	peers := network.StaticPeers()
+	if !network.IsStatic("192.0.2.7") || !isPeer() {
+		t.Error("Static peer was dropped after a failed lookup")
+	}
+	if len(peers) != 1 || !slices.Equal(peers[0].IPs, []string{"192.0.2.7"}) || peers[0].Error == "" {
+		t.Errorf("StaticPeers() = %+v, want the last good address and the error", peers)
+	}
+
+	// Taking it off the list drops it
+	network.SetStaticPeers(nil)
+	network.ResolveStatic(t.Context())
+	if network.IsStatic("192.0.2.7") || isPeer() {
+		t.Error("Static peer was kept after it was removed")
+	}
+}
+
+func TestParsePeer(t *testing.T) {
+	tests := []struct {
+		address string
+		host    string
+		port    int
+		ok      bool
+	}{
+		{"192.168.1.20", "192.168.1.20", globals.PORT, true},
+		{"laptop.local:9000", "laptop.local", 9000, true},
+		{"fe80::1", "fe80::1", globals.PORT, true},
+		{"[fe80::1]:9000", "fe80::1", 9000, true},
+		{"laptop:0", "", 0, false},
+		{"laptop:http", "", 0, false},
+		{"bad host", "", 0, false},
+		{":9000", "", 0, false},
+		{"", "", 0, false},
+	}
+	for _, tt := range tests {
+		host, port, err := network.ParsePeer(tt.address)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParsePeer(%q) error = %v, want ok = %v", tt.address, err, tt.ok)
+			continue
+		}
+		if tt.ok && (host != tt.host || port != tt.port) {
+			t.Errorf("ParsePeer(%q) = %s, %d, want %s, %d", tt.address, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestCheckInterfacePatterns(t *testing.T) {
+	if err := network.CheckInterfacePatterns([]string{"eth0", "docker*", "10.0.0.0/8", "fd00::/8"}); err != nil {
+		t.Errorf("valid patterns rejected: %v", err)
+	}
+	for _, bad := range []string{"10.0.0.0/33", "wlan[", "192.168.1.1/"} {
+		if err := network.CheckInterfacePatterns([]string{bad}); err == nil {
+			t.Errorf("CheckInterfacePatterns(%q) accepted an invalid pattern", bad)
+		}
+	}
+}
+
+func TestSubnetBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.20/24", "192.168.1.255"},
+		{"10.1.2.3/8", "10.255.255.255"},
+		{"172.16.5.4/20", "172.16.15.255"},
+		{"192.168.1.130/25", "192.168.1.255"},
+		{"192.168.1.10/30", "192.168.1.11"},
+		// Point-to-point and single-host networks have no broadcast
+		{"192.168.1.10/31", ""},
+		{"192.168.1.10/32", ""},
+		{"fe80::1/64", ""},
+	}
+	for _, tt := range tests {
+		ip, ipnet, err := net.ParseCIDR(tt.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Interfaces report their own address, not the network's
+		ipnet.IP = ip
+		got := network.SubnetBroadcast(ipnet)
+		if (got == nil && tt.want != "") || (got != nil && got.String() != tt.want) {
+			t.Errorf("subnetBroadcast(%s) = %v, want %q", tt.cidr, got, tt.want)
+		}
+	}
+}
+
+func TestAnnouncementChallenge(t *testing.T) {
+	challenge, verify := network.NewChallenges()
+	now := time.Now()
+
+	nonce := challenge("192.168.1.20", "laptop", now)
+	if nonce == "" {
+		t.Fatal("no challenge for a new device")
+	}
+	if again := challenge("192.168.1.20", "laptop", now); again != "" {
+		t.Error("a second challenge went out while one is pending")
+	}
+	if _, ok := verify("192.168.1.20", "guess", now); ok {
+		t.Error("a wrong nonce verified the device")
+	}
+	if _, ok := verify("192.168.1.99", nonce, now); ok {
+		t.Error("the nonce verified a device at another address")
+	}
+	if instance, ok := verify("192.168.1.20", nonce, now.Add(time.Second)); !ok || instance != "laptop" {
+		t.Errorf("verify = %q, %v, want the announced device", instance, ok)
+	}
+	if _, ok := verify("192.168.1.20", nonce, now); ok {
+		t.Error("a nonce verified the device twice")
+	}
+
+	// Late answers don't count, and free the slot for a new challenge
+	nonce = challenge("192.168.1.30", "desktop", now)
+	if _, ok := verify("192.168.1.30", nonce, now.Add(time.Minute)); ok {
+		t.Error("an expired challenge verified the device")
+	}
+	if challenge("192.168.1.30", "desktop", now.Add(time.Minute)) == "" {
+		t.Error("no new challenge after the last one expired")
+	}
+
+	// A flood of forged announcements fills the table, but no further
+	for i := range 300 {
+		challenge(fmt.Sprintf("10.0.%d.%d", i/256, i%256), "forged", now)
+	}
+	if challenge("192.168.1.40", "late", now) != "" {
+		t.Error("the challenge table grew past its limit")
+	}
+}
+
+func TestSelectInterface(t *testing.T) {
+	eth0 := []string{"192.168.1.20/24", "fe80::1/64"}
+	tests := []struct {
+		name    string
+		iface   string
+		addrs   []string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{"empty config", "eth0", eth0, nil, nil, true},
+		{"exact name", "eth0", eth0, []string{"eth0"}, nil, true},
+		{"other name", "wlan0", nil, []string{"eth0"}, nil, false},
+		{"name is not a prefix", "eth01", nil, []string{"eth0"}, nil, false},
+		{"glob", "docker0", nil, nil, []string{"docker*"}, false},
+		{"glob miss", "eth0", eth0, nil, []string{"docker*", "veth?"}, true},
+		{"single character glob", "veth1", nil, nil, []string{"veth?"}, false},
+		{"IPv4 subnet", "eth0", eth0, []string{"192.168.0.0/16"}, nil, true},
+		{"IPv6 subnet", "eth0", eth0, []string{"fe80::/10"}, nil, true},
+		{"subnet miss", "eth0", eth0, []string{"10.0.0.0/8"}, nil, false},
+		{"no addresses", "tun0", nil, []string{"10.0.0.0/8"}, nil, false},
+		{"exclude wins by name", "eth0", eth0, []string{"eth*"}, []string{"eth0"}, false},
+		{"exclude wins by subnet", "eth0", eth0, []string{"eth0"}, []string{"192.168.1.0/24"}, false},
+		{"include by subnet, exclude misses", "eth0", eth0, []string{"192.168.0.0/16"}, []string{"wlan*"}, true},
+	}
+	for _, tt := range tests {
+		if got := network.SelectInterface(tt.iface, tt.addrs, tt.include, tt.exclude); got != tt.want {
+			t.Errorf("%s: select %s with include %v, exclude %v = %v, want %v", tt.name, tt.iface, tt.include, tt.exclude, got, tt.want)
+		}
+	}
+}
+
+// TestFullNetworkWorkflow discovers this machine over mDNS and syncs a
+// clip to it. It runs last: its receiver outlives it.
 func TestFullNetworkWorkflow(t *testing.T) {
 	// 1. Setup context and global variables
 	ctx := t.Context()
@@ -0,0 +1,98 @@
+package network
+
+import (
+	"slices"
+	"sync"
+
+	"clipsync/internal/globals"
+)
+
+var (
+	pauseMu     sync.Mutex
+	pauseReason string
+	// trusted is the interfaces discovery may run on, nil for any.
+	trusted []string
+)
+
+// Pause stops syncing, discovery and advertising, e.g. on an untrusted
+// network. Peers are told goodbye and forgotten; clips are neither sent
+// nor accepted until Resume.
+func Pause(reason string) {
+	pauseMu.Lock()
+	was := pauseReason
+	pauseReason = reason
+	pauseMu.Unlock()
+	if was != "" {
+		return
+	}
+	logger.Warn("Sync paused", "reason", reason)
+
+	globals.IPSMu.Lock()
+	ips := make([]string, len(globals.IPS))
+	copy(ips, globals.IPS)
+	globals.IPSMu.Unlock()
+
+	if Conn != nil && beginSend() {
+		bye := encodeFrame(frameBye, nil)
+		for _, ip := range ips {
+			if addr, err := peerAddr(ip); err == nil {
+				Conn.WriteToUDP(bye, addr)
+			}
+		}
+		sending.Done()
+	}
+	// Drop the devices list too, some are shown before they answer
+	globals.ConnDevicesMu.Lock()
+	for _, d := range globals.ConnDevices {
+		if !slices.Contains(ips, d.Ip) {
+			ips = append(ips, d.Ip)
+		}
+	}
+	globals.ConnDevicesMu.Unlock()
+	for _, ip := range ips {
+		forgetPeer(ip)
+	}
+	notifyWatchers()
+}
+
+// Resume undoes Pause: discovery starts again and static peers are
+// greeted.
+func Resume() {
+	pauseMu.Lock()
+	was := pauseReason
+	pauseReason = ""
+	pauseMu.Unlock()
+	if was == "" {
+		return
+	}
+	logger.Info("Sync resumed")
+	notifyWatchers()
+}
+
+// Paused returns why sync is paused, or "" while it runs.
+func Paused() string {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return pauseReason
+}
+
+// TrustInterfaces limits discovery to the named interfaces, those on a
+// trusted network, or lifts the limit for nil. mDNS and the announcer
+// move to the new set right away.
+func TrustInterfaces(names []string) {
+	pauseMu.Lock()
+	changed := !slices.Equal(trusted, names) || (trusted == nil) != (names == nil)
+	trusted = names
+	pauseMu.Unlock()
+	if changed {
+		logger.Info("Discovery interfaces trusted", "interfaces", names)
+		notifyWatchers()
+	}
+}
+
+// trustedInterface reports whether discovery may run on the interface.
+func trustedInterface(name string) bool {
+	pauseMu.Lock()
+	defer pauseMu.Unlock()
+	return trusted == nil || slices.Contains(trusted, name)
+}
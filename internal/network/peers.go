@@ -0,0 +1,245 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/view"
+)
+
+// resolveInterval is how often static peers are re-resolved and greeted
+// again, so DNS changes and restarts on either side are picked up.
+const resolveInterval = time.Minute
+
+// StaticPeer is a configured peer that is dialled directly instead of
+// being found through mDNS.
+type StaticPeer struct {
+	// Address is the entry as configured: host or host:port.
+	Address string   `json:"address" yaml:"address"`
+	IPs     []string `json:"ips,omitempty" yaml:"ips,omitempty"`
+	Error   string   `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+var (
+	peersMu sync.Mutex
+	// ports holds the sync port of peers not on the default one.
+	ports = map[string]int{}
+	// static is the configured list and what each entry resolved to.
+	static []StaticPeer
+	// staticIPs is every IP a static peer resolved to.
+	staticIPs = map[string]bool{}
+	reresolve = make(chan struct{}, 1)
+)
+
+// ParsePeer splits a host[:port] peer address. IPv6 addresses with a port
+// need brackets, e.g. [fe80::1]:9999.
+func ParsePeer(address string) (string, int, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		// No port given
+		host, portStr = address, strconv.Itoa(globals.PORT)
+	}
+	if net.ParseIP(host) == nil && !validHostname(host) {
+		return "", 0, fmt.Errorf("invalid peer address %q: want host or host:port", address)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in peer address %q", address)
+	}
+	return host, port, nil
+}
+
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+	for _, r := range host {
+		if !(r == '-' || r == '.' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// peerAddr returns the sync address of the peer at ip.
+func peerAddr(ip string) (*net.UDPAddr, error) {
+	peersMu.Lock()
+	port, ok := ports[ip]
+	peersMu.Unlock()
+	if !ok {
+		port = globals.PORT
+	}
+	return net.ResolveUDPAddr("udp", net.JoinHostPort(ip, strconv.Itoa(port)))
+}
+
+// rememberPort records the sync port a peer listens on.
+func rememberPort(ip string, port int) {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	if port == globals.PORT {
+		delete(ports, ip)
+	} else {
+		ports[ip] = port
+	}
+}
+
+// AddPeer adds the peer at ip to the send list and greets it.
+func AddPeer(ip string, port int) {
+	rememberPort(ip, port)
+	globals.IPSMu.Lock()
+	if !slices.Contains(globals.IPS, ip) {
+		globals.IPS = append(globals.IPS, ip)
+	}
+	globals.IPSMu.Unlock()
+	Connect(ip)
+}
+
+// IsStatic reports whether ip belongs to a configured static peer, which
+// is kept even while it does not answer.
+func IsStatic(ip string) bool {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	return staticIPs[ip]
+}
+
+// SetStaticPeers replaces the static peer list and resolves it again.
+func SetStaticPeers(addresses []string) {
+	peersMu.Lock()
+	static = make([]StaticPeer, len(addresses))
+	for i, a := range addresses {
+		static[i] = StaticPeer{Address: a}
+	}
+	peersMu.Unlock()
+
+	select {
+	case reresolve <- struct{}{}:
+	default:
+	}
+}
+
+// StaticPeers returns the static peers and what they resolved to.
+func StaticPeers() []StaticPeer {
+	peersMu.Lock()
+	defer peersMu.Unlock()
+	out := make([]StaticPeer, len(static))
+	for i, p := range static {
+		out[i] = p
+		out[i].IPs = slices.Clone(p.IPs)
+	}
+	return out
+}
+
+// RunStaticPeers resolves the static peers and greets them, again every
+// resolveInterval and whenever the list or the interfaces change, until
+// ctx is done.
+func RunStaticPeers(ctx context.Context) error {
+	changes := InterfaceChanges(ctx)
+	select {
+	case <-Ready:
+	case <-ctx.Done():
+		return nil
+	}
+	for {
+		resolveStatic(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-reresolve:
+		case <-changes:
+		case <-time.After(resolveInterval):
+		}
+	}
+}
+
+// lookupHost resolves static peer names; tests replace it.
+var lookupHost = net.DefaultResolver.LookupHost
+
+func resolveStatic(ctx context.Context) {
+	if Paused() != "" {
+		return
+	}
+	peersMu.Lock()
+	addresses := make([]string, len(static))
+	for i, p := range static {
+		addresses[i] = p.Address
+	}
+	peersMu.Unlock()
+
+	type result struct {
+		ips  []string
+		port int
+		err  error
+	}
+	results := map[string]result{}
+	for _, a := range addresses {
+		host, port, err := ParsePeer(a)
+		if err != nil {
+			results[a] = result{err: err}
+			continue
+		}
+		lookupCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		ips, err := lookupHost(lookupCtx, host)
+		cancel()
+		results[a] = result{ips: ips, port: port, err: err}
+	}
+
+	// A failed lookup keeps the addresses of the last good one, so a
+	// resolver hiccup does not disconnect the peer. Entries added while
+	// resolving keep what they have until the next round.
+	peersMu.Lock()
+	ipsNow := map[string]bool{}
+	for i := range static {
+		if r, ok := results[static[i].Address]; ok {
+			static[i].Error = ""
+			if r.err != nil {
+				static[i].Error = r.err.Error()
+			} else {
+				static[i].IPs = r.ips
+			}
+		}
+		for _, ip := range static[i].IPs {
+			ipsNow[ip] = true
+		}
+	}
+	old := staticIPs
+	staticIPs = ipsNow
+	peersMu.Unlock()
+
+	for _, a := range addresses {
+		r := results[a]
+		if r.err != nil {
+			logger.Warn("Could not resolve static peer", "peer", a, logging.Err(r.err))
+			continue
+		}
+		host, _, _ := ParsePeer(a)
+		for _, ip := range r.ips {
+			addDevice(globals.Device{Name: host, Ip: ip})
+			go AddPeer(ip, r.port)
+		}
+	}
+	// Peers taken off the list, or whose name moved, are dropped
+	for ip := range old {
+		if !ipsNow[ip] {
+			forgetPeer(ip)
+		}
+	}
+}
+
+// addDevice shows a device unless one with the same IP is listed already.
+func addDevice(dev globals.Device) {
+	globals.ConnDevicesMu.Lock()
+	known := slices.ContainsFunc(globals.ConnDevices, func(d globals.Device) bool {
+		return d.Ip == dev.Ip
+	})
+	globals.ConnDevicesMu.Unlock()
+	if !known {
+		view.UpdateDevices(dev)
+	}
+}
@@ -0,0 +1,53 @@
+package network
+
+import (
+	"context"
+	"net"
+
+	"clipsync/internal/globals"
+
+	"github.com/grandcat/zeroconf"
+)
+
+// Interfaces returns the interfaces discovery runs on.
+func Interfaces() []net.Interface {
+	return getAllInterfaces()
+}
+
+// FindService browses for instance of service on the discovery interfaces
+// and reports whether it answered before ctx is done.
+func FindService(ctx context.Context, service, instance string) (bool, error) {
+	resolver, err := zeroconf.NewResolver(zeroconf.SelectIfaces(getAllInterfaces()))
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	entries := make(chan *zeroconf.ServiceEntry)
+	if err := resolver.Browse(ctx, service, "local.", entries); err != nil {
+		return false, err
+	}
+	for {
+		select {
+		case e := <-entries:
+			if e != nil && e.Instance == instance {
+				return true, nil
+			}
+		case <-ctx.Done():
+			return false, nil
+		}
+	}
+}
+
+// ProbeMDNS announces instance under service and browses for it, to tell
+// whether multicast traffic round-trips on this machine. service should
+// not be ServiceType, so peers don't mistake the probe for a device.
+func ProbeMDNS(ctx context.Context, service, instance string) (bool, error) {
+	server, err := zeroconf.Register(instance, service, "local.", globals.PORT, []string{""}, getAllInterfaces())
+	if err != nil {
+		return false, err
+	}
+	defer server.Shutdown()
+	return FindService(ctx, service, instance)
+}
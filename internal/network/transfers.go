@@ -0,0 +1,173 @@
+package network
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"clipsync/internal/globals"
+	"clipsync/internal/view"
+)
+
+// Every fetch over TCP, in either direction, is tracked as a transfer so
+// its progress can be shown and it can be canceled. Updates are published
+// at most every updateEvery, and the last maxFinished finished transfers
+// are kept for listing.
+const (
+	updateEvery = 250 * time.Millisecond
+	maxFinished = 20
+)
+
+// ErrNoTransfer is returned when canceling a transfer that is not running.
+var ErrNoTransfer = errors.New("no running transfer with that id")
+
+type transfer struct {
+	mu        sync.Mutex
+	info      globals.Transfer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	published time.Time
+}
+
+var (
+	transfersMu sync.Mutex
+	transfers   []*transfer
+)
+
+// startTransfer tracks a new transfer. Its context is canceled when the
+// transfer is canceled, and finish must be called once it ends.
+func startTransfer(ctx context.Context, direction, peer, name string, size int64) (*transfer, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := &transfer{
+		info: globals.Transfer{
+			ID:        rand.Text()[:8],
+			Direction: direction,
+			Peer:      peer,
+			Name:      name,
+			Size:      size,
+			State:     globals.TransferRunning,
+			Started:   time.Now(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	transfersMu.Lock()
+	transfers = append(transfers, t)
+	transfersMu.Unlock()
+	t.publish(true)
+	return t, ctx
+}
+
+// Write counts bytes moved, so a transfer can sit in an io.MultiWriter.
+func (t *transfer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.info.Done += int64(len(p))
+	t.mu.Unlock()
+	t.publish(false)
+	return len(p), nil
+}
+
+// finish ends the transfer, as failed if err is set.
+func (t *transfer) finish(err error) {
+	t.mu.Lock()
+	if t.info.State != globals.TransferRunning {
+		t.mu.Unlock()
+		return
+	}
+	switch {
+	case err == nil:
+		t.info.State = globals.TransferDone
+	case errors.Is(err, context.Canceled):
+		t.info.State = globals.TransferCanceled
+	default:
+		t.info.State, t.info.Error = globals.TransferFailed, err.Error()
+	}
+	t.mu.Unlock()
+	t.cancel()
+	t.publish(true)
+
+	// Drop the oldest finished transfers beyond maxFinished
+	transfersMu.Lock()
+	defer transfersMu.Unlock()
+	finished := 0
+	for i := len(transfers) - 1; i >= 0; i-- {
+		if transfers[i].snapshot().State == globals.TransferRunning {
+			continue
+		}
+		if finished++; finished > maxFinished {
+			transfers = slices.Delete(transfers, i, i+1)
+		}
+	}
+}
+
+// publish shows the transfer's progress, throttled unless force is set.
+func (t *transfer) publish(force bool) {
+	t.mu.Lock()
+	if !force && time.Since(t.published) < updateEvery {
+		t.mu.Unlock()
+		return
+	}
+	t.published = time.Now()
+	t.mu.Unlock()
+	view.UpdateTransfer(t.snapshot())
+}
+
+func (t *transfer) snapshot() globals.Transfer {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	info := t.info
+	if elapsed := time.Since(info.Started).Seconds(); elapsed > 0 {
+		info.Speed = float64(info.Done) / elapsed
+	}
+	return info
+}
+
+// Transfers returns the running and recently finished transfers, oldest
+// first.
+func Transfers() []globals.Transfer {
+	transfersMu.Lock()
+	defer transfersMu.Unlock()
+	out := make([]globals.Transfer, 0, len(transfers))
+	for _, t := range transfers {
+		out = append(out, t.snapshot())
+	}
+	return out
+}
+
+// CancelTransfer stops a running transfer.
+func CancelTransfer(id string) error {
+	transfersMu.Lock()
+	var found *transfer
+	for _, t := range transfers {
+		if t.snapshot().ID == id {
+			found = t
+			break
+		}
+	}
+	transfersMu.Unlock()
+	if found == nil || found.snapshot().State != globals.TransferRunning {
+		return ErrNoTransfer
+	}
+	found.finish(context.Canceled)
+	return nil
+}
+
+// progressWriter counts what is written to w against t, and stops once t
+// is canceled.
+type progressWriter struct {
+	w io.Writer
+	t *transfer
+}
+
+func (p progressWriter) Write(b []byte) (int, error) {
+	if err := p.t.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.w.Write(b)
+	p.t.Write(b[:n])
+	return n, err
+}
@@ -3,88 +3,246 @@ package network
 import (
 	// "bufio"
 	// "fmt"
-	"encoding/binary"
-	"log"
-	"net"
-	"strconv"
+	"encoding/json"
 	"slices"
+	"sync"
+	"time"
 
 	// sysClipboard "golang.design/x/clipboard"
 	"clipsync/internal/globals"
+	"clipsync/internal/logging"
+	"clipsync/internal/metrics"
+	"clipsync/internal/view"
 )
-var Buffer []byte
+
+var (
+	bufferMu sync.Mutex
+	// buffer is the clip last received from a peer, which the clipboard
+	// watchers must not send back.
+	buffer []byte
+)
+
+// IsReceived reports whether data is the clip last received from a peer.
+func IsReceived(data []byte) bool {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+	return slices.Equal(data, buffer)
+}
+
+// SetReceived makes a copy of data the last received clip and returns the
+// copy. It reports false when data already was.
+func SetReceived(data []byte) ([]byte, bool) {
+	bufferMu.Lock()
+	defer bufferMu.Unlock()
+	changed := !slices.Equal(data, buffer)
+	buffer = slices.Clone(data)
+	return buffer, changed
+}
+
 func SendClipboard(data []byte) {
+	sendClip(data, false)
+}
+
+// SendSensitive is SendClipboard for a clip that must never be saved to
+// disk, such as a password. Peers are told so they keep it out of their
+// history file too.
+func SendSensitive(data []byte) {
+	sendClip(data, true)
+}
+
+func sendClip(data []byte, sensitive bool) {
 	if Conn == nil {
-		log.Println("SendClipboard: Conn is nil, skipping.")
+		logger.Debug("Not sending clip, socket is not open yet")
+		return
+	}
+	if reason := Paused(); reason != "" {
+		logger.Debug("Not sending clip, sync is paused", "reason", reason)
+		return
+	}
+	if !beginSend() {
+		logger.Debug("Not sending clip, shutting down")
+		return
+	}
+	defer sending.Done()
+
+	if len(data) > MaxOffer {
+		logger.Warn("Clip too large to send", "bytes", len(data), "max", MaxOffer)
+		metrics.FramesDropped.With("oversize").Inc()
 		return
 	}
-	
-	payload := make([]byte, 4+len(data))
-	binary.BigEndian.PutUint32(payload[:4], uint32(len(data)))
-	copy(payload[4:], data)
-	
+	start := time.Now()
+	defer metrics.SendLatency.Since(start)
+
 	globals.IPSMu.Lock()
 	ips := make([]string, len(globals.IPS))
 	copy(ips, globals.IPS)
 	globals.IPSMu.Unlock()
 
+	kind := frameData
+	if sensitive {
+		kind = frameSensitive
+		logger.Debug("Sending clip", "peers", len(ips), logging.SensitiveClip(data))
+	} else {
+		logger.Debug("Sending clip", "peers", len(ips), logging.Clip(data))
+	}
+	// Each codec's frame and the offer are built once, for the first peer
+	// that needs them. A nil frame means the clip does not fit.
+	frames := map[byte][]byte{}
+	frameFor := func(codec byte) []byte {
+		payload, ok := frames[codec]
+		if !ok && len(data) <= maxClip {
+			used, compressed := compressClip(codec, data)
+			payload = encodeFrame(used<<4|kind, compressed)
+			if len(payload)-headerSize > MaxPayload {
+				payload = nil
+			}
+		}
+		frames[codec] = payload
+		return payload
+	}
+	var offer []byte
+	offerFrame := func() []byte {
+		if offer == nil {
+			o, _ := json.Marshal(newOffer(data, sensitive))
+			offer = encodeFrame(frameOffer, o)
+		}
+		return offer
+	}
+	lazy := Lazy.Enabled && len(data) >= lazyMin
+
 	for _, ip := range ips {
-		addr, err := net.ResolveUDPAddr("udp", ip + ":" + strconv.Itoa(globals.PORT))
+		addr, err := peerAddr(ip)
 		if err != nil {
-			log.Println("SendClipboard Resolve Error:", err)
+			logger.Warn("Could not resolve peer", "peer", ip, logging.Err(err))
+			continue
+		}
+		var payload []byte
+		if !lazy {
+			payload = frameFor(peerCodec(ip))
+		}
+		offered := payload == nil && peerFetches(ip)
+		if offered {
+			payload = offerFrame()
+		} else if payload == nil {
+			// Peers that can't fetch get the clip itself, if it fits
+			payload = frameFor(peerCodec(ip))
+		}
+		if payload == nil {
+			logger.Warn("Clip too large to send", "peer", ip, "bytes", len(data), "max", MaxPayload)
+			metrics.FramesDropped.With("oversize").Inc()
 			continue
 		}
 		_, err = Conn.WriteToUDP(payload, addr)
 		if err != nil {
-			log.Println("SendClipboard Write Error:", err)
+			logger.Warn("Could not send clip", "peer", ip, logging.Err(err))
+			metrics.SendErrors.With(ip).Inc()
+			continue
+		}
+		if offered {
+			metrics.ClipsOffered.Inc()
+			continue
 		}
+		metrics.ClipsSent.With(ip).Inc()
+		metrics.BytesSent.With(ip).Add(uint64(len(data)))
 	}
 }
 
-func RecieveClipboard() ([]byte, int){
+func RecieveClipboard() ([]byte, int) {
 	if Conn == nil {
-		log.Println("RecieveClipboard: Conn is nil. Waiting for Ready...")	
+		logger.Debug("Socket is not open yet, waiting")
 		<-Ready
 	}
 	tmpBuf := make([]byte, 65535)
 	n, addr, err := Conn.ReadFromUDP(tmpBuf)
-	if err != nil{
-		log.Println("Error", err)
+	if err != nil {
+		logger.Warn("Receive failed", logging.Err(err))
 		return nil, 0
 	}
-	
-	if n < 4 {
+
+	// While paused nothing but goodbyes is read, so peers are not held to
+	// the limits for strangers
+	ip := addr.IP.String()
+	checked := Paused() == ""
+	if checked && !admit(ip) {
 		return nil, 0
 	}
-	
-	length := binary.BigEndian.Uint32(tmpBuf[:4])
-	if length > uint32(n-4) {
-		log.Println("Incomplete payload received")
+
+	rawKind, actualData, ok := decodeFrame(tmpBuf[:n])
+	if !ok {
+		logger.Debug("Dropping incomplete payload", "from", ip, "bytes", n)
+		metrics.DecodeErrors.Inc()
+		if checked {
+			reject(ip, "malformed")
+		}
 		return nil, 0
 	}
-	
-	actualData := tmpBuf[4 : 4+length]
-	
-	if slices.Equal(actualData, []byte("---ClipSync---")){
-		globals.IPSMu.Lock()
-		found := false
-		for _, existingIP := range globals.IPS {
-			if existingIP == addr.IP.String() {
-				found = true
-				break
-			}
+	kind, codec := splitKind(rawKind)
+	if checked && !checkFrame(ip, kind, codec, actualData) {
+		return nil, 0
+	}
+
+	switch {
+	case Paused() != "" && kind != frameBye:
+		logger.Debug("Ignoring frame while paused", "from", addr.IP.String())
+	case kind == frameBye:
+		logger.Info("Device said goodbye", "peer", addr.IP.String())
+		forgetPeer(addr.IP.String())
+	case kind == frameHello:
+		if handleHello(addr.IP.String(), actualData) {
+			go sayHello(addr.IP.String())
+		}
+	case kind == frameOffer:
+		handleOffer(addr.IP.String(), actualData)
+	case kind == frameFiles:
+		handleFiles(addr.IP.String(), actualData)
+	case kind != frameData && kind != frameSensitive:
+		logger.Debug("Ignoring unknown frame kind", "kind", kind, "from", addr.IP.String())
+		metrics.FramesDropped.With("unknown_kind").Inc()
+	case kind == frameData && codec == codecNone && slices.Equal(actualData, handshake):
+		// Anyone can send the handshake, so it only refreshes a peer found
+		// by discovery or added by hand; a stranger is not let in by it
+		if !isPeer(ip) {
+			logger.Info("Ignoring handshake from a device that is not a peer", "from", ip, "hint", "run clipsync connect "+ip+" to sync with it")
+			return nil, 0
 		}
-		if !found {
-			globals.IPS = append(globals.IPS, addr.IP.String())
+		// Replies go to the port the peer sends from, which is its sync port
+		rememberPort(addr.IP.String(), addr.Port)
+		metrics.PeerUp.Set(addr.IP.String(), 1)
+		// Answered even when we know its codecs, so clipsync connect on the
+		// other end hears back
+		go sayHello(addr.IP.String())
+	default:
+		clip, err := decompressClip(codec, actualData)
+		if err != nil {
+			logger.Debug("Dropping undecodable clip", "from", addr.IP.String(), "codec", codec, logging.Err(err))
+			metrics.DecodeErrors.Inc()
+			reject(ip, "malformed")
+			return nil, 0
 		}
-		globals.IPSMu.Unlock()
-	}else{
-		// Set Buffer to actualData so other goroutines checking network.Buffer match correctly
-		Buffer = make([]byte, len(actualData))
-		copy(Buffer, actualData)
-		log.Println("Recieved Clipboard From Addr: ", addr, "Content Length", len(Buffer))
-		return Buffer, len(Buffer)
+		clip, _ = SetReceived(clip)
+		if kind == frameSensitive {
+			// Marks the history entry the clip becomes
+			view.ExpectSensitive(string(clip))
+			logger.Debug("Received clip", "from", addr.IP.String(), logging.SensitiveClip(clip))
+		} else {
+			logger.Debug("Received clip", "from", addr.IP.String(), logging.Clip(clip))
+		}
+		metrics.ClipsReceived.With(addr.IP.String()).Inc()
+		metrics.BytesReceived.With(addr.IP.String()).Add(uint64(len(clip)))
+		return clip, len(clip)
 	}
 
 	return nil, 0
 }
+
+// forgetPeer drops ip from the send list and the device list.
+func forgetPeer(ip string) {
+	globals.IPSMu.Lock()
+	globals.IPS = slices.DeleteFunc(globals.IPS, func(existing string) bool {
+		return existing == ip
+	})
+	globals.IPSMu.Unlock()
+	metrics.PeerUp.Set(ip, 0)
+	forgetHello(ip)
+	view.RemoveDevice(ip)
+}
@@ -1,12 +1,15 @@
 package ping
 
 import (
-	"log"
 	"time"
 
+	"clipsync/internal/logging"
+
 	"github.com/go-ping/ping"
 )
 
+var logger = logging.For(logging.Network)
+
 // PingIPS takes a list of IPs and returns only those that are reachable (at least 1 packet received).
 func PingIPS(ips []string) []string {
 	if ips == nil {
@@ -18,7 +21,8 @@ func PingIPS(ips []string) []string {
 	for _, ip := range ips {
 		pinger, err := ping.NewPinger(ip)
 		if err != nil {
-			log.Println(err)
+			logger.Warn("Could not create pinger", "peer", ip, logging.Err(err))
+			continue
 		}
 
 		pinger.Count = 2 //Just incase the first one drops 
@@ -29,7 +33,7 @@ func PingIPS(ips []string) []string {
 
 		err = pinger.Run()
 		if err != nil {
-			log.Print(err)
+			logger.Debug("Ping failed", "peer", ip, logging.Err(err))
 		}
 
 		stats := pinger.Statistics()
@@ -0,0 +1,209 @@
+package relay
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"clipsync/internal/logging"
+)
+
+// Retry delays after the connection to the relay drops.
+const (
+	minBackoff = time.Second
+	maxBackoff = 30 * time.Second
+)
+
+// ErrNotConnected is returned for sends while the client is not connected.
+var ErrNotConnected = errors.New("not connected to the relay")
+
+// Client keeps a connection to a relay open and exchanges clips with the
+// other members of its group through it.
+type Client struct {
+	Addr  string
+	Group *Group
+	// Name is shown in the relay's log.
+	Name string
+	TLS  *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// active is the client the engine syncs through.
+var (
+	activeMu sync.Mutex
+	active   *Client
+)
+
+// Use makes c the client the engine syncs through; nil disables the relay.
+func Use(c *Client) {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	active = c
+}
+
+// Active returns the client set with Use, or nil.
+func Active() *Client {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return active
+}
+
+// NewClient returns a client for the relay at addr, host[:port]. The
+// port defaults to DefaultPort.
+func NewClient(addr string, group *Group, name string, config *tls.Config) *Client {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+	}
+	return &Client{Addr: addr, Group: group, Name: name, TLS: config}
+}
+
+// Connected reports whether the client is currently connected.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// Send seals a clip and sends it to the group, flagged if it is
+// sensitive. It fails when the client is not connected; clips are not
+// queued for later.
+func (c *Client) Send(clip []byte, sensitive bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	env := c.Group.Seal(clip, sensitive)
+	if len(env) > MaxEnvelope {
+		return fmt.Errorf("clip of %d bytes is too large for the relay", len(clip))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return writeMsg(c.conn, env)
+}
+
+// Run connects to the relay and calls onClip for every clip another member
+// sends, and whether it was sent as sensitive, reconnecting with backoff
+// until ctx is done.
+func (c *Client) Run(ctx context.Context, onClip func(clip []byte, sensitive bool)) error {
+	backoff := minBackoff
+	for {
+		start := time.Now()
+		err := c.session(ctx, onClip)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if time.Since(start) > maxBackoff {
+			backoff = minBackoff
+		}
+		logger.Warn("Relay connection lost, retrying", "relay", c.Addr, "in", backoff, logging.Err(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// session runs one connection to the relay until it fails.
+func (c *Client) session(ctx context.Context, onClip func(clip []byte, sensitive bool)) error {
+	dialer := &tls.Dialer{Config: c.TLS}
+	dialCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	conn, err := dialer.DialContext(dialCtx, "tcp", c.Addr)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	if err := writeJSON(conn, hello{Version: protocolVersion, Group: c.Group.ID(), Name: c.Name}); err != nil {
+		return err
+	}
+	var w welcome
+	if err := readJSON(conn, &w); err != nil {
+		return err
+	}
+	if w.Error != "" {
+		return errors.New("relay refused: " + w.Error)
+	}
+	conn.SetDeadline(time.Time{})
+
+	c.mu.Lock()
+	c.conn = conn
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		c.conn = nil
+		c.mu.Unlock()
+	}()
+	logger.Info("Connected to relay", "relay", c.Addr)
+
+	if env := c.Group.Announce(c.Name); env != nil {
+		if err := c.write(env); err != nil {
+			return err
+		}
+	}
+	for {
+		env, err := readMsg(conn, MaxEnvelope)
+		if err != nil {
+			return err
+		}
+		clip, sensitive, err := c.Group.Open(env)
+		if err != nil {
+			// Another group key hashing to the same ID, tampering, or a
+			// replay of an earlier clip
+			logger.Warn("Dropping envelope from relay", logging.Err(err))
+			continue
+		}
+		for _, env := range c.Group.takePending() {
+			if err := c.write(env); err != nil {
+				return err
+			}
+		}
+		if clip != nil {
+			onClip(clip, sensitive)
+		}
+	}
+}
+
+// write sends an envelope on the current connection.
+func (c *Client) write(env []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return ErrNotConnected
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return writeMsg(c.conn, env)
+}
+
+// Rotate replaces the group key with a new one and hands it to the
+// members of the group but the devices with the IDs in revoke, which are
+// revoked. It returns the new key. Members offline now never get it, and
+// must join again with it.
+func (c *Client) Rotate(revoke []string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return "", ErrNotConnected
+	}
+	env, apply, err := c.Group.rotate(revoke)
+	if err != nil {
+		return "", err
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if err := writeMsg(c.conn, env); err != nil {
+		return "", err
+	}
+	return apply(), nil
+}
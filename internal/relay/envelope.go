@@ -0,0 +1,390 @@
+package relay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"clipsync/internal/logging"
+)
+
+// envelopeVersion is the first byte of every sealed clip. Version 1 had no
+// sequence numbers and is refused, as accepting it would allow replays;
+// version 2 had no flags, so it could not mark a clip sensitive; version
+// 3 had no kind, so members could not announce themselves or rotate the
+// group key.
+const envelopeVersion = 4
+
+// Inside the encryption every message is prefixed by its sender's ID, a
+// sequence number, the time it was sealed, its flags and its kind.
+// Receivers accept a message only if it was sealed within maxSkew of their
+// own clock, and if its sequence number is new and at most replayWindow
+// behind the newest one from that sender. The windows can be persisted, so
+// a restart does not make the envelopes opened just before it new again.
+// This protects relay envelopes only; LAN frames carry no authentication
+// to hang it on.
+const (
+	senderSize   = 8
+	headerSize   = senderSize + 8 + 8 + 1 + 1
+	maxSkew      = 2 * time.Minute
+	replayWindow = 64
+
+	// flagSensitive marks a clip the receiver must not save to disk.
+	flagSensitive byte = 1
+)
+
+// What an envelope carries.
+const (
+	kindClip byte = 0
+	// kindMember announces the sender and the members it knows, see
+	// members.go.
+	kindMember byte = 1
+	// kindRekey hands a new group key to the members that keep it.
+	kindRekey byte = 2
+)
+
+var (
+	ErrEnvelope = errors.New("envelope could not be opened: wrong group key or corrupted")
+	ErrReplay   = errors.New("envelope was already received")
+	ErrStale    = errors.New("envelope is too old or from the future: check the device clocks")
+	ErrRevoked  = errors.New("envelope is from a revoked device")
+)
+
+// Group is a sync group: the devices sharing one group key. The key never
+// leaves the devices; the relay only sees the group ID, which is derived
+// from it one way and used to route envelopes.
+type Group struct {
+	// Clock returns the current time; nil means time.Now.
+	Clock func() time.Time
+	// OnRekey is called with the new group key whenever it is rotated,
+	// here or by another member.
+	OnRekey func(key string)
+	// OnMembers is called when a member is added, renamed or revoked.
+	OnMembers func()
+
+	id       string
+	sender   [senderSize]byte
+	seq      atomic.Uint64
+	identity *Identity
+
+	mu sync.Mutex
+	// key is the current group key and aead the cipher derived from it.
+	key     string
+	aead    cipher.AEAD
+	windows map[[senderSize]byte]*window
+	members map[[senderSize]byte]*groupMember
+	// name is what this device announces itself as.
+	name string
+	// pending are envelopes to send in answer to the ones opened.
+	pending [][]byte
+	// path is where the windows and members are saved, if anywhere.
+	path string
+}
+
+// window tracks the sequence numbers seen from one sender: Top is the
+// newest, and bit i of Seen is set once Top-i has been received.
+type window struct {
+	Top  uint64    `json:"top"`
+	Seen uint64    `json:"seen"`
+	Last time.Time `json:"last"`
+}
+
+// NewKey returns a random group key, encoded for the config file.
+func NewKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.RawURLEncoding.EncodeToString(key)
+}
+
+// splitKey returns the group ID and secret of a group key. A rotated key
+// names the ID of the group it replaces the key of before a dot, so the
+// group keeps its place on the relay; any other key derives the ID.
+func splitKey(key string) (id, secret string, err error) {
+	if prefix, rest, ok := strings.Cut(key, "."); ok {
+		if b, err := hex.DecodeString(prefix); err != nil || len(b) != 16 {
+			return "", "", errors.New("malformed group key")
+		}
+		id, key = prefix, rest
+	}
+	if len(key) < 16 {
+		return "", "", errors.New("group key too short, generate one with 'clipsync relay key'")
+	}
+	if id == "" {
+		raw, err := hkdf.Key(sha256.New, []byte(key), nil, "clipsync group id", 16)
+		if err != nil {
+			return "", "", err
+		}
+		id = hex.EncodeToString(raw)
+	}
+	return id, key, nil
+}
+
+// envelopeCipher derives the cipher envelopes are sealed with from a
+// group key's secret.
+func envelopeCipher(secret string) (cipher.AEAD, error) {
+	raw, err := hkdf.Key(sha256.New, []byte(secret), nil, "clipsync envelope key", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// NewGroup derives the group ID and envelope key from a group key.
+func NewGroup(key string) (*Group, error) {
+	id, secret, err := splitKey(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := envelopeCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	g := &Group{
+		id:      id,
+		key:     key,
+		aead:    aead,
+		windows: map[[senderSize]byte]*window{},
+		members: map[[senderSize]byte]*groupMember{},
+	}
+	// Without an identity the sender ID is new on every start
+	rand.Read(g.sender[:])
+	// The sequence starts from the clock, so it keeps growing across
+	// restarts under the same sender ID
+	g.seq.Store(uint64(time.Now().UnixNano()))
+	return g, nil
+}
+
+// UseIdentity makes id the device's identity in the group: it becomes the
+// sender ID, and the one other members wrap rotated keys to.
+func (g *Group) UseIdentity(id *Identity) {
+	g.identity = id
+	g.sender = deviceID(id.key.PublicKey().Bytes())
+}
+
+// ID identifies the group to the relay.
+func (g *Group) ID() string {
+	return g.id
+}
+
+func (g *Group) now() time.Time {
+	if g.Clock != nil {
+		return g.Clock()
+	}
+	return time.Now()
+}
+
+// Seal encrypts a clip into an envelope: version, nonce, then the
+// ciphertext of the header and clip. The group ID is authenticated too, so
+// envelopes can't be moved between groups. A sensitive clip is flagged
+// so receivers keep it out of their history file.
+func (g *Group) Seal(clip []byte, sensitive bool) []byte {
+	var flags byte
+	if sensitive {
+		flags = flagSensitive
+	}
+	g.mu.Lock()
+	aead := g.aead
+	g.mu.Unlock()
+	return g.seal(aead, kindClip, flags, clip)
+}
+
+// seal encrypts a message of the given kind with aead.
+func (g *Group) seal(aead cipher.AEAD, kind, flags byte, payload []byte) []byte {
+	plain := make([]byte, headerSize, headerSize+len(payload))
+	copy(plain, g.sender[:])
+	binary.BigEndian.PutUint64(plain[senderSize:], g.seq.Add(1))
+	binary.BigEndian.PutUint64(plain[senderSize+8:], uint64(g.now().UnixNano()))
+	plain[senderSize+16] = flags
+	plain[senderSize+17] = kind
+	plain = append(plain, payload...)
+
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	env := append([]byte{envelopeVersion}, nonce...)
+	return aead.Seal(env, nonce, plain, []byte(g.id))
+}
+
+// Open decrypts an envelope sealed by a member of the group, and reports
+// whether the clip was sealed as sensitive. Envelopes sealed too long ago,
+// already opened or sent by a revoked device are refused. Announcements
+// and key rotations are handled here and return a nil clip.
+func (g *Group) Open(env []byte) (clip []byte, sensitive bool, err error) {
+	g.mu.Lock()
+	aead := g.aead
+	g.mu.Unlock()
+	n := aead.NonceSize()
+	if len(env) < 1+n || env[0] != envelopeVersion {
+		return nil, false, ErrEnvelope
+	}
+	plain, err := aead.Open(nil, env[1:1+n], env[1+n:], []byte(g.id))
+	if err != nil || len(plain) < headerSize {
+		return nil, false, ErrEnvelope
+	}
+	sender := [senderSize]byte(plain)
+	seq := binary.BigEndian.Uint64(plain[senderSize:])
+	sealed := time.Unix(0, int64(binary.BigEndian.Uint64(plain[senderSize+8:])))
+	flags, kind, payload := plain[senderSize+16], plain[senderSize+17], plain[headerSize:]
+
+	now := g.now()
+	if sealed.Before(now.Add(-maxSkew)) || sealed.After(now.Add(maxSkew)) {
+		return nil, false, ErrStale
+	}
+	if g.revoked(sender) {
+		return nil, false, ErrRevoked
+	}
+	if !g.accept(sender, seq, now) {
+		return nil, false, ErrReplay
+	}
+	switch kind {
+	case kindClip:
+		return payload, flags&flagSensitive != 0, nil
+	case kindMember:
+		return nil, false, g.handleMember(sender, payload, now)
+	case kindRekey:
+		return nil, false, g.handleRekey(aead, payload)
+	}
+	return nil, false, fmt.Errorf("%w: unknown kind %d", ErrEnvelope, kind)
+}
+
+// accept records seq from sender, and reports whether it was new and
+// within the replay window.
+func (g *Group) accept(sender [senderSize]byte, seq uint64, now time.Time) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// Anything a sender quiet for 2*maxSkew sealed is stale by now, so its
+	// window can go
+	for k, w := range g.windows {
+		if now.Sub(w.Last) > 2*maxSkew {
+			delete(g.windows, k)
+		}
+	}
+
+	w := g.windows[sender]
+	if w == nil {
+		w = &window{}
+		g.windows[sender] = w
+	}
+	switch {
+	case seq > w.Top:
+		if shift := seq - w.Top; shift < replayWindow {
+			w.Seen = w.Seen<<shift | 1
+		} else {
+			w.Seen = 1
+		}
+		w.Top = seq
+	case w.Top-seq >= replayWindow:
+		return false
+	case w.Seen&(1<<(w.Top-seq)) != 0:
+		return false
+	default:
+		w.Seen |= 1 << (w.Top - seq)
+	}
+	w.Last = now
+	g.saveLocked()
+	return true
+}
+
+// groupState is what Persist keeps on disk.
+type groupState struct {
+	// Group is the ID the state belongs to; a file left by another group
+	// is ignored.
+	Group   string                  `json:"group"`
+	Windows map[string]*window      `json:"windows,omitempty"`
+	Members map[string]*groupMember `json:"members,omitempty"`
+}
+
+// Persist keeps the replay windows and the members in the file at path:
+// the ones saved there are loaded now, and saved again on every change.
+func (g *Group) Persist(path string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		var saved groupState
+		if err := json.Unmarshal(data, &saved); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if saved.Group != g.id {
+			break
+		}
+		for k, w := range saved.Windows {
+			if sender, ok := parseID(k); ok && w != nil {
+				g.windows[sender] = w
+			}
+		}
+		for k, m := range saved.Members {
+			if id, ok := parseID(k); ok && m != nil && deviceID(m.Key) == id {
+				g.members[id] = m
+			}
+		}
+	}
+	g.path = path
+	return nil
+}
+
+// saveLocked saves the state if it is persisted, logging failures. g.mu
+// must be held.
+func (g *Group) saveLocked() {
+	if g.path == "" {
+		return
+	}
+	if err := g.save(); err != nil {
+		logger.Warn("Could not save the relay group state", logging.Err(err))
+	}
+}
+
+// save writes the state to g.path. g.mu must be held.
+func (g *Group) save() error {
+	state := groupState{
+		Group:   g.id,
+		Windows: make(map[string]*window, len(g.windows)),
+		Members: make(map[string]*groupMember, len(g.members)),
+	}
+	for k, w := range g.windows {
+		state.Windows[hex.EncodeToString(k[:])] = w
+	}
+	for k, m := range g.members {
+		state.Members[hex.EncodeToString(k[:])] = m
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	// Renamed into place, so a crash never leaves half a file
+	tmp := g.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, g.path)
+}
+
+// parseID decodes a hex device or sender ID.
+func parseID(s string) ([senderSize]byte, bool) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != senderSize {
+		return [senderSize]byte{}, false
+	}
+	return [senderSize]byte(b), true
+}
@@ -0,0 +1,8 @@
+package relay
+
+// Rotate prepares a rotation of g's key as Client.Rotate does, without a
+// relay: the envelope to hand to the other members, and the function that
+// switches g to the new key.
+func Rotate(g *Group, revoke []string) (env []byte, apply func() string, err error) {
+	return g.rotate(revoke)
+}
@@ -0,0 +1,129 @@
+package relay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// Identity is a device's own key pair in its relay group. A rotated group
+// key is wrapped to the public key of every member that keeps it, so a
+// revoked device, or one nobody knows, never gets it.
+type Identity struct {
+	key *ecdh.PrivateKey
+}
+
+// NewIdentity returns a fresh identity.
+func NewIdentity() *Identity {
+	key, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	return &Identity{key: key}
+}
+
+// LoadIdentity reads the identity kept in the file at path, creating it
+// on first use.
+func LoadIdentity(path string) (*Identity, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		id := NewIdentity()
+		encoded := base64.StdEncoding.EncodeToString(id.key.Bytes())
+		if err := os.WriteFile(path, []byte(encoded+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return id, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.New("device identity file is malformed")
+	}
+	key, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, errors.New("device identity file is malformed")
+	}
+	return &Identity{key: key}, nil
+}
+
+// ID is the device's ID in the group, derived from its public key.
+func (i *Identity) ID() string {
+	id := deviceID(i.key.PublicKey().Bytes())
+	return hex.EncodeToString(id[:])
+}
+
+// deviceID derives a device ID from a public key, so a device can't claim
+// the ID of another.
+func deviceID(pub []byte) [senderSize]byte {
+	sum := sha256.Sum256(pub)
+	return [senderSize]byte(sum[:])
+}
+
+// wrapKey seals secret so that only the holder of the private key for pub
+// can open it: an ephemeral key agreement, then AES-GCM. The result is the
+// ephemeral public key, the nonce and the ciphertext.
+func wrapKey(pub, secret []byte) ([]byte, error) {
+	peer, err := ecdh.X25519().NewPublicKey(pub)
+	if err != nil {
+		return nil, err
+	}
+	eph, _ := ecdh.X25519().GenerateKey(rand.Reader)
+	aead, err := wrapAEAD(eph, peer)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	out := append(eph.PublicKey().Bytes(), nonce...)
+	return aead.Seal(out, nonce, secret, pub), nil
+}
+
+// unwrapKey opens what wrapKey sealed to i.
+func (i *Identity) unwrapKey(wrapped []byte) ([]byte, error) {
+	const pubSize = 32
+	if len(wrapped) < pubSize {
+		return nil, ErrEnvelope
+	}
+	eph, err := ecdh.X25519().NewPublicKey(wrapped[:pubSize])
+	if err != nil {
+		return nil, ErrEnvelope
+	}
+	aead, err := wrapAEAD(i.key, eph)
+	if err != nil {
+		return nil, err
+	}
+	rest := wrapped[pubSize:]
+	if len(rest) < aead.NonceSize() {
+		return nil, ErrEnvelope
+	}
+	secret, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], i.key.PublicKey().Bytes())
+	if err != nil {
+		return nil, ErrEnvelope
+	}
+	return secret, nil
+}
+
+// wrapAEAD derives the cipher a key is wrapped with from the agreement
+// between priv and pub.
+func wrapAEAD(priv *ecdh.PrivateKey, pub *ecdh.PublicKey) (cipher.AEAD, error) {
+	shared, err := priv.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := hkdf.Key(sha256.New, shared, nil, "clipsync key wrap", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
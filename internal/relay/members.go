@@ -0,0 +1,285 @@
+package relay
+
+import (
+	"cmp"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"clipsync/internal/globals"
+)
+
+// Every device with an identity announces itself when it connects to the
+// relay, along with the members it knows, so each member learns the whole
+// group and its public keys. Rotating the group key then wraps the new key
+// to every member but the revoked ones: a revoked device, or a new identity
+// no member has seen before the rotation, can't read what is sent after it.
+// Only envelopes sealed with the current key are trusted, so a device
+// holding an old key can't announce itself or hand out a key of its own.
+
+var (
+	ErrNoIdentity    = errors.New("this device has no identity in the relay group")
+	ErrUnknownMember = errors.New("no such device in the relay group")
+	ErrRevokeSelf    = errors.New("can't revoke this device, revoke it from another one")
+)
+
+// groupMember is a device in the group, as it announced itself.
+type groupMember struct {
+	Name    string    `json:"name"`
+	Key     []byte    `json:"key"`
+	Seen    time.Time `json:"seen,omitzero"`
+	Revoked bool      `json:"revoked,omitempty"`
+}
+
+// announcement is the payload of a kindMember envelope.
+type announcement struct {
+	Name string `json:"name"`
+	Key  []byte `json:"key"`
+	// Members are the other devices the sender knows, by ID.
+	Members map[string]*groupMember `json:"members,omitempty"`
+}
+
+// rekeyMsg is the payload of a kindRekey envelope.
+type rekeyMsg struct {
+	// Revoked are the IDs of the devices cut out of the group.
+	Revoked []string `json:"revoked,omitempty"`
+	// Keys holds the new group key wrapped to each member that keeps it.
+	Keys map[string][]byte `json:"keys"`
+}
+
+// revoked reports whether sender was revoked.
+func (g *Group) revoked(sender [senderSize]byte) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m := g.members[sender]
+	return m != nil && m.Revoked
+}
+
+// Announce returns the envelope that introduces this device as name to
+// the other members, or nil without an identity.
+func (g *Group) Announce(name string) []byte {
+	if g.identity == nil {
+		return nil
+	}
+	g.mu.Lock()
+	g.name = name
+	env := g.announceLocked()
+	g.mu.Unlock()
+	return env
+}
+
+// announceLocked seals an announcement of this device. g.mu must be held.
+func (g *Group) announceLocked() []byte {
+	a := announcement{Name: g.name, Key: g.identity.key.PublicKey().Bytes(), Members: map[string]*groupMember{}}
+	for id, m := range g.members {
+		a.Members[hex.EncodeToString(id[:])] = &groupMember{Name: m.Name, Key: m.Key, Revoked: m.Revoked}
+	}
+	payload, _ := json.Marshal(a)
+	return g.seal(g.aead, kindMember, 0, payload)
+}
+
+// handleMember records an announcement from sender, and answers with one
+// of our own when sender is new to us.
+func (g *Group) handleMember(sender [senderSize]byte, payload []byte, now time.Time) error {
+	var a announcement
+	if err := json.Unmarshal(payload, &a); err != nil || deviceID(a.Key) != sender {
+		return fmt.Errorf("%w: malformed announcement", ErrEnvelope)
+	}
+	if g.identity == nil {
+		return nil
+	}
+	g.mu.Lock()
+	m, known := g.members[sender]
+	changed := !known || m.Name != a.Name
+	if !known {
+		m = &groupMember{Key: a.Key}
+		g.members[sender] = m
+		logger.Info("Relay group member joined", "device", hex.EncodeToString(sender[:]), "name", a.Name)
+	}
+	m.Name, m.Seen = a.Name, now
+
+	self := deviceID(g.identity.key.PublicKey().Bytes())
+	for k, other := range a.Members {
+		id, ok := parseID(k)
+		if !ok || id == self || other == nil || deviceID(other.Key) != id {
+			continue
+		}
+		switch mine := g.members[id]; {
+		case mine == nil:
+			g.members[id] = &groupMember{Name: other.Name, Key: other.Key, Revoked: other.Revoked}
+			changed = true
+		case other.Revoked && !mine.Revoked:
+			mine.Revoked = true
+			changed = true
+		}
+	}
+	if !known && g.name != "" {
+		g.pending = append(g.pending, g.announceLocked())
+	}
+	g.saveLocked()
+	g.mu.Unlock()
+
+	if changed && g.OnMembers != nil {
+		g.OnMembers()
+	}
+	return nil
+}
+
+// handleRekey applies a key rotation sealed with aead, the current key:
+// the revoked devices are marked, and the new key taken when it was
+// wrapped for us.
+func (g *Group) handleRekey(aead cipher.AEAD, payload []byte) error {
+	var r rekeyMsg
+	if err := json.Unmarshal(payload, &r); err != nil {
+		return fmt.Errorf("%w: malformed key rotation", ErrEnvelope)
+	}
+	if g.identity == nil {
+		return nil
+	}
+	self := g.identity.ID()
+	var key string
+	if wrapped, ok := r.Keys[self]; ok {
+		secret, err := g.identity.unwrapKey(wrapped)
+		if err != nil {
+			return err
+		}
+		key = string(secret)
+	}
+	var next cipher.AEAD
+	if key != "" {
+		id, secret, err := splitKey(key)
+		if err != nil || id != g.id {
+			return fmt.Errorf("%w: rotated key is for another group", ErrEnvelope)
+		}
+		if next, err = envelopeCipher(secret); err != nil {
+			return err
+		}
+	}
+
+	g.mu.Lock()
+	if g.aead != aead {
+		// Rotated again in the meantime
+		g.mu.Unlock()
+		return nil
+	}
+	for _, k := range r.Revoked {
+		if id, ok := parseID(k); ok && g.members[id] != nil {
+			g.members[id].Revoked = true
+		}
+	}
+	if next != nil {
+		g.key, g.aead = key, next
+	}
+	g.saveLocked()
+	g.mu.Unlock()
+
+	switch {
+	case slices.Contains(r.Revoked, self):
+		logger.Error("This device was revoked from the relay group, join it again with a new key to sync through the relay")
+	case next == nil:
+		logger.Warn("The relay group key was rotated without this device, join it again with the new key")
+	default:
+		logger.Info("The relay group key was rotated", "revoked", len(r.Revoked))
+		if g.OnRekey != nil {
+			g.OnRekey(key)
+		}
+	}
+	if g.OnMembers != nil {
+		g.OnMembers()
+	}
+	return nil
+}
+
+// takePending returns the envelopes to send in answer to the ones opened.
+func (g *Group) takePending() [][]byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	pending := g.pending
+	g.pending = nil
+	return pending
+}
+
+// rotate prepares a new group key, wrapped to every member but the ones
+// with the IDs in revoke, which are revoked. It returns the envelope to
+// send, sealed with the current key, and apply, which switches to the new
+// key once the envelope is sent and returns it.
+func (g *Group) rotate(revoke []string) (env []byte, apply func() string, err error) {
+	if g.identity == nil {
+		return nil, nil, ErrNoIdentity
+	}
+	self := g.identity.ID()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	cut := map[[senderSize]byte]bool{}
+	for _, k := range revoke {
+		if k == self {
+			return nil, nil, ErrRevokeSelf
+		}
+		id, ok := parseID(k)
+		if !ok || g.members[id] == nil {
+			return nil, nil, fmt.Errorf("%w: %s", ErrUnknownMember, k)
+		}
+		cut[id] = true
+	}
+
+	key := g.id + "." + NewKey()
+	_, secret, _ := splitKey(key)
+	next, err := envelopeCipher(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := rekeyMsg{Keys: map[string][]byte{}}
+	for id, m := range g.members {
+		k := hex.EncodeToString(id[:])
+		if m.Revoked || cut[id] {
+			r.Revoked = append(r.Revoked, k)
+			continue
+		}
+		if r.Keys[k], err = wrapKey(m.Key, []byte(key)); err != nil {
+			return nil, nil, err
+		}
+	}
+	payload, _ := json.Marshal(r)
+	env = g.seal(g.aead, kindRekey, 0, payload)
+
+	apply = func() string {
+		g.mu.Lock()
+		for id := range cut {
+			g.members[id].Revoked = true
+		}
+		g.key, g.aead = key, next
+		g.saveLocked()
+		g.mu.Unlock()
+		logger.Info("Rotated the relay group key", "members", len(r.Keys), "revoked", len(cut))
+		if g.OnRekey != nil {
+			g.OnRekey(key)
+		}
+		if g.OnMembers != nil {
+			g.OnMembers()
+		}
+		return key
+	}
+	return env, apply, nil
+}
+
+// Members returns the devices of the group, this one included, by name.
+func (g *Group) Members() []globals.Member {
+	if g.identity == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := []globals.Member{{ID: g.identity.ID(), Name: g.name, Self: true}}
+	for id, m := range g.members {
+		out = append(out, globals.Member{ID: hex.EncodeToString(id[:]), Name: m.Name, Seen: m.Seen, Revoked: m.Revoked})
+	}
+	slices.SortFunc(out, func(a, b globals.Member) int {
+		return cmp.Or(cmp.Compare(a.Name, b.Name), cmp.Compare(a.ID, b.ID))
+	})
+	return out
+}
@@ -0,0 +1,80 @@
+package relay
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The relay protocol runs over TLS. Every message is a 4 byte big-endian
+// length followed by the payload. A client opens with a hello naming its
+// group, the relay answers with a welcome, and from then on every message
+// is a sealed envelope: the relay copies it to the other members of the
+// group without being able to read it.
+
+// DefaultPort is where the relay listens unless told otherwise.
+const DefaultPort = 9443
+
+// MaxEnvelope is the largest message the relay forwards.
+const MaxEnvelope = 1 << 20
+
+const protocolVersion = 1
+
+// maxHandshake is the largest hello or welcome.
+const maxHandshake = 4 << 10
+
+type hello struct {
+	Version int    `json:"version"`
+	Group   string `json:"group"`
+	Name    string `json:"name,omitempty"`
+}
+
+type welcome struct {
+	Error string `json:"error,omitempty"`
+}
+
+func writeMsg(w io.Writer, payload []byte) error {
+	msg := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(msg, uint32(len(payload)))
+	copy(msg[4:], payload)
+	_, err := w.Write(msg)
+	return err
+}
+
+// readMsg reads a message of at most limit bytes.
+func readMsg(r io.Reader, limit int) ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:])
+	if n > uint32(limit) {
+		return nil, fmt.Errorf("message of %d bytes exceeds the %d byte limit", n, limit)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+func writeJSON(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeMsg(w, data)
+}
+
+func readJSON(r io.Reader, v any) error {
+	data, err := readMsg(r, maxHandshake)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed handshake")
+	}
+	return nil
+}
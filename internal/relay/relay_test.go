@@ -0,0 +1,574 @@
+package relay_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"clipsync/internal/relay"
+)
+
+func TestEnvelope(t *testing.T) {
+	group, err := relay.NewGroup(relay.NewKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _ := relay.NewGroup(relay.NewKey())
+
+	env := group.Seal([]byte("secret clip"), false)
+	if bytes.Contains(env, []byte("secret clip")) {
+		t.Fatal("envelope contains the plaintext")
+	}
+	clip, sensitive, err := group.Open(env)
+	if err != nil || string(clip) != "secret clip" || sensitive {
+		t.Fatalf("Open = %q, %v, %v", clip, sensitive, err)
+	}
+	if _, sensitive, err := group.Open(group.Seal([]byte("password"), true)); err != nil || !sensitive {
+		t.Errorf("Open of a sensitive clip = %v, %v, want it flagged", sensitive, err)
+	}
+	if _, _, err := other.Open(env); err == nil {
+		t.Error("another group opened the envelope")
+	}
+	env[len(env)-1] ^= 1
+	if _, _, err := group.Open(env); err == nil {
+		t.Error("tampered envelope was opened")
+	}
+	if _, err := relay.NewGroup("short"); err == nil {
+		t.Error("short group key accepted")
+	}
+}
+
+func TestEnvelopeReplay(t *testing.T) {
+	key := relay.NewKey()
+	alice, _ := relay.NewGroup(key)
+	bob, _ := relay.NewGroup(key)
+
+	// Reordered envelopes are accepted, each only once
+	var envs [][]byte
+	for i := range 3 {
+		envs = append(envs, alice.Seal([]byte{byte(i)}, false))
+	}
+	for _, i := range []int{2, 0, 1} {
+		if clip, _, err := bob.Open(envs[i]); err != nil || clip[0] != byte(i) {
+			t.Fatalf("Open(envs[%d]) = %v, %v", i, clip, err)
+		}
+	}
+	for i := range envs {
+		if _, _, err := bob.Open(envs[i]); !errors.Is(err, relay.ErrReplay) {
+			t.Errorf("duplicate envs[%d]: err = %v, want ErrReplay", i, err)
+		}
+	}
+
+	// Envelopes too far behind the newest one are refused
+	old := alice.Seal([]byte("old"), false)
+	for range 64 {
+		if _, _, err := bob.Open(alice.Seal([]byte("new"), false)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := bob.Open(old); !errors.Is(err, relay.ErrReplay) {
+		t.Errorf("envelope behind the window: err = %v, want ErrReplay", err)
+	}
+
+	// Small clock skew is tolerated, large skew in either direction is not
+	for _, tc := range []struct {
+		skew time.Duration
+		err  error
+	}{
+		{30 * time.Second, nil},
+		{-30 * time.Second, nil},
+		{5 * time.Minute, relay.ErrStale},
+		{-5 * time.Minute, relay.ErrStale},
+	} {
+		alice.Clock = func() time.Time { return time.Now().Add(tc.skew) }
+		if _, _, err := bob.Open(alice.Seal([]byte("skewed"), false)); !errors.Is(err, tc.err) {
+			t.Errorf("skew %v: err = %v, want %v", tc.skew, err, tc.err)
+		}
+	}
+
+	// A stored envelope replayed later is stale even once its sender's
+	// window is forgotten
+	alice.Clock = nil
+	env := alice.Seal([]byte("captured"), false)
+	bob.Clock = func() time.Time { return time.Now().Add(time.Hour) }
+	if _, _, err := bob.Open(env); !errors.Is(err, relay.ErrStale) {
+		t.Errorf("replay an hour later: err = %v, want ErrStale", err)
+	}
+}
+
+func TestEnvelopeReplayAfterRestart(t *testing.T) {
+	key := relay.NewKey()
+	path := filepath.Join(t.TempDir(), "replay.json")
+	alice, _ := relay.NewGroup(key)
+	bob, _ := relay.NewGroup(key)
+	if err := bob.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	opened := alice.Seal([]byte("opened"), false)
+	later := alice.Seal([]byte("later"), false)
+	if _, _, err := bob.Open(opened); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted receiver still refuses what it opened before, and
+	// nothing else
+	restarted, _ := relay.NewGroup(key)
+	if err := restarted.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := restarted.Open(opened); !errors.Is(err, relay.ErrReplay) {
+		t.Errorf("replay after a restart: err = %v, want ErrReplay", err)
+	}
+	if clip, _, err := restarted.Open(later); err != nil || string(clip) != "later" {
+		t.Errorf("Open(later) after a restart = %q, %v", clip, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := restarted.Persist(path); err == nil {
+		t.Error("Persist accepted a corrupted file")
+	}
+}
+
+// TestRelay runs a relay and three clients on localhost: two share a
+// group, the third is in another one.
+func TestRelay(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	certPEM, keyPEM, err := relay.SelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", relay.ServerTLS(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := relay.NewServer()
+	go server.Serve(ctx, ln)
+
+	key := relay.NewKey()
+	start := func(name, key string) (*relay.Client, chan []byte) {
+		group, err := relay.NewGroup(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := relay.NewClient(ln.Addr().String(), group, name, relay.ClientTLS(relay.Fingerprint(cert)))
+		received := make(chan []byte, 4)
+		go c.Run(ctx, func(clip []byte, _ bool) { received <- clip })
+		return c, received
+	}
+	alice, aliceGot := start("alice", key)
+	bob, bobGot := start("bob", key)
+	mallory, malloryGot := start("mallory", relay.NewKey())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !alice.Connected() || !bob.Connected() || !mallory.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("clients did not connect: %v", server.Members())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if members := server.Members(); len(members) != 2 {
+		t.Fatalf("relay has groups %v, want two", members)
+	}
+
+	if err := alice.Send([]byte("hello bob"), false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case clip := <-bobGot:
+		if string(clip) != "hello bob" {
+			t.Errorf("bob got %q", clip)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bob did not receive the clip")
+	}
+	select {
+	case clip := <-aliceGot:
+		t.Errorf("the sender got its own clip back: %q", clip)
+	case clip := <-malloryGot:
+		t.Errorf("another group got the clip: %q", clip)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestClientRejectsWrongFingerprint(t *testing.T) {
+	ctx, cancel := context.WithTimeout(t.Context(), 5*time.Second)
+	defer cancel()
+
+	certPEM, keyPEM, err := relay.SelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", relay.ServerTLS(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := relay.NewServer()
+	go server.Serve(ctx, ln)
+
+	group, _ := relay.NewGroup(relay.NewKey())
+	wrong := strings.Repeat("ab", 32)
+	c := relay.NewClient(ln.Addr().String(), group, "eve", relay.ClientTLS(wrong))
+	go c.Run(ctx, func([]byte, bool) {})
+
+	time.Sleep(500 * time.Millisecond)
+	if c.Connected() || len(server.Members()) != 0 {
+		t.Error("client connected despite a fingerprint mismatch")
+	}
+}
+
+// startRelay serves a relay with limits on localhost.
+func startRelay(t *testing.T, ctx context.Context, limits relay.Limits) (*relay.Server, string, *tls.Config) {
+	certPEM, keyPEM, err := relay.SelfSigned()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", relay.ServerTLS(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := relay.NewServer()
+	server.Limits = limits
+	go server.Serve(ctx, ln)
+	return server, ln.Addr().String(), relay.ClientTLS(relay.Fingerprint(cert))
+}
+
+func TestRelayLimits(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	server, addr, config := startRelay(t, ctx, relay.Limits{Members: 2, Envelope: 4 << 10})
+
+	key := relay.NewKey()
+	start := func(name string) (*relay.Client, chan []byte) {
+		group, _ := relay.NewGroup(key)
+		c := relay.NewClient(addr, group, name, config)
+		received := make(chan []byte, 4)
+		go c.Run(ctx, func(clip []byte, _ bool) { received <- clip })
+		return c, received
+	}
+	alice, _ := start("alice")
+	bob, bobGot := start("bob")
+	deadline := time.Now().Add(5 * time.Second)
+	for !alice.Connected() || !bob.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatalf("clients did not connect: %v", server.Members())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// A third member doesn't fit in the group
+	carol, _ := start("carol")
+	time.Sleep(300 * time.Millisecond)
+	if carol.Connected() {
+		t.Error("a member joined a full group")
+	}
+	for _, n := range server.Members() {
+		if n != 2 {
+			t.Errorf("group has %d members, want 2", n)
+		}
+	}
+
+	// An envelope over the limit is not forwarded
+	if err := alice.Send(bytes.Repeat([]byte("x"), 8<<10), false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case clip := <-bobGot:
+		t.Errorf("bob got an oversized clip of %d bytes", len(clip))
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestRelayGroupRate(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	_, addr, config := startRelay(t, ctx, relay.Limits{GroupRate: 1})
+
+	key := relay.NewKey()
+	alice, _ := relay.NewGroup(key)
+	bob, _ := relay.NewGroup(key)
+	sender := relay.NewClient(addr, alice, "alice", config)
+	receiver := relay.NewClient(addr, bob, "bob", config)
+	received := make(chan []byte, 16)
+	go sender.Run(ctx, func([]byte, bool) {})
+	go receiver.Run(ctx, func(clip []byte, _ bool) { received <- clip })
+	deadline := time.Now().Add(5 * time.Second)
+	for !sender.Connected() || !receiver.Connected() {
+		if time.Now().After(deadline) {
+			t.Fatal("clients did not connect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The burst lets a clip through, the rest of a flood is dropped
+	for range 10 {
+		if err := sender.Send(bytes.Repeat([]byte("x"), 512<<10), false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(300 * time.Millisecond)
+	if n := len(received); n == 0 || n >= 10 {
+		t.Errorf("bob got %d of 10 clips, want the flood cut short", n)
+	}
+}
+
+func TestRelayConnsPerHost(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	_, addr, config := startRelay(t, ctx, relay.Limits{ConnsPerHost: 1})
+
+	first, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	if second, err := tls.Dial("tcp", addr, config); err == nil {
+		second.Close()
+		t.Error("a second connection from the same host was served")
+	}
+	first.Close()
+
+	// The slot is freed once the first connection goes away
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := tls.Dial("tcp", addr, config)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no connection served after the first closed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// member is a device of a relay group in the tests below.
+type member struct {
+	name  string
+	id    *relay.Identity
+	group *relay.Group
+	keys  []string
+}
+
+func newMember(t *testing.T, name, key string, id *relay.Identity) *member {
+	t.Helper()
+	group, err := relay.NewGroup(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	group.UseIdentity(id)
+	m := &member{name: name, id: id, group: group}
+	group.OnRekey = func(key string) { m.keys = append(m.keys, key) }
+	return m
+}
+
+// deliver opens env as each of to, failing the test on errors.
+func deliver(t *testing.T, env []byte, to ...*member) {
+	t.Helper()
+	for _, m := range to {
+		if clip, _, err := m.group.Open(env); err != nil || clip != nil {
+			t.Fatalf("%s: Open = %q, %v", m.name, clip, err)
+		}
+	}
+}
+
+// status returns the members g knows, as "name" or "name (revoked)".
+func status(g *relay.Group) []string {
+	var out []string
+	for _, m := range g.Members() {
+		s := m.Name
+		if m.Revoked {
+			s += " (revoked)"
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestRevoke(t *testing.T) {
+	key := relay.NewKey()
+	path := filepath.Join(t.TempDir(), "bob.key")
+	bobID, err := relay.LoadIdentity(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := newMember(t, "alice", key, relay.NewIdentity())
+	bob := newMember(t, "bob", key, bobID)
+	carol := newMember(t, "carol", key, relay.NewIdentity())
+
+	// Bob only learns of carol through alice
+	deliver(t, alice.group.Announce("alice"), bob, carol)
+	deliver(t, bob.group.Announce("bob"), alice)
+	deliver(t, carol.group.Announce("carol"), alice)
+	deliver(t, alice.group.Announce("alice"), bob)
+	if got := status(bob.group); !slices.Equal(got, []string{"alice", "bob", "carol"}) {
+		t.Fatalf("bob knows %v", got)
+	}
+
+	if _, _, err := relay.Rotate(alice.group, []string{strings.Repeat("00", 8)}); !errors.Is(err, relay.ErrUnknownMember) {
+		t.Errorf("revoking an unknown device: err = %v, want ErrUnknownMember", err)
+	}
+	if _, _, err := relay.Rotate(alice.group, []string{alice.id.ID()}); !errors.Is(err, relay.ErrRevokeSelf) {
+		t.Errorf("revoking this device: err = %v, want ErrRevokeSelf", err)
+	}
+
+	// Carol's laptop is stolen
+	env, apply, err := relay.Rotate(alice.group, []string{carol.id.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, env, bob, carol)
+	newKey := apply()
+	if newKey == key || !slices.Equal(alice.keys, []string{newKey}) || !slices.Equal(bob.keys, []string{newKey}) {
+		t.Fatalf("rotated to %q: alice saved %q, bob %q", newKey, alice.keys, bob.keys)
+	}
+	if len(carol.keys) != 0 {
+		t.Fatalf("the revoked device got the new key")
+	}
+	if got := status(bob.group); !slices.Equal(got, []string{"alice", "bob", "carol (revoked)"}) {
+		t.Errorf("after the rotation bob knows %v", got)
+	}
+
+	after := alice.group.Seal([]byte("after"), false)
+	if clip, _, err := bob.group.Open(after); err != nil || string(clip) != "after" {
+		t.Errorf("bob: Open after the rotation = %q, %v", clip, err)
+	}
+	if _, _, err := carol.group.Open(after); !errors.Is(err, relay.ErrEnvelope) {
+		t.Errorf("carol: Open after the rotation: err = %v, want ErrEnvelope", err)
+	}
+	if _, _, err := alice.group.Open(carol.group.Seal([]byte("old key"), false)); !errors.Is(err, relay.ErrEnvelope) {
+		t.Errorf("a clip sealed with the old key: err = %v, want ErrEnvelope", err)
+	}
+	// Even with the new key, carol is refused
+	stolen := newMember(t, "carol", newKey, carol.id)
+	if _, _, err := bob.group.Open(stolen.group.Seal([]byte("hi"), false)); !errors.Is(err, relay.ErrRevoked) {
+		t.Errorf("a revoked device with the new key: err = %v, want ErrRevoked", err)
+	}
+
+	// Rotating without revoking anyone keeps everybody else
+	env, apply, err = relay.Rotate(bob.group, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, env, alice)
+	if third := apply(); alice.keys[len(alice.keys)-1] != third {
+		t.Errorf("alice did not get the key bob rotated to")
+	}
+}
+
+func TestMembersAfterRestart(t *testing.T) {
+	key := relay.NewKey()
+	path := filepath.Join(t.TempDir(), "group.json")
+	id := relay.NewIdentity()
+	alice := newMember(t, "alice", key, relay.NewIdentity())
+	bob := newMember(t, "bob", key, id)
+	if err := bob.group.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	deliver(t, alice.group.Announce("alice"), bob)
+
+	restarted := newMember(t, "bob", key, id)
+	if err := restarted.group.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(restarted.group); !slices.Equal(got, []string{"", "alice"}) {
+		t.Errorf("after a restart bob knows %v", got)
+	}
+	// The state of another group is not loaded
+	other := newMember(t, "bob", relay.NewKey(), id)
+	if err := other.group.Persist(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(other.group); len(got) != 1 {
+		t.Errorf("another group loaded members %v", got)
+	}
+}
+
+// TestRelayRotate revokes a member of a group connected through a relay.
+func TestRelayRotate(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+	_, addr, config := startRelay(t, ctx, relay.Limits{})
+
+	key := relay.NewKey()
+	rekeyed := make(chan string, 1)
+	start := func(name string) (*relay.Client, *relay.Identity, chan []byte) {
+		group, _ := relay.NewGroup(key)
+		id := relay.NewIdentity()
+		group.UseIdentity(id)
+		if name == "bob" {
+			group.OnRekey = func(key string) { rekeyed <- key }
+		}
+		c := relay.NewClient(addr, group, name, config)
+		received := make(chan []byte, 4)
+		go c.Run(ctx, func(clip []byte, _ bool) { received <- clip })
+		deadline := time.Now().Add(5 * time.Second)
+		for !c.Connected() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s did not connect", name)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return c, id, received
+	}
+	alice, _, _ := start("alice")
+	bob, _, bobGot := start("bob")
+	_, carolID, carolGot := start("carol")
+
+	// Members announce themselves as they connect
+	deadline := time.Now().Add(5 * time.Second)
+	for len(alice.Group.Members()) != 3 || len(bob.Group.Members()) != 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("alice knows %v, bob %v", status(alice.Group), status(bob.Group))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := alice.Rotate([]string{carolID.ID()}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-rekeyed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("bob did not get the new key")
+	}
+	if err := alice.Send([]byte("after"), false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case clip := <-bobGot:
+		if string(clip) != "after" {
+			t.Errorf("bob got %q", clip)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("bob did not receive the clip")
+	}
+	select {
+	case clip := <-carolGot:
+		t.Errorf("the revoked device got %q", clip)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
@@ -0,0 +1,268 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"clipsync/internal/logging"
+)
+
+var logger = logging.For(logging.Relay)
+
+// handshakeTimeout bounds how long a new connection may take to say hello.
+const handshakeTimeout = 10 * time.Second
+
+// Limits bounds what the relay serves, so that one client or group can't
+// exhaust it. Zero fields are unlimited.
+type Limits struct {
+	// Conns is the most connections served at once.
+	Conns int
+	// ConnsPerHost is the most connections from one address.
+	ConnsPerHost int
+	// Members is the most members of one group.
+	Members int
+	// Envelope is the largest envelope a member may send, at most
+	// MaxEnvelope. A larger one ends its connection.
+	Envelope int
+	// GroupRate is how many bytes a second one group may send. Envelopes
+	// beyond it are dropped.
+	GroupRate int
+}
+
+// DefaultLimits are generous for a household or a team, and keep a relay
+// on a small machine up.
+var DefaultLimits = Limits{
+	Conns:        1024,
+	ConnsPerHost: 32,
+	Members:      64,
+	Envelope:     MaxEnvelope,
+	GroupRate:    4 << 20,
+}
+
+// Server is the hub: it forwards envelopes between the connected members
+// of each group.
+type Server struct {
+	// Limits is read when Serve starts.
+	Limits Limits
+
+	mu     sync.Mutex
+	groups map[string]*group
+	conns  int
+	hosts  map[string]int
+}
+
+type group struct {
+	members map[*member]bool
+	// budget is how many bytes the group may send now, refilled at
+	// Limits.GroupRate.
+	budget float64
+	filled time.Time
+}
+
+type member struct {
+	name string
+	addr string
+	send chan []byte
+}
+
+func NewServer() *Server {
+	return &Server{Limits: DefaultLimits, groups: map[string]*group{}, hosts: map[string]int{}}
+}
+
+// Serve accepts connections on ln, which is expected to do TLS, until ctx
+// is done.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	logger.Info("Relay listening", "addr", ln.Addr().String())
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	limits := s.Limits
+	if limits.Envelope <= 0 || limits.Envelope > MaxEnvelope {
+		limits.Envelope = MaxEnvelope
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				continue
+			}
+			return err
+		}
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		if !s.admit(host, limits) {
+			logger.Warn("Too many connections, refusing", "addr", conn.RemoteAddr().String())
+			conn.Close()
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer s.release(host)
+			s.handle(ctx, conn, limits)
+		}()
+	}
+}
+
+// Members returns how many clients are connected to each group.
+func (s *Server) Members() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[string]int{}
+	for id, g := range s.groups {
+		counts[id] = len(g.members)
+	}
+	return counts
+}
+
+// admit counts a new connection from host, unless it would go over the
+// limits.
+func (s *Server) admit(host string, limits Limits) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if limits.Conns > 0 && s.conns >= limits.Conns {
+		return false
+	}
+	if limits.ConnsPerHost > 0 && s.hosts[host] >= limits.ConnsPerHost {
+		return false
+	}
+	s.conns++
+	s.hosts[host]++
+	return true
+}
+
+func (s *Server) release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns--
+	if s.hosts[host]--; s.hosts[host] == 0 {
+		delete(s.hosts, host)
+	}
+}
+
+func (s *Server) handle(ctx context.Context, conn net.Conn, limits Limits) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+	var h hello
+	if err := readJSON(conn, &h); err != nil {
+		logger.Debug("Relay handshake failed", "addr", conn.RemoteAddr().String(), logging.Err(err))
+		return
+	}
+	if h.Version != protocolVersion || len(h.Group) != 32 {
+		writeJSON(conn, welcome{Error: "unsupported client, update ClipSync"})
+		return
+	}
+	m := &member{name: h.Name, addr: conn.RemoteAddr().String(), send: make(chan []byte, 16)}
+	if !s.join(h.Group, m, limits) {
+		writeJSON(conn, welcome{Error: "the group is full"})
+		return
+	}
+	defer s.leave(h.Group, m)
+	if err := writeJSON(conn, welcome{}); err != nil {
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	go func() {
+		defer cancel()
+		for {
+			select {
+			case env := <-m.send:
+				if err := writeMsg(conn, env); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		env, err := readMsg(conn, limits.Envelope)
+		if err != nil {
+			logger.Debug("Member connection ended", "name", m.name, "addr", m.addr, logging.Err(err))
+			return
+		}
+		s.forward(h.Group, m, env, limits.GroupRate)
+	}
+}
+
+// join adds m to its group, unless the group is full.
+func (s *Server) join(id string, m *member, limits Limits) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[id]
+	if g == nil {
+		g = &group{members: map[*member]bool{}, budget: burst(limits.GroupRate), filled: time.Now()}
+		s.groups[id] = g
+	}
+	if limits.Members > 0 && len(g.members) >= limits.Members {
+		logger.Warn("Group full, refusing member", "group", id[:8], "name", m.name, "addr", m.addr)
+		return false
+	}
+	g.members[m] = true
+	logger.Info("Member joined", "group", id[:8], "name", m.name, "addr", m.addr, "members", len(g.members))
+	return true
+}
+
+func (s *Server) leave(id string, m *member) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[id]
+	delete(g.members, m)
+	if len(g.members) == 0 {
+		delete(s.groups, id)
+	}
+	logger.Info("Member left", "group", id[:8], "name", m.name, "addr", m.addr, "members", len(g.members))
+}
+
+// forward queues env for every other member of the group. A member that
+// can't keep up misses the envelope rather than holding up the others, and
+// so do all of them when the group sends faster than rate.
+func (s *Server) forward(id string, from *member, env []byte, rate int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g := s.groups[id]
+	if rate > 0 {
+		now := time.Now()
+		g.budget = min(g.budget+now.Sub(g.filled).Seconds()*float64(rate), burst(rate))
+		g.filled = now
+		if g.budget < float64(len(env)) {
+			logger.Warn("Group over its rate, dropping envelope", "group", id[:8], "name", from.name, "addr", from.addr)
+			return
+		}
+		g.budget -= float64(len(env))
+	}
+	for m := range g.members {
+		if m == from {
+			continue
+		}
+		select {
+		case m.send <- env:
+		default:
+			logger.Warn("Member too slow, dropping envelope", "name", m.name, "addr", m.addr)
+		}
+	}
+}
+
+// burst is how many bytes a group may send at once: a second's worth at
+// rate, and always enough for one envelope.
+func burst(rate int) float64 {
+	return float64(max(rate, MaxEnvelope))
+}
@@ -0,0 +1,92 @@
+package remote
+
+import (
+	"context"
+
+	"clipsync/internal/events"
+	"clipsync/internal/globals"
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+	"clipsync/internal/view"
+)
+
+// Attach mirrors a running daemon's devices and history into local state,
+// and so into the GUI, until ctx is done or the daemon goes away.
+func Attach(ctx context.Context) error {
+	// Subscribe before taking the snapshot so nothing falls in between
+	stream, err := ipc.Events(ctx)
+	if err != nil {
+		return err
+	}
+	devices, err := ipc.Devices()
+	if err != nil {
+		return err
+	}
+	history, err := ipc.History()
+	if err != nil {
+		return err
+	}
+	view.LoadState(devices, history)
+	if status, err := ipc.Status(); err == nil {
+		view.SetPaused(status.Paused)
+	}
+	if transfers, err := ipc.Transfers(); err == nil {
+		for _, t := range transfers {
+			view.UpdateTransfer(t)
+		}
+	}
+	if members, err := ipc.RelayMembers(); err == nil {
+		view.SetMembers(members)
+	}
+	logging.For(logging.IPC).Info("Attached to running daemon", "devices", len(devices), "clips", len(history))
+
+	for e := range stream {
+		apply(e)
+	}
+	return ctx.Err()
+}
+
+func apply(e events.Event) {
+	switch e.Type {
+	case events.DeviceAdded:
+		if e.Device != nil {
+			view.UpdateDevices(*e.Device)
+		}
+	case events.DeviceRemoved:
+		if e.Device != nil {
+			view.RemoveDevice(e.Device.Ip)
+		}
+	case events.SyncPaused:
+		view.SetPaused(e.Reason)
+	case events.ClipAdded:
+		if e.Clip != nil && !known(e.Clip.ID) {
+			view.AddClip(*e.Clip)
+		}
+	case events.ClipFetched:
+		if e.Clip != nil {
+			view.FillClip(*e.Clip)
+		}
+	case events.ClipUpdated:
+		if e.Clip != nil {
+			view.UpdateClip(*e.Clip)
+		}
+	case events.TransferUpdated:
+		if e.Transfer != nil {
+			view.UpdateTransfer(*e.Transfer)
+		}
+	case events.MembersUpdated:
+		view.SetMembers(e.Members)
+	}
+}
+
+// known reports whether the snapshot already holds the clip.
+func known(id int) bool {
+	globals.ClipHistoryMu.Lock()
+	defer globals.ClipHistoryMu.Unlock()
+	for _, clip := range globals.ClipHistory {
+		if clip.ID == id {
+			return true
+		}
+	}
+	return false
+}
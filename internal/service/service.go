@@ -0,0 +1,143 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Name is how ClipSync is registered with the service manager.
+const Name = "clipsync"
+
+// ErrNotInstalled is returned when no service has been registered.
+var ErrNotInstalled = errors.New("service is not installed")
+
+// Options selects what gets installed.
+type Options struct {
+	// GUI installs a login autostart entry for the GUI instead of the daemon.
+	GUI bool
+	// SocketActivation lets the service manager own the IPC socket and
+	// start the daemon on first use, where supported.
+	SocketActivation bool
+	// IPCPort is the port the activation socket listens on.
+	IPCPort int
+	// DaemonArgs are extra flags passed to the daemon, e.g. --headless.
+	DaemonArgs []string
+}
+
+// Status describes what is registered with the service manager.
+type Status struct {
+	Manager   string   `json:"manager" yaml:"manager"`
+	Installed bool     `json:"installed" yaml:"installed"`
+	Running   bool     `json:"running" yaml:"running"`
+	Files     []string `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// File is a file a plan writes.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Plan lists the changes an install or uninstall makes, so they can be
+// shown before anything is touched. Apply performs them in field order.
+type Plan struct {
+	Files    []File
+	Commands [][]string
+	Remove   []string
+	// Cleanup runs once the files in Remove are gone.
+	Cleanup [][]string
+}
+
+// Print writes a human readable description of the plan to w.
+func (p *Plan) Print(w io.Writer) {
+	for _, f := range p.Files {
+		fmt.Fprintf(w, "write %s:\n", f.Path)
+		for _, line := range strings.Split(strings.TrimRight(f.Content, "\n"), "\n") {
+			fmt.Fprintf(w, "    %s\n", line)
+		}
+	}
+	for _, cmd := range p.Commands {
+		fmt.Fprintf(w, "run %s\n", strings.Join(cmd, " "))
+	}
+	for _, path := range p.Remove {
+		fmt.Fprintf(w, "remove %s\n", path)
+	}
+	for _, cmd := range p.Cleanup {
+		fmt.Fprintf(w, "run %s\n", strings.Join(cmd, " "))
+	}
+}
+
+// Apply writes the files, runs the commands, removes the old files and
+// runs the cleanup commands.
+func (p *Plan) Apply() error {
+	for _, f := range p.Files {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(f.Path, []byte(f.Content), 0644); err != nil {
+			return err
+		}
+	}
+	if err := runAll(p.Commands); err != nil {
+		return err
+	}
+	for _, path := range p.Remove {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return runAll(p.Cleanup)
+}
+
+func runAll(cmds [][]string) error {
+	for _, cmd := range cmds {
+		if err := run(cmd[0], cmd[1:]...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Install registers ClipSync with the platform's service manager.
+func Install(opts Options) error {
+	plan, err := InstallPlan(opts)
+	if err != nil {
+		return err
+	}
+	return plan.Apply()
+}
+
+// Uninstall removes everything Install registered.
+func Uninstall() error {
+	plan, err := UninstallPlan()
+	if err != nil {
+		return err
+	}
+	return plan.Apply()
+}
+
+func executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+func run(name string, args ...string) error {
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
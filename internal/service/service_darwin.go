@@ -0,0 +1,114 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const label = "com.diamondosas.clipsync"
+
+const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+%s	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>ThrottleInterval</key>
+	<integer>5</integer>
+	<key>ProcessType</key>
+	<string>Interactive</string>
+</dict>
+</plist>
+`
+
+func plistPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Library", "LaunchAgents", label+".plist"), nil
+}
+
+// InstallPlan returns a launchd agent that keeps the daemon, or the GUI,
+// running for the logged in user.
+func InstallPlan(opts Options) (*Plan, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	path, err := plistPath()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{exe}
+	if !opts.GUI {
+		args = append(args, "daemon")
+		args = append(args, opts.DaemonArgs...)
+	}
+	var b strings.Builder
+	for _, arg := range args {
+		fmt.Fprintf(&b, "\t\t<string>%s</string>\n", html.EscapeString(arg))
+	}
+
+	return &Plan{
+		Files:    []File{{Path: path, Content: fmt.Sprintf(plistTemplate, label, b.String())}},
+		Commands: [][]string{{"launchctl", "load", "-w", path}},
+	}, nil
+}
+
+// UninstallPlan unloads and removes the launchd agent.
+func UninstallPlan() (*Plan, error) {
+	path, err := plistPath()
+	if err != nil {
+		return nil, err
+	}
+	if !exists(path) {
+		return nil, ErrNotInstalled
+	}
+	return &Plan{
+		Commands: [][]string{{"launchctl", "unload", "-w", path}},
+		Remove:   []string{path},
+	}, nil
+}
+
+// Query reports whether the agent is installed and loaded with a PID.
+func Query() (*Status, error) {
+	path, err := plistPath()
+	if err != nil {
+		return nil, err
+	}
+	status := &Status{Manager: "launchd", Installed: exists(path)}
+	if status.Installed {
+		status.Files = []string{path}
+	}
+	out, err := exec.Command("launchctl", "list", label).Output()
+	status.Running = err == nil && strings.Contains(string(out), `"PID"`)
+	return status, nil
+}
+
+// Start asks launchd to start the installed agent.
+func Start() error {
+	path, err := plistPath()
+	if err != nil {
+		return err
+	}
+	if !exists(path) {
+		return ErrNotInstalled
+	}
+	return run("launchctl", "start", label)
+}
@@ -0,0 +1,44 @@
+package service_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"clipsync/internal/service"
+)
+
+func TestInstallPlanLaunchd(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+
+	plan, err := service.InstallPlan(service.Options{
+		DaemonArgs: []string{"--config", "/Users/me/my <config>.yaml"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 {
+		t.Fatalf("Files = %+v, want one plist", plan.Files)
+	}
+	plist := plan.Files[0]
+	if want := filepath.Join(home, "Library", "LaunchAgents", "com.diamondosas.clipsync.plist"); plist.Path != want {
+		t.Errorf("plist path = %s, want %s", plist.Path, want)
+	}
+	want := "\t\t<string>daemon</string>\n\t\t<string>--config</string>\n\t\t<string>/Users/me/my &lt;config&gt;.yaml</string>\n\t</array>"
+	if !strings.Contains(plist.Content, want) {
+		t.Errorf("plist does not pass each argument as its own string:\n%s", plist.Content)
+	}
+}
+
+func TestInstallPlanLaunchdGUI(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	plan, err := service.InstallPlan(service.Options{GUI: true, DaemonArgs: []string{"--headless"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content := plan.Files[0].Content; strings.Contains(content, "daemon") || strings.Contains(content, "--headless") {
+		t.Errorf("GUI agent runs the daemon:\n%s", content)
+	}
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const unitTemplate = `[Unit]
+Description=ClipSync clipboard sync
+Documentation=https://github.com/DiamondOsas/ClipSync
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=notify
+ExecStart=%s
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=default.target
+`
+
+const socketTemplate = `[Unit]
+Description=ClipSync control socket
+
+[Socket]
+ListenStream=127.0.0.1:%d
+
+[Install]
+WantedBy=sockets.target
+`
+
+const desktopTemplate = `[Desktop Entry]
+Type=Application
+Name=ClipSync
+Comment=Clipboard sync across your local network
+Exec=%s
+Terminal=false
+X-GNOME-Autostart-enabled=true
+`
+
+func userConfigDir() (string, error) {
+	return os.UserConfigDir()
+}
+
+func unitDir() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "systemd", "user"), nil
+}
+
+func autostartPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autostart", Name+".desktop"), nil
+}
+
+// InstallPlan returns the systemd user units, or the XDG autostart entry
+// for the GUI, and the commands that enable them.
+func InstallPlan(opts Options) (*Plan, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.GUI {
+		path, err := autostartPath()
+		if err != nil {
+			return nil, err
+		}
+		return &Plan{Files: []File{{Path: path, Content: fmt.Sprintf(desktopTemplate, quoteExec(exe))}}}, nil
+	}
+
+	dir, err := unitDir()
+	if err != nil {
+		return nil, err
+	}
+	execStart := quoteExec(append([]string{exe, "daemon"}, opts.DaemonArgs...)...)
+	plan := &Plan{
+		Files: []File{{Path: filepath.Join(dir, Name+".service"), Content: fmt.Sprintf(unitTemplate, execStart)}},
+	}
+
+	units := []string{Name + ".service"}
+	if opts.SocketActivation {
+		plan.Files = append(plan.Files, File{
+			Path:    filepath.Join(dir, Name+".socket"),
+			Content: fmt.Sprintf(socketTemplate, opts.IPCPort),
+		})
+		// The socket comes first so the service finds it when it starts
+		units = append([]string{Name + ".socket"}, units...)
+	}
+	plan.Commands = [][]string{
+		{"systemctl", "--user", "daemon-reload"},
+		append([]string{"systemctl", "--user", "enable", "--now"}, units...),
+	}
+	return plan, nil
+}
+
+// UninstallPlan disables and removes whatever InstallPlan may have written.
+func UninstallPlan() (*Plan, error) {
+	dir, err := unitDir()
+	if err != nil {
+		return nil, err
+	}
+	plan := &Plan{}
+	for _, unit := range []string{Name + ".socket", Name + ".service"} {
+		path := filepath.Join(dir, unit)
+		if exists(path) {
+			plan.Commands = append(plan.Commands, []string{"systemctl", "--user", "disable", "--now", unit})
+			plan.Remove = append(plan.Remove, path)
+		}
+	}
+	if len(plan.Remove) > 0 {
+		plan.Cleanup = [][]string{{"systemctl", "--user", "daemon-reload"}}
+	}
+	if path, err := autostartPath(); err == nil && exists(path) {
+		plan.Remove = append(plan.Remove, path)
+	}
+	if len(plan.Remove) == 0 {
+		return nil, ErrNotInstalled
+	}
+	return plan, nil
+}
+
+// Query reports whether the units are installed and active.
+func Query() (*Status, error) {
+	status := &Status{Manager: "systemd"}
+	dir, err := unitDir()
+	if err != nil {
+		return nil, err
+	}
+	for _, unit := range []string{Name + ".service", Name + ".socket"} {
+		if path := filepath.Join(dir, unit); exists(path) {
+			status.Installed = true
+			status.Files = append(status.Files, path)
+		}
+	}
+	if path, err := autostartPath(); err == nil && exists(path) {
+		status.Installed = true
+		status.Files = append(status.Files, path)
+	}
+	out, _ := exec.Command("systemctl", "--user", "is-active", Name+".service").Output()
+	status.Running = strings.TrimSpace(string(out)) == "active"
+	return status, nil
+}
+
+// Start asks systemd to start the installed daemon.
+func Start() error {
+	dir, err := unitDir()
+	if err != nil {
+		return err
+	}
+	if !exists(filepath.Join(dir, Name+".service")) {
+		return ErrNotInstalled
+	}
+	return run("systemctl", "--user", "start", Name+".service")
+}
+
+// quoteExec joins args into a command line for unit and desktop files.
+// Both read % as the start of a specifier, so it is doubled.
+func quoteExec(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "%", "%%")
+		if strings.ContainsAny(arg, " \t\"\\") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
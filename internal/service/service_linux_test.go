@@ -0,0 +1,86 @@
+package service_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"clipsync/internal/service"
+)
+
+func TestInstallPlanSystemd(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	plan, err := service.InstallPlan(service.Options{
+		SocketActivation: true,
+		IPCPort:          7001,
+		DaemonArgs:       []string{"--config", "/home/me/my config.yaml", "--headless", "--clip-file", "/tmp/100%"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 2 {
+		t.Fatalf("Files = %+v, want the service and socket units", plan.Files)
+	}
+	unit, socket := plan.Files[0], plan.Files[1]
+	if want := filepath.Join(config, "systemd", "user", "clipsync.service"); unit.Path != want {
+		t.Errorf("unit path = %s, want %s", unit.Path, want)
+	}
+	if want := ` daemon --config "/home/me/my config.yaml" --headless --clip-file /tmp/100%%` + "\n"; !strings.Contains(unit.Content, want) {
+		t.Errorf("unit does not run %q:\n%s", want, unit.Content)
+	}
+	if !strings.Contains(socket.Content, "ListenStream=127.0.0.1:7001\n") {
+		t.Errorf("socket does not listen on the IPC port:\n%s", socket.Content)
+	}
+	enable := plan.Commands[len(plan.Commands)-1]
+	if !slices.Equal(enable[len(enable)-2:], []string{"clipsync.socket", "clipsync.service"}) {
+		t.Errorf("enable = %v, want the socket before the service", enable)
+	}
+}
+
+func TestInstallPlanAutostart(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	plan, err := service.InstallPlan(service.Options{GUI: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Files) != 1 || plan.Files[0].Path != filepath.Join(config, "autostart", "clipsync.desktop") {
+		t.Fatalf("Files = %+v, want one autostart entry", plan.Files)
+	}
+	if len(plan.Commands) != 0 {
+		t.Errorf("Commands = %v, want none for an autostart entry", plan.Commands)
+	}
+}
+
+func TestUninstallPlanSystemd(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config")
+	t.Setenv("XDG_CONFIG_HOME", config)
+
+	if _, err := service.UninstallPlan(); !errors.Is(err, service.ErrNotInstalled) {
+		t.Fatalf("UninstallPlan() on a clean system = %v, want ErrNotInstalled", err)
+	}
+
+	unit := filepath.Join(config, "systemd", "user", "clipsync.service")
+	if err := os.MkdirAll(filepath.Dir(unit), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(unit, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	plan, err := service.UninstallPlan()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(plan.Remove, []string{unit}) {
+		t.Errorf("Remove = %v, want only %s", plan.Remove, unit)
+	}
+	if len(plan.Commands) != 1 || !slices.Contains(plan.Commands[0], "clipsync.service") {
+		t.Errorf("Commands = %v, want the service disabled", plan.Commands)
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package service
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func InstallPlan(opts Options) (*Plan, error) {
+	return nil, fmt.Errorf("service install is not supported on %s", runtime.GOOS)
+}
+
+func UninstallPlan() (*Plan, error) {
+	return nil, ErrNotInstalled
+}
+
+func Query() (*Status, error) {
+	return &Status{Manager: "none"}, nil
+}
+
+func Start() error {
+	return ErrNotInstalled
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+const taskName = "ClipSync"
+
+// The task restarts the daemon if it fails and never times it out.
+const taskTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<Task version="1.2" xmlns="http://schemas.microsoft.com/windows/2004/02/mit/task">
+  <RegistrationInfo>
+    <Description>ClipSync clipboard sync</Description>
+  </RegistrationInfo>
+  <Triggers>
+    <LogonTrigger>
+      <Enabled>true</Enabled>
+    </LogonTrigger>
+  </Triggers>
+  <Principals>
+    <Principal id="Author">
+      <LogonType>InteractiveToken</LogonType>
+      <RunLevel>LeastPrivilege</RunLevel>
+    </Principal>
+  </Principals>
+  <Settings>
+    <MultipleInstancesPolicy>IgnoreNew</MultipleInstancesPolicy>
+    <DisallowStartIfOnBatteries>false</DisallowStartIfOnBatteries>
+    <StopIfGoingOnBatteries>false</StopIfGoingOnBatteries>
+    <ExecutionTimeLimit>PT0S</ExecutionTimeLimit>
+    <RestartOnFailure>
+      <Interval>PT1M</Interval>
+      <Count>999</Count>
+    </RestartOnFailure>
+  </Settings>
+  <Actions Context="Author">
+    <Exec>
+      <Command>%s</Command>
+      <Arguments>%s</Arguments>
+    </Exec>
+  </Actions>
+</Task>
+`
+
+func taskFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "clipsync", "task.xml"), nil
+}
+
+// InstallPlan returns a scheduled task that starts the daemon, or the
+// GUI, at logon and restarts it on failure.
+func InstallPlan(opts Options) (*Plan, error) {
+	exe, err := executable()
+	if err != nil {
+		return nil, err
+	}
+	path, err := taskFile()
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	if !opts.GUI {
+		args = append([]string{"daemon"}, opts.DaemonArgs...)
+	}
+	content := fmt.Sprintf(taskTemplate, html.EscapeString(exe), html.EscapeString(quoteArgs(args)))
+
+	return &Plan{
+		Files:    []File{{Path: path, Content: content}},
+		Commands: [][]string{{"schtasks", "/Create", "/TN", taskName, "/XML", path, "/F"}},
+	}, nil
+}
+
+// UninstallPlan deletes the scheduled task.
+func UninstallPlan() (*Plan, error) {
+	if exec.Command("schtasks", "/Query", "/TN", taskName).Run() != nil {
+		return nil, ErrNotInstalled
+	}
+	plan := &Plan{Commands: [][]string{
+		{"schtasks", "/End", "/TN", taskName},
+		{"schtasks", "/Delete", "/TN", taskName, "/F"},
+	}}
+	if path, err := taskFile(); err == nil && exists(path) {
+		plan.Remove = []string{path}
+	}
+	return plan, nil
+}
+
+// Query reports whether the task is registered and currently running.
+func Query() (*Status, error) {
+	status := &Status{Manager: "Task Scheduler"}
+	out, err := exec.Command("schtasks", "/Query", "/TN", taskName, "/FO", "LIST").Output()
+	if err != nil {
+		return status, nil
+	}
+	status.Installed = true
+	status.Running = strings.Contains(string(out), "Running")
+	if path, err := taskFile(); err == nil && exists(path) {
+		status.Files = []string{path}
+	}
+	return status, nil
+}
+
+// Start runs the scheduled task now.
+func Start() error {
+	if exec.Command("schtasks", "/Query", "/TN", taskName).Run() != nil {
+		return ErrNotInstalled
+	}
+	return run("schtasks", "/Run", "/TN", taskName)
+}
+
+// quoteArgs joins args into a command line that Windows splits back into
+// the same arguments, e.g. paths with spaces.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = syscall.EscapeArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,49 @@
+package service_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"clipsync/internal/service"
+)
+
+func TestInstallPlanTask(t *testing.T) {
+	appdata := t.TempDir()
+	t.Setenv("APPDATA", appdata)
+
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--headless"}, "<Arguments>daemon --headless</Arguments>"},
+		{[]string{"--config", `C:\Users\me\My Documents\clipsync.yaml`}, `<Arguments>daemon --config &#34;C:\Users\me\My Documents\clipsync.yaml&#34;</Arguments>`},
+		{[]string{"--name", `say "hi"`}, `<Arguments>daemon --name &#34;say \&#34;hi\&#34;&#34;</Arguments>`},
+		{[]string{"--dir", `C:\with space\`}, `<Arguments>daemon --dir &#34;C:\with space\\&#34;</Arguments>`},
+	}
+	for _, tt := range tests {
+		plan, err := service.InstallPlan(service.Options{DaemonArgs: tt.args})
+		if err != nil {
+			t.Fatal(err)
+		}
+		task := plan.Files[0]
+		if want := filepath.Join(appdata, "clipsync", "task.xml"); task.Path != want {
+			t.Errorf("task path = %s, want %s", task.Path, want)
+		}
+		if !strings.Contains(task.Content, tt.want) {
+			t.Errorf("DaemonArgs %q: task does not contain %s:\n%s", tt.args, tt.want, task.Content)
+		}
+	}
+}
+
+func TestInstallPlanTaskGUI(t *testing.T) {
+	t.Setenv("APPDATA", t.TempDir())
+
+	plan, err := service.InstallPlan(service.Options{GUI: true, DaemonArgs: []string{"--headless"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(plan.Files[0].Content, "<Arguments></Arguments>") {
+		t.Errorf("GUI task passes arguments:\n%s", plan.Files[0].Content)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package service
+
+import "net"
+
+// Notify is a no-op outside systemd.
+func Notify(state string) error {
+	return nil
+}
+
+// ActivationListener always returns nil outside systemd.
+func ActivationListener() (net.Listener, error) {
+	return nil, nil
+}
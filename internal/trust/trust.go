@@ -0,0 +1,199 @@
+// Package trust decides whether the current network is one the user
+// trusts to sync on, by matching what can be detected about it against
+// the configured network profiles.
+package trust
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"clipsync/internal/config"
+)
+
+// Network is what could be detected about the networks the machine is on.
+type Network struct {
+	SSIDs      []string  `json:"ssids,omitempty" yaml:"ssids,omitempty"`
+	Gateways   []Gateway `json:"gateways,omitempty" yaml:"gateways,omitempty"`
+	Subnets    []string  `json:"subnets,omitempty" yaml:"subnets,omitempty"`
+	Interfaces []string  `json:"interfaces,omitempty" yaml:"interfaces,omitempty"`
+	// Links is what was detected per interface, for TrustedInterfaces.
+	Links []Link `json:"-" yaml:"-"`
+}
+
+// Link is one interface and the network it is on.
+type Link struct {
+	Name    string
+	Subnets []string
+	// SSID is the Wi-Fi network the interface is on, if any.
+	SSID string
+}
+
+// Gateway is a default gateway and, if it is in the ARP cache, its MAC.
+type Gateway struct {
+	IP  string `json:"ip" yaml:"ip"`
+	MAC string `json:"mac,omitempty" yaml:"mac,omitempty"`
+}
+
+// Detect looks at the interfaces, default gateways and Wi-Fi networks.
+// Whatever can't be detected on this system is left empty.
+func Detect(ctx context.Context) Network {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var n Network
+	byIface := ssids(ctx)
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil || len(addrs) == 0 {
+			continue
+		}
+		n.Interfaces = append(n.Interfaces, iface.Name)
+		link := Link{Name: iface.Name, SSID: byIface[iface.Name]}
+		for _, a := range addrs {
+			if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.IsGlobalUnicast() {
+				link.Subnets = append(link.Subnets, ipnet.String())
+			}
+		}
+		n.Subnets = append(n.Subnets, link.Subnets...)
+		n.Links = append(n.Links, link)
+	}
+	for _, ssid := range byIface {
+		if !slices.Contains(n.SSIDs, ssid) {
+			n.SSIDs = append(n.SSIDs, ssid)
+		}
+	}
+	slices.Sort(n.SSIDs)
+	for _, ip := range gateways(ctx) {
+		n.Gateways = append(n.Gateways, Gateway{IP: ip, MAC: normalizeMAC(gatewayMAC(ctx, ip))})
+	}
+	return n
+}
+
+// Match returns the first profile the network matches. Every field set in
+// a profile must match; a profile with no fields set matches nothing.
+func Match(profiles []config.NetworkProfile, n Network) (config.NetworkProfile, bool) {
+	for _, p := range profiles {
+		if matches(p, n) {
+			return p, true
+		}
+	}
+	return config.NetworkProfile{}, false
+}
+
+// TrustedInterfaces returns the interfaces a profile matches on their own:
+// by the interface's name, subnets and Wi-Fi network, and the gateways in
+// its subnets. A Wi-Fi network that couldn't be tied to an interface
+// counts for every interface without one.
+func TrustedInterfaces(profiles []config.NetworkProfile, n Network) []string {
+	var unattributed []string
+	for _, ssid := range n.SSIDs {
+		if !slices.ContainsFunc(n.Links, func(l Link) bool { return l.SSID == ssid }) {
+			unattributed = append(unattributed, ssid)
+		}
+	}
+	var out []string
+	for _, l := range n.Links {
+		part := Network{Interfaces: []string{l.Name}, Subnets: l.Subnets, SSIDs: unattributed}
+		if l.SSID != "" {
+			part.SSIDs = []string{l.SSID}
+		}
+		for _, g := range n.Gateways {
+			if inSubnets(g.IP, l.Subnets) {
+				part.Gateways = append(part.Gateways, g)
+			}
+		}
+		if _, ok := Match(profiles, part); ok {
+			out = append(out, l.Name)
+		}
+	}
+	return out
+}
+
+// inSubnets reports whether ip is in one of the CIDRs.
+func inSubnets(ip string, subnets []string) bool {
+	addr := net.ParseIP(ip)
+	return contains(subnets, func(s string) bool {
+		_, ipnet, err := net.ParseCIDR(s)
+		return err == nil && addr != nil && ipnet.Contains(addr)
+	})
+}
+
+func matches(p config.NetworkProfile, n Network) bool {
+	if p.SSID == "" && p.GatewayMAC == "" && p.Subnet == "" && p.Interface == "" {
+		return false
+	}
+	if p.SSID != "" && !contains(n.SSIDs, func(s string) bool { return s == p.SSID }) {
+		return false
+	}
+	if p.GatewayMAC != "" && !contains(n.Gateways, func(g Gateway) bool {
+		return g.MAC != "" && g.MAC == normalizeMAC(p.GatewayMAC)
+	}) {
+		return false
+	}
+	if p.Subnet != "" {
+		_, want, err := net.ParseCIDR(p.Subnet)
+		if err != nil || !contains(n.Subnets, func(s string) bool {
+			ip, _, err := net.ParseCIDR(s)
+			return err == nil && want.Contains(ip)
+		}) {
+			return false
+		}
+	}
+	if p.Interface != "" && !contains(n.Interfaces, func(name string) bool {
+		ok, _ := path.Match(p.Interface, name)
+		return ok
+	}) {
+		return false
+	}
+	return true
+}
+
+func contains[T any](s []T, f func(T) bool) bool {
+	for _, v := range s {
+		if f(v) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeMAC writes a MAC address as lower case and colon separated, as
+// Windows prints them with dashes.
+func normalizeMAC(mac string) string {
+	hw, err := net.ParseMAC(strings.ReplaceAll(strings.TrimSpace(mac), "-", ":"))
+	if err != nil {
+		return ""
+	}
+	return hw.String()
+}
+
+// output runs a command and returns its output, or "" if it fails or is
+// not installed.
+func output(ctx context.Context, name string, args ...string) string {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// field returns the value of the first "key : value" line whose key is
+// exactly key, as printed by netsh, airport and ipconfig.
+func field(out, key string) string {
+	for _, line := range strings.Split(out, "\n") {
+		k, v, ok := strings.Cut(line, ":")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package trust
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+const airport = "/System/Library/PrivateFrameworks/Apple80211.framework/Versions/Current/Resources/airport"
+
+// ssids returns the Wi-Fi network of each wireless interface, or under ""
+// when only airport could tell.
+func ssids(ctx context.Context) map[string]string {
+	ifaces, _ := net.Interfaces()
+	out := map[string]string{}
+	for _, iface := range ifaces {
+		if !strings.HasPrefix(iface.Name, "en") {
+			continue
+		}
+		if ssid := field(output(ctx, "ipconfig", "getsummary", iface.Name), "SSID"); ssid != "" {
+			out[iface.Name] = ssid
+		}
+	}
+	if len(out) == 0 {
+		if ssid := field(output(ctx, airport, "-I"), "SSID"); ssid != "" {
+			out[""] = ssid
+		}
+	}
+	return out
+}
+
+func gateways(ctx context.Context) []string {
+	if gw := field(output(ctx, "route", "-n", "get", "default"), "gateway"); net.ParseIP(gw) != nil {
+		return []string{gw}
+	}
+	return nil
+}
+
+// gatewayMAC parses "? (192.168.1.1) at aa:bb:cc:dd:ee:ff on en0 ...".
+func gatewayMAC(ctx context.Context, ip string) string {
+	f := strings.Fields(output(ctx, "arp", "-n", ip))
+	for i := 0; i+1 < len(f); i++ {
+		if f[i] == "at" {
+			return f[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,85 @@
+package trust
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ssids returns the Wi-Fi network of each wireless interface, or under ""
+// when it can't be told which interface is on it.
+func ssids(ctx context.Context) map[string]string {
+	out := map[string]string{}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if _, err := os.Stat(filepath.Join("/sys/class/net", iface.Name, "wireless")); err != nil {
+			continue
+		}
+		// nmcli escapes colons in the SSID as \:
+		list := output(ctx, "nmcli", "-t", "-f", "ACTIVE,SSID", "dev", "wifi", "list", "ifname", iface.Name)
+		for _, line := range strings.Split(list, "\n") {
+			if ssid, ok := strings.CutPrefix(line, "yes:"); ok && ssid != "" {
+				out[iface.Name] = strings.ReplaceAll(ssid, `\:`, ":")
+			}
+		}
+		if out[iface.Name] == "" {
+			if ssid := strings.TrimSpace(output(ctx, "iwgetid", iface.Name, "-r")); ssid != "" {
+				out[iface.Name] = ssid
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out
+	}
+	for _, line := range strings.Split(output(ctx, "nmcli", "-t", "-f", "ACTIVE,SSID", "dev", "wifi"), "\n") {
+		if ssid, ok := strings.CutPrefix(line, "yes:"); ok && ssid != "" {
+			out[""] = strings.ReplaceAll(ssid, `\:`, ":")
+		}
+	}
+	return out
+}
+
+// gateways reads the default routes from /proc/net/route, where addresses
+// are little-endian hex.
+func gateways(ctx context.Context) []string {
+	data, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		f := strings.Fields(line)
+		if len(f) < 3 || f[1] != "00000000" {
+			continue
+		}
+		b, err := hex.DecodeString(f[2])
+		if err != nil || len(b) != 4 {
+			continue
+		}
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(b))
+		if !ip.IsUnspecified() {
+			out = append(out, ip.String())
+		}
+	}
+	return out
+}
+
+// gatewayMAC looks ip up in the ARP cache.
+func gatewayMAC(ctx context.Context, ip string) string {
+	data, err := os.ReadFile("/proc/net/arp")
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n")[1:] {
+		f := strings.Fields(line)
+		if len(f) >= 4 && f[0] == ip {
+			return f[3]
+		}
+	}
+	return ""
+}
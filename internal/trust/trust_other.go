@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !windows
+
+package trust
+
+import "context"
+
+func ssids(ctx context.Context) map[string]string { return nil }
+
+func gateways(ctx context.Context) []string { return nil }
+
+func gatewayMAC(ctx context.Context, ip string) string { return "" }
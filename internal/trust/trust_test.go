@@ -0,0 +1,86 @@
+package trust_test
+
+import (
+	"slices"
+	"testing"
+
+	"clipsync/internal/config"
+	"clipsync/internal/trust"
+)
+
+func TestMatch(t *testing.T) {
+	home := trust.Network{
+		SSIDs:      []string{"HomeNet"},
+		Gateways:   []trust.Gateway{{IP: "192.168.1.1", MAC: "aa:bb:cc:dd:ee:ff"}},
+		Subnets:    []string{"192.168.1.23/24"},
+		Interfaces: []string{"wlan0", "docker0"},
+	}
+	tests := []struct {
+		name    string
+		profile config.NetworkProfile
+		want    bool
+	}{
+		{"ssid", config.NetworkProfile{SSID: "HomeNet"}, true},
+		{"other ssid", config.NetworkProfile{SSID: "Airport Free WiFi"}, false},
+		{"gateway with dashes", config.NetworkProfile{GatewayMAC: "AA-BB-CC-DD-EE-FF"}, true},
+		{"other gateway", config.NetworkProfile{GatewayMAC: "aa:bb:cc:dd:ee:00"}, false},
+		{"subnet", config.NetworkProfile{Subnet: "192.168.0.0/16"}, true},
+		{"other subnet", config.NetworkProfile{Subnet: "10.0.0.0/8"}, false},
+		{"interface pattern", config.NetworkProfile{Interface: "wlan*"}, true},
+		{"all fields", config.NetworkProfile{SSID: "HomeNet", Subnet: "192.168.1.0/24", Interface: "wlan0"}, true},
+		{"one field off", config.NetworkProfile{SSID: "HomeNet", Subnet: "10.0.0.0/8"}, false},
+		{"empty", config.NetworkProfile{Name: "anything"}, false},
+	}
+	for _, tt := range tests {
+		_, got := trust.Match([]config.NetworkProfile{tt.profile}, home)
+		if got != tt.want {
+			t.Errorf("%s: Match = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	profiles := []config.NetworkProfile{{Name: "office", SSID: "Corp"}, {Name: "home", SSID: "HomeNet"}}
+	if p, ok := trust.Match(profiles, home); !ok || p.Name != "home" {
+		t.Errorf("Match picked %q, want home", p.Name)
+	}
+}
+
+func TestTrustedInterfaces(t *testing.T) {
+	// Docked at home on Ethernet while the Wi-Fi is on a cafe hotspot
+	n := trust.Network{
+		SSIDs:    []string{"CafeGuest"},
+		Gateways: []trust.Gateway{{IP: "192.168.1.1", MAC: "aa:bb:cc:dd:ee:ff"}, {IP: "10.10.0.1", MAC: "11:22:33:44:55:66"}},
+		Links: []trust.Link{
+			{Name: "eth0", Subnets: []string{"192.168.1.23/24"}},
+			{Name: "wlan0", Subnets: []string{"10.10.3.7/16"}, SSID: "CafeGuest"},
+			{Name: "docker0", Subnets: []string{"172.17.0.1/16"}},
+		},
+	}
+	tests := []struct {
+		name    string
+		profile config.NetworkProfile
+		want    []string
+	}{
+		{"gateway", config.NetworkProfile{GatewayMAC: "aa:bb:cc:dd:ee:ff"}, []string{"eth0"}},
+		{"subnet", config.NetworkProfile{Subnet: "192.168.0.0/16"}, []string{"eth0"}},
+		{"interface", config.NetworkProfile{Interface: "eth*"}, []string{"eth0"}},
+		{"ssid", config.NetworkProfile{SSID: "CafeGuest"}, []string{"wlan0"}},
+		{"other ssid", config.NetworkProfile{SSID: "HomeNet"}, nil},
+		// Each field must hold on the same interface
+		{"fields on different interfaces", config.NetworkProfile{SSID: "CafeGuest", Subnet: "192.168.1.0/24"}, nil},
+		{"gateway of another interface", config.NetworkProfile{Interface: "wlan0", GatewayMAC: "aa:bb:cc:dd:ee:ff"}, nil},
+	}
+	for _, tt := range tests {
+		got := trust.TrustedInterfaces([]config.NetworkProfile{tt.profile}, n)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: TrustedInterfaces = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A Wi-Fi network no interface could be tied to counts for those
+	// without one
+	n.Links[1].SSID = ""
+	got := trust.TrustedInterfaces([]config.NetworkProfile{{SSID: "CafeGuest"}}, n)
+	if !slices.Equal(got, []string{"eth0", "wlan0", "docker0"}) {
+		t.Errorf("unattributed SSID: TrustedInterfaces = %v, want every interface", got)
+	}
+}
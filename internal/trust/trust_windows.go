@@ -0,0 +1,42 @@
+package trust
+
+import (
+	"context"
+	"net"
+	"strings"
+)
+
+// ssids returns the Wi-Fi network of each wireless interface.
+func ssids(ctx context.Context) map[string]string {
+	out := map[string]string{}
+	// One block per wireless interface; BSSID lines are skipped by field
+	for _, block := range strings.Split(output(ctx, "netsh", "wlan", "show", "interfaces"), "\r\n\r\n") {
+		if ssid := field(block, "SSID"); ssid != "" {
+			out[field(block, "Name")] = ssid
+		}
+	}
+	return out
+}
+
+// gateways parses the active routes to 0.0.0.0/0 from route print.
+func gateways(ctx context.Context) []string {
+	var out []string
+	for _, line := range strings.Split(output(ctx, "route", "print", "-4", "0.0.0.0"), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 3 && f[0] == "0.0.0.0" && f[1] == "0.0.0.0" && net.ParseIP(f[2]) != nil {
+			out = append(out, f[2])
+		}
+	}
+	return out
+}
+
+// gatewayMAC parses "  192.168.1.1   aa-bb-cc-dd-ee-ff   dynamic".
+func gatewayMAC(ctx context.Context, ip string) string {
+	for _, line := range strings.Split(output(ctx, "arp", "-a", ip), "\n") {
+		f := strings.Fields(line)
+		if len(f) >= 2 && f[0] == ip {
+			return f[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// StateDir returns the per-user directory for ClipSync's runtime state
+// (lock file, logs), creating it if needed.
+func StateDir() (string, error) {
+	var dir string
+	switch runtime.GOOS {
+	case "windows":
+		dir = os.Getenv("LOCALAPPDATA")
+		if dir == "" {
+			cfg, err := os.UserConfigDir()
+			if err != nil {
+				return "", err
+			}
+			dir = cfg
+		}
+		dir = filepath.Join(dir, "ClipSync")
+	case "darwin":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, "Library", "Application Support", "ClipSync")
+	default:
+		dir = os.Getenv("XDG_STATE_HOME")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return "", err
+			}
+			dir = filepath.Join(home, ".local", "state")
+		}
+		dir = filepath.Join(dir, "clipsync")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// InboxDir returns the default folder received files are saved to,
+// ClipSync in the user's Downloads folder. It is created on first use.
+func InboxDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if runtime.GOOS == "linux" {
+		// Honour a localized Downloads folder
+		if dir := xdgUserDir(home, "XDG_DOWNLOAD_DIR"); dir != "" {
+			return filepath.Join(dir, "ClipSync"), nil
+		}
+	}
+	return filepath.Join(home, "Downloads", "ClipSync"), nil
+}
+
+// xdgUserDir looks key up in user-dirs.dirs, where values look like
+// "$HOME/Downloads".
+func xdgUserDir(home, key string) string {
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		config = filepath.Join(home, ".config")
+	}
+	data, err := os.ReadFile(filepath.Join(config, "user-dirs.dirs"))
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), key+"=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		value = strings.Replace(value, "$HOME", home, 1)
+		if filepath.IsAbs(value) {
+			return value
+		}
+	}
+	return ""
+}
@@ -1,13 +1,16 @@
 package view
 
 import (
+	"slices"
+	"sync"
+	"time"
+
 	"clipsync/gui"
 	"clipsync/gui/pages"
+	"clipsync/internal/events"
 	"clipsync/internal/globals"
 )
 
-
-
 // UpdateDevices handles adding a new device to both global and GUI state.
 func UpdateDevices(Device globals.Device) {
 	// 1. Update Global State
@@ -24,6 +27,48 @@ func UpdateDevices(Device globals.Device) {
 		gui.State.Devices = append(gui.State.Devices, newDevice)
 		RedrawUI()
 	}
+
+	events.Publish(events.Event{Type: events.DeviceAdded, Device: &Device})
+}
+
+// RemoveDevice drops every device with the given IP from global and GUI state.
+func RemoveDevice(ip string) {
+	globals.ConnDevicesMu.Lock()
+	globals.ConnDevices = slices.DeleteFunc(globals.ConnDevices, func(d globals.Device) bool {
+		return d.Ip == ip
+	})
+	globals.ConnDevicesMu.Unlock()
+
+	if gui.State != nil {
+		gui.State.Devices = slices.DeleteFunc(gui.State.Devices, func(d pages.Device) bool {
+			return d.IP == ip
+		})
+		RedrawUI()
+	}
+
+	events.Publish(events.Event{Type: events.DeviceRemoved, Device: &globals.Device{Ip: ip}})
+}
+
+// sensitiveNext is a clip put on the clipboard as sensitive, waiting for
+// the watcher to add it to the history.
+var (
+	sensitiveMu   sync.Mutex
+	sensitiveNext string
+)
+
+// ExpectSensitive marks the next history entry holding data as sensitive.
+func ExpectSensitive(data string) {
+	sensitiveMu.Lock()
+	sensitiveNext = data
+	sensitiveMu.Unlock()
+}
+
+// Sensitive reports whether data is waiting to be marked sensitive, i.e.
+// it was put on the clipboard or received as sensitive.
+func Sensitive(data string) bool {
+	sensitiveMu.Lock()
+	defer sensitiveMu.Unlock()
+	return sensitiveNext != "" && data == sensitiveNext
 }
 
 // UpdateClipboard handles adding new clipboard data to both global and GUI state.
@@ -32,21 +77,194 @@ func UpdateClipboard(data string) {
 		return
 	}
 
+	sensitiveMu.Lock()
+	sensitive := sensitiveNext != "" && data == sensitiveNext
+	if sensitive {
+		sensitiveNext = ""
+	}
+	sensitiveMu.Unlock()
+
+	globals.ClipHistoryMu.Lock()
+	clip := globals.Clip{ID: globals.NextClipID, Data: data, Time: time.Now(), Sensitive: sensitive}
+	globals.NextClipID++
+	globals.ClipHistoryMu.Unlock()
+	AddClip(clip)
+}
+
+// AddClip puts an entry at the top of the history, keeping its ID.
+func AddClip(clip globals.Clip) {
 	// 1. Update Global State (Stack behavior: newest first)
 	globals.ClipHistoryMu.Lock()
-	globals.ClipHistory = append([]string{data}, globals.ClipHistory...)
+	globals.ClipHistory = append([]globals.Clip{clip}, globals.ClipHistory...)
+	globals.NextClipID = max(globals.NextClipID, clip.ID+1)
 	globals.ClipHistoryMu.Unlock()
 
 	// 2. Update GUI state if active
 	if gui.State != nil {
-		gui.State.History = append([]string{data}, gui.State.History...)
+		gui.State.History = append([]string{clip.Data}, gui.State.History...)
+		RedrawUI()
+	}
+
+	events.Publish(events.Event{Type: events.ClipAdded, Clip: &clip})
+}
+
+// FillClip replaces the preview of a pending entry with the fetched body.
+func FillClip(clip globals.Clip) {
+	if replaceClip(clip) {
+		events.Publish(events.Event{Type: events.ClipFetched, Clip: &clip})
+	}
+}
+
+// UpdateClip replaces the history entry with clip's ID, e.g. once it is
+// marked sensitive.
+func UpdateClip(clip globals.Clip) {
+	if replaceClip(clip) {
+		events.Publish(events.Event{Type: events.ClipUpdated, Clip: &clip})
+	}
+}
+
+// SaveHistory writes the history to disk when it is persisted. It is set
+// by whatever runs the engine, and called with ClipHistoryMu held.
+var SaveHistory func(history []globals.Clip)
+
+// MarkSensitive marks the history entry with the given id as sensitive,
+// and drops it from the saved history right away. It reports whether
+// there is such an entry.
+func MarkSensitive(id int) bool {
+	globals.ClipHistoryMu.Lock()
+	index := slices.IndexFunc(globals.ClipHistory, func(c globals.Clip) bool {
+		return c.ID == id
+	})
+	if index < 0 {
+		globals.ClipHistoryMu.Unlock()
+		return false
+	}
+	globals.ClipHistory[index].Sensitive = true
+	clip := globals.ClipHistory[index]
+	// Saving under the same lock means no save of an older copy can
+	// finish after this one and put the entry back
+	if SaveHistory != nil {
+		SaveHistory(globals.ClipHistory)
+	}
+	globals.ClipHistoryMu.Unlock()
+
+	events.Publish(events.Event{Type: events.ClipUpdated, Clip: &clip})
+	return true
+}
+
+// replaceClip swaps in clip for the entry with its ID, and reports whether
+// there was one.
+func replaceClip(clip globals.Clip) bool {
+	globals.ClipHistoryMu.Lock()
+	index := slices.IndexFunc(globals.ClipHistory, func(c globals.Clip) bool {
+		return c.ID == clip.ID
+	})
+	if index < 0 {
+		globals.ClipHistoryMu.Unlock()
+		return false
+	}
+	globals.ClipHistory[index] = clip
+	globals.ClipHistoryMu.Unlock()
+
+	if gui.State != nil && index < len(gui.State.History) {
+		gui.State.History[index] = clip.Data
+		RedrawUI()
+	}
+	return true
+}
+
+// LoadState replaces the devices and history wholesale, e.g. with a
+// snapshot from the daemon. history is newest first.
+func LoadState(devices []globals.Device, history []globals.Clip) {
+	globals.ConnDevicesMu.Lock()
+	globals.ConnDevices = devices
+	globals.ConnDevicesMu.Unlock()
+
+	globals.ClipHistoryMu.Lock()
+	globals.ClipHistory = history
+	for _, clip := range history {
+		globals.NextClipID = max(globals.NextClipID, clip.ID+1)
+	}
+	globals.ClipHistoryMu.Unlock()
+
+	if gui.State != nil {
+		gui.State.Devices = gui.State.Devices[:0]
+		for _, d := range devices {
+			gui.State.Devices = append(gui.State.Devices, pages.Device{Name: d.Name, IP: d.Ip})
+		}
+		gui.State.History = gui.State.History[:0]
+		for _, clip := range history {
+			gui.State.History = append(gui.State.History, clip.Data)
+		}
+		RedrawUI()
+	}
+}
+
+// UpdateTransfer shows a transfer's progress. Running transfers are listed
+// in the GUI and drop off once they end.
+func UpdateTransfer(t globals.Transfer) {
+	if gui.State != nil {
+		gui.State.TransfersMu.Lock()
+		index := slices.IndexFunc(gui.State.Transfers, func(p pages.Transfer) bool {
+			return p.ID == t.ID
+		})
+		switch {
+		case t.State != globals.TransferRunning:
+			if index >= 0 {
+				gui.State.Transfers = slices.Delete(gui.State.Transfers, index, index+1)
+			}
+		case index >= 0:
+			p := &gui.State.Transfers[index]
+			p.Done, p.Speed = t.Done, t.Speed
+		default:
+			gui.State.Transfers = append(gui.State.Transfers, pages.Transfer{
+				ID:       t.ID,
+				Name:     t.Name,
+				Peer:     t.Peer,
+				Incoming: t.Direction == "in",
+				Size:     t.Size,
+				Done:     t.Done,
+				Speed:    t.Speed,
+			})
+		}
+		gui.State.TransfersMu.Unlock()
+		RedrawUI()
+	}
+	events.Publish(events.Event{Type: events.TransferUpdated, Transfer: &t})
+}
+
+// SetPaused shows why sync is paused, or clears it when reason is "".
+func SetPaused(reason string) {
+	if gui.State != nil {
+		gui.State.Paused = reason
+		RedrawUI()
+	}
+	events.Publish(events.Event{Type: events.SyncPaused, Reason: reason})
+}
+
+// SetMembers shows the members of the relay group.
+func SetMembers(members []globals.Member) {
+	if gui.State != nil {
+		gui.State.MembersMu.Lock()
+		gui.State.Members = gui.State.Members[:0]
+		for _, m := range members {
+			gui.State.Members = append(gui.State.Members, pages.Member{
+				ID:      m.ID,
+				Name:    m.Name,
+				Seen:    m.Seen,
+				Revoked: m.Revoked,
+				Self:    m.Self,
+			})
+		}
+		gui.State.MembersMu.Unlock()
 		RedrawUI()
 	}
+	events.Publish(events.Event{Type: events.MembersUpdated, Members: members})
 }
 
 func RedrawUI() {
 	// Redraw the UI to show changes in both Update Devices and Clipboard
-	if gui.Window != nil{
+	if gui.Window != nil {
 		gui.Window.Invalidate()
 	}
-}
\ No newline at end of file
+}
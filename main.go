@@ -2,44 +2,105 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
 	"os"
 	"os/signal"
 	"syscall"
-	
+	"time"
+
 	"clipsync/gui"
 	"clipsync/internal/cli"
 	"clipsync/internal/clipboard"
+	"clipsync/internal/config"
 	"clipsync/internal/core"
-	"clipsync/internal/utils"
+	"clipsync/internal/instance"
+	"clipsync/internal/ipc"
+	"clipsync/internal/logging"
+	"clipsync/internal/remote"
 )
 
 var Version = "dev"
 
+var logger = logging.For(logging.Daemon)
+
 func main() {
-	if err := utils.EnsureAppInPath(); err != nil {
-		log.Printf("Failed to ensure app is in PATH: %v", err)
+	// Intercept CLI execution. If it returns true, we shouldn't start GUI.
+	if handled, code := cli.Run(); handled {
+		os.Exit(code)
 	}
 
-	clipboard.Init()
-
-	// Intercept CLI execution. If it returns true, we shouldn't start GUI.
-	if cli.Run() {
+	// Without a system clipboard there is no desktop to show a window on either,
+	// so keep syncing as a headless daemon instead.
+	if err := clipboard.Init(); err != nil {
+		logger.Warn("System clipboard unavailable, running headless", logging.Err(err))
+		if err := cli.RunDaemon(cli.DaemonOptions{Headless: true}); err != nil {
+			os.Exit(1)
+		}
 		return
 	}
 
+	// The GUI has no console, so log to its own file only: the daemon may be
+	// rotating the shared one
+	cfg, _ := config.Load()
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	if logFile, err := logging.Setup(logging.Options{Level: level, LogClips: cfg.LogClips, File: logging.GUIFileName}); err == nil {
+		defer logFile.Close()
+	}
+
 	// Setup context for graceful shutdown
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	// Run background sync tasks in a goroutine
-	go func() {
-		err := core.StartSync(ctx)
-		if err != nil && err != context.Canceled {
-			log.Printf("Background sync stopped: %v", err)
+	// The engine serves IPC whether it runs here or in a daemon
+	gui.CancelTransfer = func(id string) {
+		if err := ipc.CancelTransfer(id); err != nil {
+			logger.Warn("Could not cancel transfer", "id", id, logging.Err(err))
+		}
+	}
+	gui.RevokeDevice = func(id string) {
+		if _, err := ipc.RotateRelay([]string{id}); err != nil {
+			logger.Warn("Could not revoke device", "id", id, logging.Err(err))
+		}
+	}
+	gui.RotateKey = func() {
+		if _, err := ipc.RotateRelay(nil); err != nil {
+			logger.Warn("Could not rotate the group key", logging.Err(err))
 		}
-	}()
-	
+	}
+
+	// Run background sync tasks in a goroutine
+	go runEngineOrAttach(ctx)
+
 	// Start the GUI (blocking call)
 	gui.StartGUI()
 }
+
+// runEngineOrAttach shows a running daemon's state in the GUI, or runs the
+// engine in-process when there is no daemon, so the GUI and the CLI always
+// share one engine. If the daemon goes away the GUI takes over.
+func runEngineOrAttach(ctx context.Context) {
+	for ctx.Err() == nil {
+		if ipc.IsRunning() {
+			if err := remote.Attach(ctx); err != nil && ctx.Err() == nil {
+				logger.Warn("Lost connection to daemon", logging.Err(err))
+			}
+			time.Sleep(time.Second)
+			continue
+		}
+
+		err := core.Run(ctx, core.Options{})
+		switch {
+		case errors.Is(err, instance.ErrRunning):
+			// A daemon is starting up; attach once it answers
+			time.Sleep(time.Second)
+			continue
+		case err != nil && err != context.Canceled:
+			logger.Error("Background sync stopped", logging.Err(err))
+		}
+		if ctx.Err() == nil {
+			// Stopped through the CLI: the GUI was the engine, so close it too
+			os.Exit(0)
+		}
+		return
+	}
+}